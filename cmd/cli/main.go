@@ -0,0 +1,343 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"krillin-ai/config"
+	"krillin-ai/internal/deps"
+	"krillin-ai/internal/dto"
+	"krillin-ai/internal/service"
+	"krillin-ai/internal/types"
+	"krillin-ai/log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// 退出码
+const (
+	exitOk         = 0
+	exitTaskFailed = 1 // 任务执行失败
+	exitUsage      = 2 // 参数错误
+	exitEnv        = 3 // 配置或依赖环境错误
+)
+
+const usage = `用法: krillin-cli <命令> [参数] <视频链接或本地文件>
+
+命令:
+  transcribe  只转录，输出原语言字幕
+  translate   转录并翻译，输出字幕
+  dub         转录、翻译并配音
+  embed       转录、翻译并把字幕嵌入视频
+  run         按参数执行完整流程
+
+进度和日志输出到stderr，结果以json输出到stdout。使用 krillin-cli <命令> -h 查看参数。
+`
+
+// stringList 可重复的字符串参数
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// cliResult 输出到stdout的结果
+type cliResult struct {
+	TaskId             string                    `json:"task_id"`
+	Status             string                    `json:"status"`
+	FailReason         string                    `json:"fail_reason,omitempty"`
+	Subtitles          []cliSubtitle             `json:"subtitles,omitempty"`
+	Speech             string                    `json:"speech,omitempty"`
+	Videos             []string                  `json:"videos,omitempty"`
+	TtsFailedSentences []types.TtsFailedSentence `json:"tts_failed_sentences,omitempty"`
+	Usage              []types.ProviderUsage     `json:"usage,omitempty"`
+}
+
+type cliSubtitle struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+}
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(args []string) int {
+	// 各处的进度打印直接写os.Stdout，统一改到stderr，stdout只输出结果
+	stdout := os.Stdout
+	os.Stdout = os.Stderr
+
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" || args[0] == "help" {
+		fmt.Fprint(os.Stderr, usage)
+		if len(args) == 0 {
+			return exitUsage
+		}
+		return exitOk
+	}
+	command := args[0]
+	switch command {
+	case "transcribe", "translate", "dub", "embed", "run":
+	default:
+		fmt.Fprintf(os.Stderr, "未知命令: %s\n\n%s", command, usage)
+		return exitUsage
+	}
+
+	fs := flag.NewFlagSet(command, flag.ContinueOnError)
+	configPath := fs.String("config", "./config/config.toml", "配置文件路径")
+	fields := bindTaskFlags(fs, command)
+	if err := fs.Parse(args[1:]); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "需要且只能指定一个视频链接或本地文件")
+		return exitUsage
+	}
+
+	log.InitLogger()
+	defer log.GetLogger().Sync()
+	if !config.LoadConfigFile(*configPath) {
+		fmt.Fprintf(os.Stderr, "加载配置文件失败: %s\n", *configPath)
+		return exitEnv
+	}
+	if err := config.CheckConfig(); err != nil {
+		log.GetLogger().Error("加载配置失败", zap.Error(err))
+		return exitEnv
+	}
+	if err := deps.CheckDependency(); err != nil {
+		log.GetLogger().Error("依赖环境准备失败", zap.Error(err))
+		return exitEnv
+	}
+
+	svc := service.NewService()
+	if svc == nil {
+		fmt.Fprintln(os.Stderr, "创建服务失败，请检查转录配置")
+		return exitEnv
+	}
+	req, err := buildTaskReq(svc, fs, fields, command, fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+
+	var lastPercent uint8
+	stepParam, err := svc.RunSubtitleTaskSync(req, func(percent uint8) {
+		if percent != lastPercent {
+			lastPercent = percent
+			fmt.Fprintf(os.Stderr, "进度: %d%%\n", percent)
+		}
+	})
+	if stepParam == nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitTaskFailed
+	}
+
+	result := newCliResult(stepParam)
+	encoder := json.NewEncoder(stdout)
+	encoder.SetIndent("", "  ")
+	_ = encoder.Encode(result)
+	if err != nil {
+		return exitTaskFailed
+	}
+	return exitOk
+}
+
+// bindTaskFlags 注册与StartVideoSubtitleTaskReq对应的参数，返回 json字段名 -> 参数值
+func bindTaskFlags(fs *flag.FlagSet, command string) map[string]any {
+	fields := map[string]any{
+		"preset":                        fs.String("preset", "", "使用的参数预设，显式指定的参数覆盖预设"),
+		"origin_lang":                   fs.String("origin-lang", "", "视频原语言"),
+		"language":                      fs.String("ui-lang", "zh_cn", "界面语言，影响字幕文件名"),
+		"replace":                       &stringList{},
+		"origin_language_word_one_line": fs.Int("words-per-line", 0, "原语言字幕一行最多的字数，0为默认值"),
+		"llm_cache_bypass":              fs.Bool("no-llm-cache", false, "不使用大模型缓存，重新翻译"),
+	}
+	fs.Var(fields["replace"].(*stringList), "replace", "文字替换，格式为 原文|替换后，可重复指定")
+	if command == "transcribe" {
+		return fields
+	}
+	fields["target_lang"] = fs.String("target-lang", "", "翻译的目标语言")
+	fields["bilingual"] = fs.Bool("bilingual", true, "是否输出双语字幕")
+	fields["translation_subtitle_pos"] = fs.String("translation-pos", "top", "双语字幕中译文的位置：top, bottom")
+	fields["modal_filter"] = fs.Bool("modal-filter", false, "是否过滤语气词")
+	if command == "dub" || command == "run" {
+		if command == "run" {
+			fields["tts"] = fs.Bool("tts", false, "是否配音")
+		}
+		fields["tts_voice_code"] = fs.String("voice", "", "配音音色")
+		fields["tts_voice_clone_src_file_url"] = fs.String("voice-clone-src", "", "声音克隆源音频的本地路径")
+		fields["tts_voice_clone_from_source"] = fs.Bool("voice-clone-from-source", false, "从视频自身音频截取片段克隆音色")
+	}
+	if command == "embed" || command == "run" {
+		defaultEmbed := "horizontal"
+		if command == "run" {
+			defaultEmbed = "none"
+		}
+		fields["embed_subtitle_video_type"] = fs.String("embed", defaultEmbed, "字幕嵌入的视频类型：none, horizontal, vertical, all, soft_mp4, soft_mkv")
+		fields["vertical_major_title"] = fs.String("vertical-major-title", "", "竖屏视频的主标题")
+		fields["vertical_minor_title"] = fs.String("vertical-minor-title", "", "竖屏视频的副标题")
+		fields["reframe_mode"] = fs.String("reframe-mode", "", "画面比例转换方式：letterbox, blur, crop, smart")
+		fields["embed_aspect_ratios"] = &stringList{}
+		fs.Var(fields["embed_aspect_ratios"].(*stringList), "aspect-ratio", "合成视频的画面比例，如16:9, 9:16, 1:1, 4:5，可重复指定，-embed为horizontal/vertical/all时代替其横竖屏设置")
+		fields["vertical_resolution"] = fs.String("vertical-resolution", "", "竖屏视频分辨率，如1080x1920，默认720x1280")
+		fields["encoding_profile"] = fs.String("encoding-profile", "", "合成视频使用的编码配置名称，为空使用默认配置")
+	}
+	return fields
+}
+
+// buildTaskReq 把显式指定的参数和预设合并为任务请求，再按命令固定部分参数
+func buildTaskReq(svc *service.Service, fs *flag.FlagSet, fields map[string]any, command, input string) (dto.StartVideoSubtitleTaskReq, error) {
+	var req dto.StartVideoSubtitleTaskReq
+	// 未在命令行指定的参数不覆盖预设，没有预设时使用参数默认值
+	body := map[string]any{"url": toTaskUrl(input)}
+	preset := *fields["preset"].(*string)
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	fs.VisitAll(func(f *flag.Flag) {
+		key := flagName2Field(f.Name)
+		value, ok := fields[key]
+		if !ok || (preset != "" && !set[f.Name]) {
+			return
+		}
+		body[key] = toReqValue(key, value)
+	})
+	data, err := json.Marshal(body)
+	if err != nil {
+		return req, err
+	}
+	if err = svc.ApplyTaskPreset(data, &req); err != nil {
+		return req, err
+	}
+
+	switch command {
+	case "transcribe":
+		req.TargetLang = "none"
+		req.Tts = types.SubtitleTaskTtsNo
+		req.EmbedSubtitleVideoType = "none"
+	case "translate":
+		req.Tts = types.SubtitleTaskTtsNo
+		req.EmbedSubtitleVideoType = "none"
+	case "dub":
+		req.Tts = types.SubtitleTaskTtsYes
+		req.EmbedSubtitleVideoType = "none"
+	case "embed":
+		req.Tts = types.SubtitleTaskTtsNo
+	}
+	if req.TargetLang == "" {
+		return req, fmt.Errorf("需要指定目标语言 -target-lang")
+	}
+	if req.OriginLanguage == "" {
+		return req, fmt.Errorf("需要指定视频原语言 -origin-lang")
+	}
+	return req, nil
+}
+
+// flagName2Field 命令行参数名对应的请求字段名
+func flagName2Field(name string) string {
+	switch name {
+	case "origin-lang":
+		return "origin_lang"
+	case "target-lang":
+		return "target_lang"
+	case "ui-lang":
+		return "language"
+	case "words-per-line":
+		return "origin_language_word_one_line"
+	case "translation-pos":
+		return "translation_subtitle_pos"
+	case "voice":
+		return "tts_voice_code"
+	case "voice-clone-src":
+		return "tts_voice_clone_src_file_url"
+	case "voice-clone-from-source":
+		return "tts_voice_clone_from_source"
+	case "embed":
+		return "embed_subtitle_video_type"
+	case "aspect-ratio":
+		return "embed_aspect_ratios"
+	case "no-llm-cache":
+		return "llm_cache_bypass"
+	}
+	return strings.ReplaceAll(name, "-", "_")
+}
+
+// toReqValue 把参数值转换为请求中的取值，布尔参数对应请求中的1是2否
+func toReqValue(key string, value any) any {
+	switch v := value.(type) {
+	case *string:
+		if key == "translation_subtitle_pos" {
+			if *v == "bottom" {
+				return types.SubtitleTaskTranslationSubtitlePosBelow
+			}
+			return types.SubtitleTaskTranslationSubtitlePosTop
+		}
+		if key == "tts_voice_clone_src_file_url" && *v != "" {
+			return toTaskUrl(*v)
+		}
+		return *v
+	case *bool:
+		if *v {
+			return 1
+		}
+		return 2
+	case *int:
+		return *v
+	case *stringList:
+		return []string(*v)
+	}
+	return value
+}
+
+// toTaskUrl 本地文件转换为local:前缀的链接
+func toTaskUrl(input string) string {
+	if strings.HasPrefix(input, "local:") || strings.Contains(input, "://") {
+		return input
+	}
+	if absPath, err := filepath.Abs(input); err == nil {
+		return "local:" + absPath
+	}
+	return "local:" + input
+}
+
+func newCliResult(stepParam *types.SubtitleTaskStepParam) cliResult {
+	taskPtr := stepParam.TaskPtr
+	result := cliResult{
+		TaskId:             taskPtr.TaskId,
+		Status:             "success",
+		TtsFailedSentences: taskPtr.TtsFailedSentences,
+		Usage:              taskPtr.Usage.Snapshot(),
+	}
+	if taskPtr.Status != types.SubtitleTaskStatusSuccess {
+		result.Status = "failed"
+		result.FailReason = taskPtr.FailReason
+		return result
+	}
+	for _, info := range taskPtr.SubtitleInfos {
+		result.Subtitles = append(result.Subtitles, cliSubtitle{
+			Name: info.Name,
+			Path: absPath(strings.TrimPrefix(info.DownloadUrl, "/api/file/")),
+		})
+	}
+	if stepParam.TtsResultFilePath != "" {
+		result.Speech = absPath(stepParam.TtsResultFilePath)
+	}
+	videos, _ := filepath.Glob(filepath.Join(stepParam.TaskBasePath, "output", "*"))
+	for _, video := range videos {
+		result.Videos = append(result.Videos, absPath(video))
+	}
+	return result
+}
+
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
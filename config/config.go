@@ -8,6 +8,8 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"slices"
+	"strings"
 
 	"github.com/BurntSushi/toml"
 	"go.uber.org/zap"
@@ -37,6 +39,100 @@ type OpenaiCompatibleConfig struct {
 	Model   string `toml:"model"`
 }
 
+// LlmEndpointConfig 一个兼容openai格式的大模型接口，未填写的字段沿用[llm]中的配置
+type LlmEndpointConfig struct {
+	Name        string   `toml:"name"`
+	Provider    string   `toml:"provider"` // 接口类型：openai(兼容openai格式), ollama(ollama原生接口)
+	BaseUrl     string   `toml:"base_url"`
+	ApiKey      string   `toml:"api_key"`
+	Model       string   `toml:"model"`
+	Json        bool     `toml:"json"`         // 是否支持json格式输出，ollama始终支持
+	StreamUsage *bool    `toml:"stream_usage"` // 流式请求是否携带stream_options获取用量，不填时沿用[llm]的配置
+	Roles       []string `toml:"roles"`        // 承担的任务：translate, split, title, qa，留空表示全部
+	Weight      int      `toml:"weight"`       // 负载均衡权重，默认1
+}
+
+// StreamUsageEnabled 流式请求是否携带stream_options，部分兼容openai格式的服务不认识该字段会返回400，未配置时仅openai官方接口开启
+func (e LlmEndpointConfig) StreamUsageEnabled() bool {
+	if e.StreamUsage != nil {
+		return *e.StreamUsage
+	}
+	return e.BaseUrl == "" || strings.Contains(e.BaseUrl, "api.openai.com")
+}
+
+// LlmCallOptions 某类任务调用大模型时的生成参数，未填写的使用默认值
+type LlmCallOptions struct {
+	Temperature *float32 `toml:"temperature"`
+	MaxTokens   int      `toml:"max_tokens"`
+	NumCtx      int      `toml:"num_ctx"` // 上下文窗口大小，仅ollama生效，0表示使用模型默认值
+}
+
+type LlmConfig struct {
+	OpenaiCompatibleConfig
+	Provider    string                    `toml:"provider"`     // 接口类型：openai, ollama
+	Json        bool                      `toml:"json"`         // 接口是否支持json格式输出
+	StreamUsage *bool                     `toml:"stream_usage"` // 流式请求是否携带stream_options获取用量，不填时仅openai官方接口开启
+	Balance     string                    `toml:"balance"`      // 负载均衡方式：round_robin, weighted
+	CooldownSec int                       `toml:"cooldown_sec"` // 接口出错或限流后暂停分配请求的秒数
+	Options     map[string]LlmCallOptions `toml:"options"`      // 任务类型 -> 生成参数
+	Cache       CacheConfig               `toml:"cache"`        // 大模型返回结果的缓存
+	Endpoints   []LlmEndpointConfig       `toml:"endpoints"`
+}
+
+var defaultLlmTemperature float32 = 0.9
+
+// OptionsOf 返回某类任务的生成参数，未配置的项使用默认值
+func (l LlmConfig) OptionsOf(role string) LlmCallOptions {
+	options := l.Options[role]
+	if options.Temperature == nil {
+		options.Temperature = &defaultLlmTemperature
+	}
+	if options.MaxTokens <= 0 {
+		options.MaxTokens = 8192
+	}
+	if options.NumCtx < 0 {
+		options.NumCtx = 0
+	}
+	return options
+}
+
+// EndpointList 返回所有大模型接口，未配置endpoints时只有[llm]本身
+func (l LlmConfig) EndpointList() []LlmEndpointConfig {
+	provider := l.Provider
+	if provider == "" {
+		provider = "openai"
+	}
+	if len(l.Endpoints) == 0 {
+		return []LlmEndpointConfig{{Name: "default", Provider: provider, BaseUrl: l.BaseUrl, ApiKey: l.ApiKey, Model: l.Model, Json: l.Json, StreamUsage: l.StreamUsage, Weight: 1}}
+	}
+	endpoints := make([]LlmEndpointConfig, 0, len(l.Endpoints))
+	for i, endpoint := range l.Endpoints {
+		if endpoint.Name == "" {
+			endpoint.Name = fmt.Sprintf("endpoint%d", i+1)
+		}
+		if endpoint.Provider == "" {
+			endpoint.Provider = provider
+		}
+		if endpoint.BaseUrl == "" {
+			endpoint.BaseUrl = l.BaseUrl
+		}
+		if endpoint.ApiKey == "" {
+			endpoint.ApiKey = l.ApiKey
+		}
+		if endpoint.Model == "" {
+			endpoint.Model = l.Model
+		}
+		if endpoint.StreamUsage == nil {
+			endpoint.StreamUsage = l.StreamUsage
+		}
+		if endpoint.Weight <= 0 {
+			endpoint.Weight = 1
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+	return endpoints
+}
+
 type LocalModelConfig struct {
 	Model string `toml:"model"`
 }
@@ -51,6 +147,7 @@ type AliyunOssConfig struct {
 	AccessKeyId     string `toml:"access_key_id"`
 	AccessKeySecret string `toml:"access_key_secret"`
 	Bucket          string `toml:"bucket"`
+	Region          string `toml:"region"`
 }
 
 type AliyunTranscribeConfig struct {
@@ -60,6 +157,7 @@ type AliyunTranscribeConfig struct {
 
 type Transcribe struct {
 	Provider              string                 `toml:"provider"`
+	FallbackProviders     []string               `toml:"fallback_providers"` // provider失败后按顺序尝试的提供商
 	EnableGpuAcceleration bool                   `toml:"enable_gpu_acceleration"`
 	Openai                OpenaiCompatibleConfig `toml:"openai"`
 	Fasterwhisper         LocalModelConfig       `toml:"fasterwhisper"`
@@ -68,15 +166,220 @@ type Transcribe struct {
 	Aliyun                AliyunTranscribeConfig `toml:"aliyun"`
 }
 
+// ProviderChain 按尝试顺序返回转录提供商，去掉重复项
+func (t Transcribe) ProviderChain() []string {
+	chain := []string{t.Provider}
+	for _, provider := range t.FallbackProviders {
+		if provider == "" || slices.Contains(chain, provider) {
+			continue
+		}
+		chain = append(chain, provider)
+	}
+	return chain
+}
+
 type AliyunTtsConfig struct {
 	Oss    AliyunOssConfig    `toml:"oss"`
 	Speech AliyunSpeechConfig `toml:"speech"`
 }
 
+type VoiceCloneConfig struct {
+	Provider string   `toml:"provider"` // aliyun, local
+	Command  string   `toml:"command"`  // local时使用的克隆程序
+	Args     []string `toml:"args"`     // 克隆程序参数，{audio}替换为源音频路径，{name}替换为音色名
+}
+
+type CacheConfig struct {
+	Enable    bool   `toml:"enable"`
+	Dir       string `toml:"dir"`
+	MaxSizeMb int64  `toml:"max_size_mb"`
+}
+
+type TtsLimitConfig struct {
+	Concurrency       int `toml:"concurrency"`         // 同时进行的合成请求数，所有任务共享
+	RequestsPerMinute int `toml:"requests_per_minute"` // 每分钟请求数上限，0为不限制
+	MaxAttempts       int `toml:"max_attempts"`        // 单句合成的最大尝试次数
+	RetryBackoffMs    int `toml:"retry_backoff_ms"`    // 重试的基础等待时间，逐次翻倍并加随机抖动
+}
+
 type Tts struct {
-	Provider string                 `toml:"provider"`
-	Openai   OpenaiCompatibleConfig `toml:"openai"`
-	Aliyun   AliyunTtsConfig        `toml:"aliyun"`
+	Provider   string                    `toml:"provider"`
+	Openai     OpenaiCompatibleConfig    `toml:"openai"`
+	Aliyun     AliyunTtsConfig           `toml:"aliyun"`
+	VoiceClone VoiceCloneConfig          `toml:"voice_clone"`
+	Cache      CacheConfig               `toml:"cache"`
+	Limit      map[string]TtsLimitConfig `toml:"limit"` // 提供商 -> 限流配置
+}
+
+var defaultTtsLimit = TtsLimitConfig{
+	Concurrency:    3,
+	MaxAttempts:    3,
+	RetryBackoffMs: 2000,
+}
+
+// LimitOf 获取提供商的限流配置，未配置的项使用默认值
+func (t Tts) LimitOf(provider string) TtsLimitConfig {
+	limit := t.Limit[provider]
+	if limit.Concurrency <= 0 {
+		limit.Concurrency = defaultTtsLimit.Concurrency
+	}
+	if limit.MaxAttempts <= 0 {
+		limit.MaxAttempts = defaultTtsLimit.MaxAttempts
+	}
+	if limit.RetryBackoffMs <= 0 {
+		limit.RetryBackoffMs = defaultTtsLimit.RetryBackoffMs
+	}
+	if limit.RequestsPerMinute < 0 {
+		limit.RequestsPerMinute = 0
+	}
+	return limit
+}
+
+// UsagePrice 提供商的单价，币种见Usage.Currency
+type UsagePrice struct {
+	PromptPer1kTokens     float64 `toml:"prompt_per_1k_tokens"`     // 大模型输入每千token
+	CompletionPer1kTokens float64 `toml:"completion_per_1k_tokens"` // 大模型输出每千token
+	PerAudioMinute        float64 `toml:"per_audio_minute"`         // 转录每分钟音频
+	Per1kChars            float64 `toml:"per_1k_chars"`             // 语音合成每千字
+}
+
+type Usage struct {
+	Currency   string                `toml:"currency"`
+	Llm        map[string]UsagePrice `toml:"llm"`        // 大模型接口名 -> 单价，未配置endpoints时接口名为default
+	Transcribe map[string]UsagePrice `toml:"transcribe"` // 转录提供商 -> 单价
+	Tts        map[string]UsagePrice `toml:"tts"`        // 语音合成提供商 -> 单价
+}
+
+// PriceOf 返回某类提供商的单价，未配置时为0
+func (u Usage) PriceOf(kind, provider string) UsagePrice {
+	switch kind {
+	case "llm":
+		return u.Llm[provider]
+	case "transcribe":
+		return u.Transcribe[provider]
+	case "tts":
+		return u.Tts[provider]
+	}
+	return UsagePrice{}
+}
+
+// EncodingProfile 合成视频时的编码参数
+type EncodingProfile struct {
+	VideoCodec   string `toml:"video_codec"`   // h264, hevc
+	Crf          int    `toml:"crf"`           // 质量参数，越小画质越高；与video_bitrate都不填时参考源视频码率
+	VideoBitrate string `toml:"video_bitrate"` // 视频码率，如6M，填写后优先于crf
+	Preset       string `toml:"preset"`        // 软件编码的速度预设，如fast, medium
+	Fps          int    `toml:"fps"`           // 输出帧率，0保持源视频帧率
+	AudioCodec   string `toml:"audio_codec"`
+	AudioBitrate string `toml:"audio_bitrate"`
+	HwAccel      string `toml:"hw_accel"`     // 硬件编码：none, auto, nvenc, qsv, vaapi，ffmpeg不支持或编码失败时回退到软件编码
+	VaapiDevice  string `toml:"vaapi_device"` // vaapi使用的设备
+}
+
+type Encoding struct {
+	DefaultProfile string                     `toml:"default_profile"` // 任务未指定时使用的编码配置
+	Profiles       map[string]EncodingProfile `toml:"profiles"`        // 名称 -> 编码配置
+}
+
+// ProfileOf 返回指定名称的编码配置并补全默认值，名称为空时使用默认配置
+func (e Encoding) ProfileOf(name string) (EncodingProfile, error) {
+	if name == "" {
+		name = e.DefaultProfile
+	}
+	profile, ok := e.Profiles[name]
+	if !ok {
+		if name != "default" {
+			return EncodingProfile{}, fmt.Errorf("编码配置不存在: %s", name)
+		}
+		profile = EncodingProfile{Crf: 23}
+	}
+	if profile.VideoCodec == "" {
+		profile.VideoCodec = "h264"
+	}
+	if profile.Preset == "" {
+		profile.Preset = "medium"
+	}
+	if profile.AudioCodec == "" {
+		profile.AudioCodec = "aac"
+	}
+	if profile.AudioBitrate == "" {
+		profile.AudioBitrate = "192k"
+	}
+	if profile.HwAccel == "" {
+		profile.HwAccel = "none"
+	}
+	if profile.VaapiDevice == "" {
+		profile.VaapiDevice = "/dev/dri/renderD128"
+	}
+	return profile, nil
+}
+
+// Subtitle 字幕排版和质量检查的限制，宽度以半角字符计，中日韩等全角字符算2
+type Subtitle struct {
+	MaxLineWidth  int     `toml:"max_line_width"`  // 每行最大宽度
+	MaxLines      int     `toml:"max_lines"`       // 每条字幕最多几行
+	MaxCps        float64 `toml:"max_cps"`         // 每秒最多显示的字符宽度
+	MinDurationMs int     `toml:"min_duration_ms"` // 每条字幕的最短显示时间
+	MaxDurationMs int     `toml:"max_duration_ms"` // 每条字幕的最长显示时间
+	MinGapMs      int     `toml:"min_gap_ms"`      // 相邻字幕的最小间隔，更短的间隔会造成闪烁
+	QaEnable      bool    `toml:"qa_enable"`       // 生成字幕后是否进行质量检查
+	QaAutoFix     bool    `toml:"qa_auto_fix"`     // 质量检查时是否自动修复能安全修复的问题
+}
+
+var defaultSubtitle = Subtitle{
+	MaxLineWidth:  42,
+	MaxLines:      2,
+	MaxCps:        17,
+	MinDurationMs: 1000,
+	MaxDurationMs: 7000,
+	MinGapMs:      80,
+	QaEnable:      true,
+	QaAutoFix:     true,
+}
+
+// Limits 返回字幕排版和质量检查的限制，未配置的项使用默认值
+func (s Subtitle) Limits() Subtitle {
+	if s.MaxLineWidth <= 0 {
+		s.MaxLineWidth = defaultSubtitle.MaxLineWidth
+	}
+	if s.MaxLines <= 0 {
+		s.MaxLines = defaultSubtitle.MaxLines
+	}
+	if s.MaxCps <= 0 {
+		s.MaxCps = defaultSubtitle.MaxCps
+	}
+	if s.MinDurationMs < 0 {
+		s.MinDurationMs = 0
+	}
+	if s.MaxDurationMs <= 0 {
+		s.MaxDurationMs = defaultSubtitle.MaxDurationMs
+	}
+	if s.MinGapMs < 0 {
+		s.MinGapMs = 0
+	}
+	return s
+}
+
+// Align 强制对齐，用最终的原文句子和音频重新计算句子和词的时间，替代转录结果中的时间戳
+type Align struct {
+	Provider string   `toml:"provider"` // 留空不启用；local为调用本地对齐程序
+	Command  string   `toml:"command"`  // local时使用的对齐程序
+	Args     []string `toml:"args"`     // 对齐程序参数，{audio}音频路径，{text}每行一句的原文文件，{language}语言，{output}结果json路径
+}
+
+type WatchFolderConfig struct {
+	Dir       string `toml:"dir"`        // 监控的目录
+	Preset    string `toml:"preset"`     // 创建任务使用的参数预设
+	OutputDir string `toml:"output_dir"` // 结果输出目录，按源文件的相对路径镜像；为空时写到源文件旁边
+	Recursive bool   `toml:"recursive"`  // 是否监控子目录
+}
+
+type Watch struct {
+	Enable          bool                `toml:"enable"`
+	PollIntervalSec int                 `toml:"poll_interval_sec"` // 扫描间隔，秒
+	StableSeconds   int                 `toml:"stable_seconds"`    // 文件大小保持不变多少秒后才认为复制完成
+	RetryFailedSec  int                 `toml:"retry_failed_sec"`  // 处理失败的文件多少秒后重新处理，0表示不自动重试
+	Folders         []WatchFolderConfig `toml:"folders"`
 }
 
 type OpenAiWhisper struct {
@@ -85,11 +388,16 @@ type OpenAiWhisper struct {
 }
 
 type Config struct {
-	App        App                    `toml:"app"`
-	Server     Server                 `toml:"server"`
-	Llm        OpenaiCompatibleConfig `toml:"llm"`
-	Transcribe Transcribe             `toml:"transcribe"`
-	Tts        Tts                    `toml:"tts"`
+	App        App        `toml:"app"`
+	Server     Server     `toml:"server"`
+	Llm        LlmConfig  `toml:"llm"`
+	Transcribe Transcribe `toml:"transcribe"`
+	Tts        Tts        `toml:"tts"`
+	Watch      Watch      `toml:"watch"`
+	Usage      Usage      `toml:"usage"`
+	Encoding   Encoding   `toml:"encoding"`
+	Subtitle   Subtitle   `toml:"subtitle"`
+	Align      Align      `toml:"align"`
 }
 
 var Conf = Config{
@@ -105,8 +413,17 @@ var Conf = Config{
 		Host: "127.0.0.1",
 		Port: 8888,
 	},
-	Llm: OpenaiCompatibleConfig{
-		Model: "gpt-4o-mini",
+	Llm: LlmConfig{
+		OpenaiCompatibleConfig: OpenaiCompatibleConfig{
+			Model: "gpt-4o-mini",
+		},
+		Balance:     "round_robin",
+		CooldownSec: 30,
+		Cache: CacheConfig{
+			Enable:    true,
+			Dir:       "./cache/llm",
+			MaxSizeMb: 256,
+		},
 	},
 	Transcribe: Transcribe{
 		Provider:              "openai",
@@ -129,13 +446,72 @@ var Conf = Config{
 		Openai: OpenaiCompatibleConfig{
 			Model: "gpt-4o-mini-tts",
 		},
+		VoiceClone: VoiceCloneConfig{
+			Provider: "aliyun",
+		},
+		Cache: CacheConfig{
+			Enable:    true,
+			Dir:       "./cache/tts",
+			MaxSizeMb: 1024,
+		},
+	},
+	Watch: Watch{
+		PollIntervalSec: 10,
+		StableSeconds:   30,
+		RetryFailedSec:  3600,
+	},
+	Usage: Usage{
+		Currency: "USD",
 	},
+	Encoding: Encoding{
+		DefaultProfile: "default",
+	},
+	Subtitle: defaultSubtitle,
 }
 
 // 检查必要的配置是否完整
 func validateConfig() error {
-	// 检查转写服务提供商配置
-	switch Conf.Transcribe.Provider {
+	for _, endpoint := range Conf.Llm.EndpointList() {
+		if endpoint.Provider != "openai" && endpoint.Provider != "ollama" {
+			return fmt.Errorf("不支持的大模型接口类型: %s", endpoint.Provider)
+		}
+	}
+
+	for name, profile := range Conf.Encoding.Profiles {
+		if profile.VideoCodec != "" && profile.VideoCodec != "h264" && profile.VideoCodec != "hevc" {
+			return fmt.Errorf("编码配置%s的video_codec不支持: %s", name, profile.VideoCodec)
+		}
+		switch profile.HwAccel {
+		case "", "none", "auto", "nvenc", "qsv", "vaapi":
+		default:
+			return fmt.Errorf("编码配置%s的hw_accel不支持: %s", name, profile.HwAccel)
+		}
+	}
+	if _, err := Conf.Encoding.ProfileOf(""); err != nil {
+		return fmt.Errorf("默认编码配置不存在: %s", Conf.Encoding.DefaultProfile)
+	}
+
+	switch Conf.Align.Provider {
+	case "":
+	case "local":
+		if Conf.Align.Command == "" {
+			return errors.New("使用本地强制对齐需要配置对齐程序 align.command")
+		}
+	default:
+		return fmt.Errorf("不支持的强制对齐提供商: %s", Conf.Align.Provider)
+	}
+
+	// 检查转写服务提供商配置，备用提供商也需要配置完整
+	for _, provider := range Conf.Transcribe.ProviderChain() {
+		if err := validateTranscribeProvider(provider); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateTranscribeProvider(provider string) error {
+	switch provider {
 	case "openai":
 		if Conf.Transcribe.Openai.ApiKey == "" {
 			return errors.New("使用OpenAI转录服务需要配置 OpenAI API Key")
@@ -165,15 +541,19 @@ func validateConfig() error {
 			return errors.New("使用阿里云语音服务需要配置相关密钥")
 		}
 	default:
-		return errors.New("不支持的转录提供商")
+		return fmt.Errorf("不支持的转录提供商: %s", provider)
 	}
 
 	return nil
 }
 
 func LoadConfig() bool {
+	return LoadConfigFile("./config/config.toml")
+}
+
+// LoadConfigFile 从指定路径加载配置
+func LoadConfigFile(configPath string) bool {
 	var err error
-	configPath := "./config/config.toml"
 	if _, err = os.Stat(configPath); os.IsNotExist(err) {
 		log.GetLogger().Info("未找到配置文件")
 		return false
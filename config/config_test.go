@@ -0,0 +1,23 @@
+package config
+
+import "testing"
+
+func TestTtsLimitOf(t *testing.T) {
+	tts := Tts{Limit: map[string]TtsLimitConfig{
+		"aliyun": {Concurrency: 1, RequestsPerMinute: 60, MaxAttempts: 5, RetryBackoffMs: 500},
+		"openai": {RequestsPerMinute: -1},
+	}}
+	tests := []struct {
+		provider string
+		want     TtsLimitConfig
+	}{
+		{provider: "aliyun", want: TtsLimitConfig{Concurrency: 1, RequestsPerMinute: 60, MaxAttempts: 5, RetryBackoffMs: 500}},
+		{provider: "openai", want: TtsLimitConfig{Concurrency: 3, RequestsPerMinute: 0, MaxAttempts: 3, RetryBackoffMs: 2000}},
+		{provider: "edge-tts", want: defaultTtsLimit},
+	}
+	for _, tt := range tests {
+		if got := tts.LimitOf(tt.provider); got != tt.want {
+			t.Errorf("LimitOf(%q) = %+v, want %+v", tt.provider, got, tt.want)
+		}
+	}
+}
@@ -26,7 +26,7 @@ type SubtitleTask struct {
 	TTSVoiceCloneSrcFileURL string   `json:"tts_voice_clone_src_file_url,omitempty"` // 音色克隆源文件URL
 	ModalFilter             int      `json:"modal_filter"`                           // 是否过滤语气词 1:是 2:否
 	Replace                 []string `json:"replace,omitempty"`                      // 词汇替换列表
-	EmbedSubtitleVideoType  string   `json:"embed_subtitle_video_type"`              // 字幕嵌入视频类型 none:不嵌入 horizontal:横屏 vertical:竖屏 all:全部
+	EmbedSubtitleVideoType  string   `json:"embed_subtitle_video_type"`              // 字幕嵌入视频类型 none:不嵌入 horizontal:横屏 vertical:竖屏 all:全部 soft_mp4/soft_mkv:封装为可选字幕轨道
 	VerticalMajorTitle      string   `json:"vertical_major_title,omitempty"`         // 竖屏主标题
 	VerticalMinorTitle      string   `json:"vertical_minor_title,omitempty"`         // 竖屏副标题
 }
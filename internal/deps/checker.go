@@ -30,50 +30,53 @@ func CheckDependency() error {
 		log.GetLogger().Error("yt-dlp环境准备失败", zap.Error(err))
 		return err
 	}
-	if config.Conf.Transcribe.Provider == "fasterwhisper" {
-		err = checkFasterWhisper()
-		if err != nil {
-			log.GetLogger().Error("fasterwhisper环境准备失败", zap.Error(err))
-			return err
-		}
-		err = checkModel("fasterwhisper")
-		if err != nil {
-			log.GetLogger().Error("本地模型环境准备失败", zap.Error(err))
-			return err
-		}
-	}
-	if config.Conf.Transcribe.Provider == "whisperkit" {
-		if err = checkWhisperKit(); err != nil {
-			log.GetLogger().Error("whisperkit环境准备失败", zap.Error(err))
-			return err
-		}
-		err = checkModel("whisperkit")
-		if err != nil {
-			log.GetLogger().Error("本地模型环境准备失败", zap.Error(err))
-			return err
-		}
-	}
-	if config.Conf.Transcribe.Provider == "whisperx" {
-		err = checkWhisperX()
-		if err != nil {
-			log.GetLogger().Error("whisperx环境准备失败", zap.Error(err))
-			return err
+	// 主提供商和备用提供商的本地环境都需要准备好
+	for _, provider := range config.Conf.Transcribe.ProviderChain() {
+		if provider == "fasterwhisper" {
+			err = checkFasterWhisper()
+			if err != nil {
+				log.GetLogger().Error("fasterwhisper环境准备失败", zap.Error(err))
+				return err
+			}
+			err = checkModel("fasterwhisper")
+			if err != nil {
+				log.GetLogger().Error("本地模型环境准备失败", zap.Error(err))
+				return err
+			}
 		}
-		err = checkModel("whisperx")
-		if err != nil {
-			log.GetLogger().Error("本地模型环境准备失败", zap.Error(err))
-			return err
+		if provider == "whisperkit" {
+			if err = checkWhisperKit(); err != nil {
+				log.GetLogger().Error("whisperkit环境准备失败", zap.Error(err))
+				return err
+			}
+			err = checkModel("whisperkit")
+			if err != nil {
+				log.GetLogger().Error("本地模型环境准备失败", zap.Error(err))
+				return err
+			}
 		}
-	}
-	if config.Conf.Transcribe.Provider == "whispercpp" {
-		if err = checkWhispercpp(); err != nil {
-			log.GetLogger().Error("whispercpp环境准备失败", zap.Error(err))
-			return err
+		if provider == "whisperx" {
+			err = checkWhisperX()
+			if err != nil {
+				log.GetLogger().Error("whisperx环境准备失败", zap.Error(err))
+				return err
+			}
+			err = checkModel("whisperx")
+			if err != nil {
+				log.GetLogger().Error("本地模型环境准备失败", zap.Error(err))
+				return err
+			}
 		}
-		err = checkModel("whispercpp")
-		if err != nil {
-			log.GetLogger().Error("whispercpp本地模型环境准备失败", zap.Error(err))
-			return err
+		if provider == "whispercpp" {
+			if err = checkWhispercpp(); err != nil {
+				log.GetLogger().Error("whispercpp环境准备失败", zap.Error(err))
+				return err
+			}
+			err = checkModel("whispercpp")
+			if err != nil {
+				log.GetLogger().Error("whispercpp本地模型环境准备失败", zap.Error(err))
+				return err
+			}
 		}
 	}
 	if config.Conf.Tts.Provider == "edge-tts" {
@@ -1,22 +1,55 @@
 package dto
 
 type StartVideoSubtitleTaskReq struct {
-	AppId                     uint32   `json:"app_id"`
-	Url                       string   `json:"url"`
-	OriginLanguage            string   `json:"origin_lang"`
-	TargetLang                string   `json:"target_lang"`
-	Bilingual                 uint8    `json:"bilingual"`
-	TranslationSubtitlePos    uint8    `json:"translation_subtitle_pos"`
-	ModalFilter               uint8    `json:"modal_filter"`
-	Tts                       uint8    `json:"tts"`
-	TtsVoiceCode              string   `json:"tts_voice_code"`
-	TtsVoiceCloneSrcFileUrl   string   `json:"tts_voice_clone_src_file_url"`
-	Replace                   []string `json:"replace"`
-	Language                  string   `json:"language"`
-	EmbedSubtitleVideoType    string   `json:"embed_subtitle_video_type"`
-	VerticalMajorTitle        string   `json:"vertical_major_title"`
-	VerticalMinorTitle        string   `json:"vertical_minor_title"`
-	OriginLanguageWordOneLine int      `json:"origin_language_word_one_line"`
+	AppId                     uint32        `json:"app_id"`
+	Url                       string        `json:"url"`
+	OriginLanguage            string        `json:"origin_lang"`
+	TargetLang                string        `json:"target_lang"`
+	Bilingual                 uint8         `json:"bilingual"`
+	TranslationSubtitlePos    uint8         `json:"translation_subtitle_pos"`
+	ModalFilter               uint8         `json:"modal_filter"`
+	Tts                       uint8         `json:"tts"`
+	TtsVoiceCode              string        `json:"tts_voice_code"`
+	TtsVoiceCloneSrcFileUrl   string        `json:"tts_voice_clone_src_file_url"`
+	TtsVoiceCloneFromSource   uint8         `json:"tts_voice_clone_from_source"`
+	Replace                   []string      `json:"replace"`
+	Language                  string        `json:"language"`
+	EmbedSubtitleVideoType    string        `json:"embed_subtitle_video_type"`
+	VerticalMajorTitle        string        `json:"vertical_major_title"`
+	VerticalMinorTitle        string        `json:"vertical_minor_title"`
+	EmbedAspectRatios         []string      `json:"embed_aspect_ratios"`   // 合成视频的画面比例，如16:9, 9:16, 1:1, 4:5，嵌入类型为horizontal/vertical/all时代替其横竖屏设置
+	ReframeMode               string        `json:"reframe_mode"`          // 转换画面比例的方式：letterbox(默认), blur, crop, smart
+	VerticalReframeMode       string        `json:"vertical_reframe_mode"` // Deprecated: 旧参数名，reframe_mode为空时使用
+	VerticalResolution        string        `json:"vertical_resolution"`   // 竖屏视频分辨率，如1080x1920，默认720x1280
+	OriginLanguageWordOneLine int           `json:"origin_language_word_one_line"`
+	LlmCacheBypass            uint8         `json:"llm_cache_bypass"` // 1-不使用大模型缓存，重新翻译 2-使用
+	SubtitleStyle             SubtitleStyle `json:"subtitle_style"`   // 嵌入视频的字幕样式，不填使用默认样式
+	EncodingProfile           string        `json:"encoding_profile"` // 合成视频使用的编码配置，见配置文件encoding.profiles
+	Preset                    string        `json:"preset"`           // 使用的参数预设，请求中的字段覆盖预设中的字段
+}
+
+// SubtitleLineStyle 一行字幕的样式，字号、描边、边距等以视频高度1080为基准
+type SubtitleLineStyle struct {
+	FontName     string   `json:"font_name"`
+	FontFile     string   `json:"font_file"`
+	FontSize     float64  `json:"font_size"`
+	Bold         *bool    `json:"bold"`
+	PrimaryColor string   `json:"primary_color"` // #RRGGBB或#AARRGGBB
+	OutlineColor string   `json:"outline_color"`
+	Outline      *float64 `json:"outline"`
+	Shadow       *float64 `json:"shadow"`
+	Spacing      *float64 `json:"spacing"`
+	Box          *bool    `json:"box"`
+	BoxColor     string   `json:"box_color"`
+	Alignment    int      `json:"alignment"` // 按小键盘1-9
+	MarginL      *float64 `json:"margin_l"`
+	MarginR      *float64 `json:"margin_r"`
+	MarginV      *float64 `json:"margin_v"`
+}
+
+type SubtitleStyle struct {
+	Major SubtitleLineStyle `json:"major"`
+	Minor SubtitleLineStyle `json:"minor"`
 }
 
 type StartVideoSubtitleTaskResData struct {
@@ -47,12 +80,90 @@ type SubtitleInfo struct {
 }
 
 type GetVideoSubtitleTaskResData struct {
-	TaskId            string          `json:"task_id"`
-	ProcessPercent    uint8           `json:"process_percent"`
-	VideoInfo         *VideoInfo      `json:"video_info"`
-	SubtitleInfo      []*SubtitleInfo `json:"subtitle_info"`
-	TargetLanguage    string          `json:"target_language"`
-	SpeechDownloadUrl string          `json:"speech_download_url"`
+	TaskId             string               `json:"task_id"`
+	ProcessPercent     uint8                `json:"process_percent"`
+	VideoInfo          *VideoInfo           `json:"video_info"`
+	SubtitleInfo       []*SubtitleInfo      `json:"subtitle_info"`
+	TargetLanguage     string               `json:"target_language"`
+	SpeechDownloadUrl  string               `json:"speech_download_url"`
+	TtsCacheHit        int                  `json:"tts_cache_hit"`  // 配音命中缓存的句数
+	TtsCacheMiss       int                  `json:"tts_cache_miss"` // 配音实际合成的句数
+	TtsFailedSentences []*TtsFailedSentence `json:"tts_failed_sentences"`
+	Usage              *TaskUsage           `json:"usage"`     // 各提供商的用量和费用
+	QaReport           *SubtitleQaReport    `json:"qa_report"` // 字幕质量检查结果，未检查时为空
+}
+
+type SubtitleQaIssue struct {
+	Index  int    `json:"index"`
+	Type   string `json:"type"`
+	Detail string `json:"detail"`
+	Text   string `json:"text"`
+	Action string `json:"action"`
+}
+
+type SubtitleQaReport struct {
+	CueNum   int                `json:"cue_num"`
+	IssueNum int                `json:"issue_num"`
+	FixedNum int                `json:"fixed_num"`
+	Issues   []*SubtitleQaIssue `json:"issues"`
+}
+
+type TtsFailedSentence struct {
+	Index  int    `json:"index"`
+	Text   string `json:"text"`
+	Reason string `json:"reason"`
+}
+
+type TtsResynthesizeItem struct {
+	Index int    `json:"index"` // 字幕序号，从1开始
+	Text  string `json:"text"`  // 为空时沿用原文本
+}
+
+type TtsResynthesizeReq struct {
+	TaskId       string                `json:"task_id"`
+	Items        []TtsResynthesizeItem `json:"items"`          // 为空时重新合成所有失败的句子
+	TtsVoiceCode string                `json:"tts_voice_code"` // 为空时沿用任务的音色
+}
+
+type TtsResynthesizeResData struct {
+	TaskId string `json:"task_id"`
+}
+
+type GetSubtitleCuesReq struct {
+	TaskId string `form:"taskId"`
+}
+
+type SubtitleCue struct {
+	Index      int     `json:"index"`      // 字幕序号，从1开始
+	StartTime  float64 `json:"start_time"` // 秒
+	EndTime    float64 `json:"end_time"`
+	OriginText string  `json:"origin_text"`
+	TargetText string  `json:"target_text"`
+}
+
+type GetSubtitleCuesResData struct {
+	TaskId string         `json:"task_id"`
+	Cues   []*SubtitleCue `json:"cues"`
+}
+
+// SubtitleCuePatch 修改一条字幕，为空的字段保持不变
+type SubtitleCuePatch struct {
+	Index      int      `json:"index"`
+	StartTime  *float64 `json:"start_time"`
+	EndTime    *float64 `json:"end_time"`
+	OriginText *string  `json:"origin_text"`
+	TargetText *string  `json:"target_text"`
+}
+
+type UpdateSubtitleCuesReq struct {
+	TaskId string             `json:"task_id"`
+	Cues   []SubtitleCuePatch `json:"cues"`
+}
+
+type UpdateSubtitleCuesResData struct {
+	TaskId      string   `json:"task_id"`
+	Regenerated []string `json:"regenerated"` // 重新生成的产物：subtitle,tts,audio,video
+	TtsIndexes  []int    `json:"tts_indexes"` // 重新合成配音的字幕序号
 }
 
 type GetVideoSubtitleTaskRes struct {
@@ -60,3 +171,49 @@ type GetVideoSubtitleTaskRes struct {
 	Msg   string                       `json:"msg"`
 	Data  *GetVideoSubtitleTaskResData `json:"data"`
 }
+
+type TtsPreviewReq struct {
+	Text                    string `json:"text"`
+	TtsVoiceCode            string `json:"tts_voice_code"`
+	Provider                string `json:"provider"` // 为空时使用配置中的tts提供商
+	TtsVoiceCloneSrcFileUrl string `json:"tts_voice_clone_src_file_url"`
+}
+
+type TtsPreviewResData struct {
+	AudioUrl string `json:"audio_url"`
+	Cached   bool   `json:"cached"`
+}
+
+type StartBatchSubtitleTaskReq struct {
+	StartVideoSubtitleTaskReq
+	MaxItems int `json:"max_items"` // 最多处理的视频数，0为不限制
+}
+
+type StartBatchSubtitleTaskResData struct {
+	BatchId string `json:"batch_id"`
+}
+
+type GetBatchSubtitleTaskReq struct {
+	BatchId string `form:"batchId"`
+}
+
+type BatchTaskItem struct {
+	TaskId         string `json:"task_id"`
+	Title          string `json:"title"`
+	Link           string `json:"link"`
+	Status         uint8  `json:"status"`
+	ProcessPercent uint8  `json:"process_percent"`
+	FailReason     string `json:"fail_reason"`
+}
+
+type GetBatchSubtitleTaskResData struct {
+	BatchId            string           `json:"batch_id"`
+	Title              string           `json:"title"`
+	Status             uint8            `json:"status"` // 1-处理中,2-成功,3-失败,5-部分子任务失败
+	ProcessPercent     uint8            `json:"process_percent"`
+	FailReason         string           `json:"fail_reason"`
+	SuccessNum         int              `json:"success_num"` // 成功的子任务数
+	FailedNum          int              `json:"failed_num"`  // 失败的子任务数
+	Items              []*BatchTaskItem `json:"items"`
+	ArchiveDownloadUrl string           `json:"archive_download_url"`
+}
@@ -0,0 +1,8 @@
+package dto
+
+import "encoding/json"
+
+type SaveTaskPresetReq struct {
+	Name    string          `json:"name"`
+	Options json.RawMessage `json:"options"` // 与创建任务的请求字段相同，url和preset除外
+}
@@ -0,0 +1,30 @@
+package dto
+
+type GetUsageReq struct {
+	TaskId string `form:"taskId"` // 为空时汇总所有任务
+}
+
+type ProviderUsage struct {
+	Kind             string  `json:"kind"` // llm, transcribe, tts
+	Provider         string  `json:"provider"`
+	Calls            int     `json:"calls"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	AudioSeconds     float64 `json:"audio_seconds"`
+	TtsChars         int     `json:"tts_chars"`
+	Cost             float64 `json:"cost"`
+}
+
+type TaskUsage struct {
+	TaskId    string           `json:"task_id"`
+	Currency  string           `json:"currency"`
+	TotalCost float64          `json:"total_cost"`
+	Providers []*ProviderUsage `json:"providers"`
+}
+
+type GetUsageResData struct {
+	Currency  string           `json:"currency"`
+	TotalCost float64          `json:"total_cost"`
+	Providers []*ProviderUsage `json:"providers"` // 按提供商汇总
+	Tasks     []*TaskUsage     `json:"tasks"`
+}
@@ -33,8 +33,9 @@ type ConfigRequest struct {
 		Model   string `json:"model"`
 	} `json:"llm"`
 	Transcribe struct {
-		Provider              string `json:"provider"`
-		EnableGpuAcceleration bool   `json:"enableGpuAcceleration"`
+		Provider              string   `json:"provider"`
+		FallbackProviders     []string `json:"fallbackProviders"`
+		EnableGpuAcceleration bool     `json:"enableGpuAcceleration"`
 		Openai                struct {
 			BaseUrl string `json:"baseUrl"`
 			ApiKey  string `json:"apiKey"`
@@ -127,6 +128,7 @@ func (h Handler) GetConfig(c *gin.Context) {
 
 	// 转录配置
 	configResponse.Transcribe.Provider = config.Conf.Transcribe.Provider
+	configResponse.Transcribe.FallbackProviders = config.Conf.Transcribe.FallbackProviders
 	configResponse.Transcribe.EnableGpuAcceleration = config.Conf.Transcribe.EnableGpuAcceleration
 	configResponse.Transcribe.Openai.BaseUrl = config.Conf.Transcribe.Openai.BaseUrl
 	configResponse.Transcribe.Openai.ApiKey = config.Conf.Transcribe.Openai.ApiKey
@@ -201,6 +203,9 @@ func (h Handler) UpdateConfig(c *gin.Context) {
 
 	// 更新转录配置
 	config.Conf.Transcribe.Provider = req.Transcribe.Provider
+	if req.Transcribe.FallbackProviders != nil {
+		config.Conf.Transcribe.FallbackProviders = req.Transcribe.FallbackProviders
+	}
 	config.Conf.Transcribe.EnableGpuAcceleration = req.Transcribe.EnableGpuAcceleration
 	config.Conf.Transcribe.Openai.BaseUrl = req.Transcribe.Openai.BaseUrl
 	config.Conf.Transcribe.Openai.ApiKey = req.Transcribe.Openai.ApiKey
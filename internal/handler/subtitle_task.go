@@ -15,8 +15,9 @@ import (
 
 func (h Handler) StartSubtitleTask(c *gin.Context) {
 	var req dto.StartVideoSubtitleTaskReq
-	if err := c.ShouldBindJSON(&req); err != nil {
-		log.GetLogger().Error("StartSubtitleTask ShouldBindJSON err", zap.Error(err))
+	body, err := c.GetRawData()
+	if err != nil {
+		log.GetLogger().Error("StartSubtitleTask GetRawData err", zap.Error(err))
 		response.R(c, response.Response{
 			Error: -1,
 			Msg:   "参数错误",
@@ -35,6 +36,17 @@ func (h Handler) StartSubtitleTask(c *gin.Context) {
 
 	svc := h.Service
 
+	// 合并参数预设
+	if err = svc.ApplyTaskPreset(body, &req); err != nil {
+		log.GetLogger().Error("StartSubtitleTask ApplyTaskPreset err", zap.Error(err))
+		response.R(c, response.Response{
+			Error: -1,
+			Msg:   err.Error(),
+			Data:  nil,
+		})
+		return
+	}
+
 	data, err := svc.StartSubtitleTask(req)
 	if err != nil {
 		response.R(c, response.Response{
@@ -151,3 +163,160 @@ func (h Handler) DownloadFile(c *gin.Context) {
 	}
 	c.FileAttachment(localFilePath, filepath.Base(localFilePath))
 }
+
+func (h Handler) ResynthesizeTts(c *gin.Context) {
+	var req dto.TtsResynthesizeReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.GetLogger().Error("ResynthesizeTts ShouldBindJSON err", zap.Error(err))
+		response.R(c, response.Response{
+			Error: -1,
+			Msg:   "参数错误",
+			Data:  nil,
+		})
+		return
+	}
+
+	data, err := h.Service.ResynthesizeTts(req)
+	if err != nil {
+		response.R(c, response.Response{
+			Error: -1,
+			Msg:   err.Error(),
+			Data:  nil,
+		})
+		return
+	}
+	response.R(c, response.Response{
+		Error: 0,
+		Msg:   "成功",
+		Data:  data,
+	})
+}
+
+func (h Handler) GetSubtitleCues(c *gin.Context) {
+	var req dto.GetSubtitleCuesReq
+	if err := c.ShouldBindQuery(&req); err != nil {
+		response.R(c, response.Response{
+			Error: -1,
+			Msg:   "参数错误",
+			Data:  nil,
+		})
+		return
+	}
+
+	data, err := h.Service.GetSubtitleCues(req)
+	if err != nil {
+		response.R(c, response.Response{
+			Error: -1,
+			Msg:   err.Error(),
+			Data:  nil,
+		})
+		return
+	}
+	response.R(c, response.Response{
+		Error: 0,
+		Msg:   "成功",
+		Data:  data,
+	})
+}
+
+func (h Handler) UpdateSubtitleCues(c *gin.Context) {
+	var req dto.UpdateSubtitleCuesReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.GetLogger().Error("UpdateSubtitleCues ShouldBindJSON err", zap.Error(err))
+		response.R(c, response.Response{
+			Error: -1,
+			Msg:   "参数错误",
+			Data:  nil,
+		})
+		return
+	}
+
+	data, err := h.Service.UpdateSubtitleCues(req)
+	if err != nil {
+		response.R(c, response.Response{
+			Error: -1,
+			Msg:   err.Error(),
+			Data:  nil,
+		})
+		return
+	}
+	response.R(c, response.Response{
+		Error: 0,
+		Msg:   "成功",
+		Data:  data,
+	})
+}
+
+func (h Handler) StartBatchTask(c *gin.Context) {
+	var req dto.StartBatchSubtitleTaskReq
+	body, err := c.GetRawData()
+	if err != nil {
+		log.GetLogger().Error("StartBatchTask GetRawData err", zap.Error(err))
+		response.R(c, response.Response{
+			Error: -1,
+			Msg:   "参数错误",
+			Data:  nil,
+		})
+		return
+	}
+
+	// 检查配置是否需要重新初始化
+	if configUpdated {
+		log.GetLogger().Info("检测到配置更新，重新初始化服务")
+		deps.CheckDependency()
+		h.Service = service.NewService()
+		configUpdated = false
+	}
+
+	// 合并参数预设
+	if err = h.Service.ApplyTaskPreset(body, &req); err != nil {
+		log.GetLogger().Error("StartBatchTask ApplyTaskPreset err", zap.Error(err))
+		response.R(c, response.Response{
+			Error: -1,
+			Msg:   err.Error(),
+			Data:  nil,
+		})
+		return
+	}
+
+	data, err := h.Service.StartBatchTask(req)
+	if err != nil {
+		response.R(c, response.Response{
+			Error: -1,
+			Msg:   err.Error(),
+			Data:  nil,
+		})
+		return
+	}
+	response.R(c, response.Response{
+		Error: 0,
+		Msg:   "成功",
+		Data:  data,
+	})
+}
+
+func (h Handler) GetBatchTask(c *gin.Context) {
+	var req dto.GetBatchSubtitleTaskReq
+	if err := c.ShouldBindQuery(&req); err != nil {
+		response.R(c, response.Response{
+			Error: -1,
+			Msg:   "参数错误",
+			Data:  nil,
+		})
+		return
+	}
+	data, err := h.Service.GetBatchTaskStatus(req)
+	if err != nil {
+		response.R(c, response.Response{
+			Error: -1,
+			Msg:   err.Error(),
+			Data:  nil,
+		})
+		return
+	}
+	response.R(c, response.Response{
+		Error: 0,
+		Msg:   "成功",
+		Data:  data,
+	})
+}
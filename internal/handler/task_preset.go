@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"krillin-ai/internal/dto"
+	"krillin-ai/internal/response"
+	"krillin-ai/log"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+func (h Handler) ListTaskPresets(c *gin.Context) {
+	data, err := h.Service.ListTaskPresets()
+	if err != nil {
+		response.R(c, response.Response{
+			Error: -1,
+			Msg:   err.Error(),
+			Data:  nil,
+		})
+		return
+	}
+	response.R(c, response.Response{
+		Error: 0,
+		Msg:   "成功",
+		Data:  data,
+	})
+}
+
+func (h Handler) GetTaskPreset(c *gin.Context) {
+	data, err := h.Service.GetTaskPreset(c.Param("name"))
+	if err != nil {
+		response.R(c, response.Response{
+			Error: -1,
+			Msg:   err.Error(),
+			Data:  nil,
+		})
+		return
+	}
+	response.R(c, response.Response{
+		Error: 0,
+		Msg:   "成功",
+		Data:  data,
+	})
+}
+
+func (h Handler) SaveTaskPreset(c *gin.Context) {
+	var req dto.SaveTaskPresetReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.GetLogger().Error("SaveTaskPreset ShouldBindJSON err", zap.Error(err))
+		response.R(c, response.Response{
+			Error: -1,
+			Msg:   "参数错误",
+			Data:  nil,
+		})
+		return
+	}
+	if name := c.Param("name"); name != "" {
+		req.Name = name
+	}
+	data, err := h.Service.SaveTaskPreset(req)
+	if err != nil {
+		response.R(c, response.Response{
+			Error: -1,
+			Msg:   err.Error(),
+			Data:  nil,
+		})
+		return
+	}
+	response.R(c, response.Response{
+		Error: 0,
+		Msg:   "成功",
+		Data:  data,
+	})
+}
+
+func (h Handler) DeleteTaskPreset(c *gin.Context) {
+	if err := h.Service.DeleteTaskPreset(c.Param("name")); err != nil {
+		response.R(c, response.Response{
+			Error: -1,
+			Msg:   err.Error(),
+			Data:  nil,
+		})
+		return
+	}
+	response.R(c, response.Response{
+		Error: 0,
+		Msg:   "成功",
+		Data:  nil,
+	})
+}
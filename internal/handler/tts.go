@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"krillin-ai/internal/deps"
+	"krillin-ai/internal/dto"
+	"krillin-ai/internal/response"
+	"krillin-ai/internal/service"
+	"krillin-ai/log"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+func (h Handler) TtsPreview(c *gin.Context) {
+	var req dto.TtsPreviewReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.GetLogger().Error("TtsPreview ShouldBindJSON err", zap.Error(err))
+		response.R(c, response.Response{
+			Error: -1,
+			Msg:   "参数错误",
+			Data:  nil,
+		})
+		return
+	}
+
+	// 检查配置是否需要重新初始化
+	if configUpdated {
+		log.GetLogger().Info("检测到配置更新，重新初始化服务")
+		deps.CheckDependency()
+		h.Service = service.NewService()
+		configUpdated = false
+	}
+
+	data, err := h.Service.TtsPreview(req)
+	if err != nil {
+		response.R(c, response.Response{
+			Error: -1,
+			Msg:   err.Error(),
+			Data:  nil,
+		})
+		return
+	}
+	response.R(c, response.Response{
+		Error: 0,
+		Msg:   "成功",
+		Data:  data,
+	})
+}
+
+func (h Handler) ListClonedVoices(c *gin.Context) {
+	data, err := h.Service.ListClonedVoices()
+	if err != nil {
+		response.R(c, response.Response{
+			Error: -1,
+			Msg:   err.Error(),
+			Data:  nil,
+		})
+		return
+	}
+	response.R(c, response.Response{
+		Error: 0,
+		Msg:   "成功",
+		Data:  data,
+	})
+}
@@ -0,0 +1,34 @@
+package handler
+
+import (
+	"krillin-ai/internal/dto"
+	"krillin-ai/internal/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (h Handler) GetUsage(c *gin.Context) {
+	var req dto.GetUsageReq
+	if err := c.ShouldBindQuery(&req); err != nil {
+		response.R(c, response.Response{
+			Error: -1,
+			Msg:   "参数错误",
+			Data:  nil,
+		})
+		return
+	}
+	data, err := h.Service.GetUsage(req)
+	if err != nil {
+		response.R(c, response.Response{
+			Error: -1,
+			Msg:   err.Error(),
+			Data:  nil,
+		})
+		return
+	}
+	response.R(c, response.Response{
+		Error: 0,
+		Msg:   "成功",
+		Data:  data,
+	})
+}
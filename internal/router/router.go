@@ -15,11 +15,24 @@ func SetupRouter(r *gin.Engine) {
 	{
 		api.POST("/capability/subtitleTask", hdl.StartSubtitleTask)
 		api.GET("/capability/subtitleTask", hdl.GetSubtitleTask)
+		api.POST("/capability/subtitleTask/tts/resynthesize", hdl.ResynthesizeTts)
+		api.GET("/capability/subtitleTask/cues", hdl.GetSubtitleCues)
+		api.POST("/capability/subtitleTask/cues", hdl.UpdateSubtitleCues)
+		api.POST("/capability/batchTask", hdl.StartBatchTask)
+		api.GET("/capability/batchTask", hdl.GetBatchTask)
+		api.GET("/usage", hdl.GetUsage)
+		api.GET("/presets", hdl.ListTaskPresets)
+		api.GET("/presets/:name", hdl.GetTaskPreset)
+		api.POST("/presets", hdl.SaveTaskPreset)
+		api.PUT("/presets/:name", hdl.SaveTaskPreset)
+		api.DELETE("/presets/:name", hdl.DeleteTaskPreset)
 		api.POST("/file", hdl.UploadFile)
 		api.GET("/file/*filepath", hdl.DownloadFile)
 		api.HEAD("/file/*filepath", hdl.DownloadFile)
 		api.GET("/config", hdl.GetConfig)
 		api.POST("/config", hdl.UpdateConfig)
+		api.POST("/tts/preview", hdl.TtsPreview)
+		api.GET("/tts/voices", hdl.ListClonedVoices)
 	}
 
 	r.GET("/", func(c *gin.Context) {
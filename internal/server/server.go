@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"krillin-ai/config"
 	"krillin-ai/internal/router"
+	"krillin-ai/internal/service"
 	"krillin-ai/log"
 	"net/http"
 
@@ -14,10 +15,22 @@ import (
 
 var BackEnd *http.Server
 
+var stopWatchFolders context.CancelFunc
+
 func StartBackend() error {
 	gin.SetMode(gin.ReleaseMode)
 	engine := gin.Default()
 	router.SetupRouter(engine)
+
+	// 监控文件夹，未开启时只做空轮询
+	var watchCtx context.Context
+	watchCtx, stopWatchFolders = context.WithCancel(context.Background())
+	if svc := service.NewService(); svc != nil {
+		go svc.WatchFolders(watchCtx)
+	} else {
+		log.GetLogger().Error("创建服务失败，不监控文件夹")
+	}
+
 	BackEnd = &http.Server{
 		Addr: fmt.Sprintf("%s:%d", config.Conf.Server.Host, config.Conf.Server.Port),
 		Handler: engine,
@@ -34,6 +47,10 @@ func StartBackend() error {
 }
 
 func StopBackend() error {
+	if stopWatchFolders != nil {
+		stopWatchFolders()
+		stopWatchFolders = nil
+	}
 	if BackEnd == nil {
 		return nil
 	}
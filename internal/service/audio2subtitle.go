@@ -38,6 +38,10 @@ func (s Service) audioToSubtitle(ctx context.Context, stepParam *types.SubtitleT
 	if err != nil {
 		return fmt.Errorf("audioToSubtitle splitSrt error: %w", err)
 	}
+	err = s.checkSubtitleQuality(stepParam)
+	if err != nil {
+		return fmt.Errorf("audioToSubtitle checkSubtitleQuality error: %w", err)
+	}
 	// 更新字幕任务信息
 	stepParam.TaskPtr.ProcessPct = 95
 	return nil
@@ -89,7 +93,38 @@ func (s Service) audioToSubtitle(ctx context.Context, stepParam *types.SubtitleT
 //	return nil
 //}
 
-func (s Service) transcribeAudio(id int, audioFilePath string, language string, taskBasePath string) (transcriptionData *types.TranscriptionData, err error) {
+// transcribeWithFallback 依次使用各转录提供商，每个提供商重试TranscribeMaxAttempts次仍失败后切换到下一个
+func (s Service) transcribeWithFallback(id int, audioFilePath string, language string, taskBasePath string) (*types.TranscriptionData, error) {
+	transcribers := s.Transcribers
+	if len(transcribers) == 0 {
+		transcribers = []NamedTranscriber{{Provider: config.Conf.Transcribe.Provider, Transcriber: s.Transcriber}}
+	}
+	var err error
+	for i, named := range transcribers {
+		var transcriptionData *types.TranscriptionData
+		for range config.Conf.App.TranscribeMaxAttempts {
+			transcriptionData, err = s.transcribeAudio(named.Transcriber, named.Provider, id, audioFilePath, language, taskBasePath)
+			if err == nil {
+				duration, durationErr := util.GetAudioDuration(audioFilePath)
+				if durationErr != nil {
+					log.GetLogger().Warn("audioToSubtitle get audio duration for usage error", zap.String("audio", audioFilePath), zap.Error(durationErr))
+				}
+				recordUsage(s.usage, types.ProviderUsage{Kind: types.UsageKindTranscribe, Provider: named.Provider, Calls: 1, AudioSeconds: duration})
+				return transcriptionData, nil
+			}
+		}
+		if i < len(transcribers)-1 {
+			log.GetLogger().Warn("audioToSubtitle 转录提供商重试失败，切换到下一个提供商",
+				zap.Int("splitId", id),
+				zap.String("provider", named.Provider),
+				zap.String("next", transcribers[i+1].Provider),
+				zap.Error(err))
+		}
+	}
+	return nil, err
+}
+
+func (s Service) transcribeAudio(transcriber types.Transcriber, provider string, id int, audioFilePath string, language string, taskBasePath string) (transcriptionData *types.TranscriptionData, err error) {
 	defer func() {
 		if r := recover(); r != nil {
 			err = fmt.Errorf("audioToSubtitle transcribeAudio panic recovered: %v", r)
@@ -99,11 +134,12 @@ func (s Service) transcribeAudio(id int, audioFilePath string, language string,
 	if language == "zh_cn" {
 		language = "zh" // 切换一下
 	}
-	transcriptionData, err = s.Transcriber.Transcription(audioFilePath, language, taskBasePath)
+	transcriptionData, err = transcriber.Transcription(audioFilePath, language, taskBasePath)
 
 	if err != nil {
-		return nil, fmt.Errorf("audioToSubtitle transcribeAudio Transcription err: %w", err)
+		return nil, fmt.Errorf("audioToSubtitle transcribeAudio %s Transcription err: %w", provider, err)
 	}
+	transcriptionData.Provider = provider
 
 	_ = util.SaveToDisk(transcriptionData, filepath.Join(taskBasePath, fmt.Sprintf(types.SubtitleTaskAudioTranscriptionDataPersistenceFileNamePattern, id)))
 
@@ -227,7 +263,7 @@ func (s Service) splitTextAndTranslateV2(basePath, inputText string, originLang,
 
 			prompt := fmt.Sprintf(types.SplitTextWithContextPrompt, types.GetStandardLanguageName(targetLang), previousSentences, originText, nextSentences)
 
-			translatedText, err := s.ChatCompleter.ChatCompletion(prompt)
+			translatedText, err := s.chatCompleter(types.LlmRoleTranslate).ChatCompletion(prompt)
 			if err != nil {
 				log.GetLogger().Error("splitTextAndTranslateV2 llm translate error", zap.Error(err), zap.Any("original text", originText))
 				results[index] = &TranslatedItem{
@@ -356,16 +392,11 @@ func (s Service) audioToSrt(ctx context.Context, stepParam *types.SubtitleTaskSt
 					)
 					log.GetLogger().Info("Begin transcribe", zap.Any("taskId", stepParam.TaskId), zap.Any("splitId", audioFileItem.Id))
 					// 语音转文字
-					for range config.Conf.App.TranscribeMaxAttempts {
-						transcriptionData, err = s.transcribeAudio(audioFileItem.Id, audioFileItem.Data, string(stepParam.OriginLanguage), stepParam.TaskBasePath)
-						if err == nil {
-							break
-						}
-					}
+					transcriptionData, err = s.transcribeWithFallback(audioFileItem.Id, audioFileItem.Data, string(stepParam.OriginLanguage), stepParam.TaskBasePath)
 					if err != nil {
 						return fmt.Errorf("audioToSubtitle audioToSrt Transcription err: %w", err)
 					}
-					log.GetLogger().Info("Transcribe completed", zap.Any("taskId", stepParam.TaskId), zap.Any("splitId", audioFileItem.Id))
+					log.GetLogger().Info("Transcribe completed", zap.Any("taskId", stepParam.TaskId), zap.Any("splitId", audioFileItem.Id), zap.String("provider", transcriptionData.Provider))
 
 					// 发送转录结果
 					transcribedQueue <- DataWithId[*types.TranscriptionData]{
@@ -500,7 +531,9 @@ func (s Service) audioToSrt(ctx context.Context, stepParam *types.SubtitleTaskSt
 
 				segmentIdx := translatedItems.Id
 
-				err = generateSrtWithTimestamps(srtBlocks, timePoints[segmentIdx], audioSegments[segmentIdx].TranscriptionData.Words, segmentIdx, stepParam)
+				// 启用强制对齐时用对齐结果替代转录的时间戳
+				aligned := s.alignSegment(ctx, audioSegments[segmentIdx].AudioFile, srtBlocks, stepParam)
+				err = generateSrtWithTimestamps(srtBlocks, timePoints[segmentIdx], audioSegments[segmentIdx].TranscriptionData.Words, aligned, segmentIdx, stepParam)
 				if err != nil {
 					return fmt.Errorf("audioToSubtitle audioToSrt generateTimestamps err: %w", err)
 				}
@@ -588,9 +621,8 @@ func (s Service) audioToSrt(ctx context.Context, stepParam *types.SubtitleTaskSt
 	return nil
 }
 
-func splitSrt(stepParam *types.SubtitleTaskStepParam) error {
-	log.GetLogger().Info("audioToSubtitle.splitSrt start", zap.Any("task id", stepParam.TaskId))
-
+// writeSplitSrtFiles 把双语字幕拆分为原语言、目标语言的单语字幕和文稿
+func writeSplitSrtFiles(stepParam *types.SubtitleTaskStepParam) error {
 	originLanguageSrtFilePath := filepath.Join(stepParam.TaskBasePath, types.SubtitleTaskOriginLanguageSrtFileName)
 	originLanguageTextFilePath := filepath.Join(stepParam.TaskBasePath, "output", types.SubtitleTaskOriginLanguageTextFileName)
 	targetLanguageSrtFilePath := filepath.Join(stepParam.TaskBasePath, types.SubtitleTaskTargetLanguageSrtFileName)
@@ -658,6 +690,17 @@ func splitSrt(stepParam *types.SubtitleTaskStepParam) error {
 		log.GetLogger().Error("audioToSubtitle splitSrt scan bilingual srt file error", zap.Any("taskId", stepParam.TaskId), zap.Error(err))
 		return fmt.Errorf("audioToSubtitle splitSrt scan bilingual srt file error: %w", err)
 	}
+	return nil
+}
+
+func splitSrt(stepParam *types.SubtitleTaskStepParam) error {
+	log.GetLogger().Info("audioToSubtitle.splitSrt start", zap.Any("task id", stepParam.TaskId))
+
+	if err := writeSplitSrtFiles(stepParam); err != nil {
+		return err
+	}
+	originLanguageSrtFilePath := filepath.Join(stepParam.TaskBasePath, types.SubtitleTaskOriginLanguageSrtFileName)
+	targetLanguageSrtFilePath := filepath.Join(stepParam.TaskBasePath, types.SubtitleTaskTargetLanguageSrtFileName)
 	// 添加原语言单语字幕
 	subtitleInfo := types.SubtitleFileInfo{
 		Path:               originLanguageSrtFilePath,
@@ -703,379 +746,54 @@ func splitSrt(stepParam *types.SubtitleTaskStepParam) error {
 	return nil
 }
 
-func getSentenceTimestamps(words []types.Word, sentence string, lastTs float64, language types.StandardLanguageCode) (types.SrtSentence, []types.Word, float64, error) {
-	var srtSt types.SrtSentence
-	var sentenceWordList []string
-	sentenceWords := make([]types.Word, 0)
-	if language == types.LanguageNameEnglish || language == types.LanguageNameGerman || language == types.LanguageNameTurkish || language == types.LanguageNameRussian { // 处理方式不同
-		sentenceWordList = util.SplitSentence(sentence)
-		if len(sentenceWordList) == 0 {
-			return srtSt, sentenceWords, 0, fmt.Errorf("getSentenceTimestamps sentence is empty")
-		}
-
-		thisLastTs := lastTs
-		sentenceWordIndex := 0
-		wordNow := words[sentenceWordIndex]
-		for _, sentenceWord := range sentenceWordList {
-			for sentenceWordIndex < len(words) {
-				for sentenceWordIndex < len(words) && !strings.EqualFold(words[sentenceWordIndex].Text, sentenceWord) {
-					sentenceWordIndex++
-				}
-
-				if sentenceWordIndex >= len(words) {
-					break
-				}
-
-				wordNow = words[sentenceWordIndex]
-				if wordNow.Start < thisLastTs {
-					sentenceWordIndex++
-					continue
-				} else {
-					break
-				}
-			}
-
-			if sentenceWordIndex >= len(words) {
-				sentenceWords = append(sentenceWords, types.Word{
-					Text: sentenceWord,
-				})
-				sentenceWordIndex = 0
-				continue
-			}
-
-			sentenceWords = append(sentenceWords, wordNow)
-			sentenceWordIndex = 0
-		}
-		beginWordIndex, endWordIndex := findMaxIncreasingSubArray(sentenceWords)
-		if (endWordIndex - beginWordIndex) == 0 {
-			return srtSt, sentenceWords, 0, errors.New("getSentenceTimestamps no valid sentence")
-		}
-
-		// 找到最大连续子数组后，再去找整个句子开始和结束的时间戳
-		beginWord := sentenceWords[beginWordIndex]
-		endWord := sentenceWords[endWordIndex-1]
-		if endWordIndex-beginWordIndex == len(sentenceWords) {
-			srtSt.Start = beginWord.Start
-			srtSt.End = endWord.End
-			thisLastTs = endWord.End
-			return srtSt, sentenceWords, thisLastTs, nil
-		}
-
-		if beginWordIndex > 0 {
-			for i, j := beginWordIndex-1, beginWord.Num-1; i >= 0 && j >= 0; {
-				if words[j].Text == "" {
-					j--
-					continue
-				}
-				if strings.EqualFold(words[j].Text, sentenceWords[i].Text) {
-					beginWord = words[j]
-					sentenceWords[i] = beginWord
-				} else {
-					break
-				}
-
-				i--
-				j--
-			}
-		}
-
-		if endWordIndex < len(sentenceWords) {
-			for i, j := endWordIndex, endWord.Num+1; i < len(sentenceWords) && j < len(words); {
-				if words[j].Text == "" {
-					j++
-					continue
-				}
-				if strings.EqualFold(words[j].Text, sentenceWords[i].Text) {
-					endWord = words[j]
-					sentenceWords[i] = endWord
-				} else {
-					break
-				}
-
-				i++
-				j++
-			}
-		}
-
-		if beginWord.Num > sentenceWords[0].Num && beginWord.Num-sentenceWords[0].Num < 10 {
-			beginWord = sentenceWords[0]
-		}
-
-		if sentenceWords[len(sentenceWords)-1].Num > endWord.Num && sentenceWords[len(sentenceWords)-1].Num-endWord.Num < 10 {
-			endWord = sentenceWords[len(sentenceWords)-1]
-		}
-
-		srtSt.Start = beginWord.Start
-		if srtSt.Start < thisLastTs {
-			srtSt.Start = thisLastTs
-		}
-		srtSt.End = endWord.End
-		if beginWord.Num != endWord.Num && endWord.End > thisLastTs {
-			thisLastTs = endWord.End
-		}
-
-		return srtSt, sentenceWords, thisLastTs, nil
-	} else {
-		sentenceWordList = strings.Split(util.GetRecognizableString(sentence), "")
-		if len(sentenceWordList) == 0 {
-			return srtSt, sentenceWords, 0, errors.New("getSentenceTimestamps sentence is empty")
-		}
-
-		// 这里的sentence words不是字面上连续的，而是可能有重复，可读连续的用下面的readable
-		var readableSentenceWords []types.Word
-		thisLastTs := lastTs
-		sentenceWordIndex := 0
-		wordNow := words[sentenceWordIndex]
-		for _, sentenceWord := range sentenceWordList {
-			for sentenceWordIndex < len(words) {
-				if !strings.EqualFold(words[sentenceWordIndex].Text, sentenceWord) && !strings.HasPrefix(words[sentenceWordIndex].Text, sentenceWord) {
-					sentenceWordIndex++
-				} else {
-					wordNow = words[sentenceWordIndex]
-					if wordNow.Start >= thisLastTs {
-						// 记录下来，但还要继续往后找
-						sentenceWords = append(sentenceWords, wordNow)
-					}
-					sentenceWordIndex++
-				}
-			}
-			// 当前sentenceWord已经找完了
-			sentenceWordIndex = 0
-
-		}
-		// 对于sentence每个词，已经尝试找到了它的[]Word
-		var beginWordIndex, endWordIndex int
-		beginWordIndex, endWordIndex, readableSentenceWords = jumpFindMaxIncreasingSubArray(sentenceWords)
-		if (endWordIndex - beginWordIndex) == 0 {
-			return srtSt, readableSentenceWords, 0, errors.New("getSentenceTimestamps no valid sentence")
-		}
-
-		beginWord := sentenceWords[beginWordIndex]
-		endWord := sentenceWords[endWordIndex]
-		//sequence := util.FindClosestConsecutiveWords(words, sentence)
-		//beginWord := sequence[0]
-		//endWord := sequence[len(sequence)-1]
-
-		srtSt.Start = beginWord.Start
-		if srtSt.Start < thisLastTs {
-			srtSt.Start = thisLastTs
-		}
-		srtSt.End = endWord.End
-		if beginWord.Num != endWord.Num && endWord.End > thisLastTs {
-			thisLastTs = endWord.End
-		}
-
-		return srtSt, readableSentenceWords, thisLastTs, nil
-	}
-}
-
-// 找到 Num 值递增的最大连续子数组
-func findMaxIncreasingSubArray(words []types.Word) (int, int) {
-	if len(words) == 0 {
-		return 0, 0
-	}
-
-	// 用于记录当前最大递增子数组的起始索引和长度
-	maxStart, maxLen := 0, 1
-	// 用于记录当前递增子数组的起始索引和长度
-	currStart, currLen := 0, 1
-
-	for i := 1; i < len(words); i++ {
-		if words[i].Num == words[i-1].Num+1 {
-			// 当前元素比前一个元素大，递增序列继续
-			currLen++
-		} else {
-			// 递增序列结束，检查是否是最长的递增序列
-			if currLen > maxLen {
-				maxStart = currStart
-				maxLen = currLen
-			}
-			// 重新开始新的递增序列
-			currStart = i
-			currLen = 1
-		}
-	}
-
-	// 最后需要再检查一次，因为最大递增子数组可能在数组的末尾
-	if currLen > maxLen {
-		maxStart = currStart
-		maxLen = currLen
-	}
-
-	// 返回最大递增子数组
-	return maxStart, maxStart + maxLen
-}
-
-// 跳跃（非连续）找到 Num 值递增的最大子数组
-func jumpFindMaxIncreasingSubArray(words []types.Word) (int, int, []types.Word) {
-	if len(words) == 0 {
-		return -1, -1, nil
-	}
-
-	if len(words) == 1 {
-		return 0, 0, words
-	}
-
-	// dp[i] 表示以 words[i] 结束的递增子数组的长度
-	dp := make([]int, len(words))
-	// prev[i] 用来记录与当前递增子数组相连的前一个元素的索引
-	prev := make([]int, len(words))
-
-	// 初始化，所有的 dp[i] 都是 1，因为每个元素本身就是一个长度为 1 的子数组
-	for i := range len(words) {
-		dp[i] = 1
-		prev[i] = -1
-	}
-
-	maxLen := 0
-	startIdx := -1
-	endIdx := -1
-
-	// 遍历每一个元素
-	for i := 1; i < len(words); i++ {
-		// 对比每个元素与之前的元素，检查是否可以构成递增子数组
-		for j := 0; j < i; j++ {
-			if words[i].Num == words[j].Num+1 {
-				if dp[i] < dp[j]+1 {
-					dp[i] = dp[j] + 1
-					prev[i] = j
-				}
-			}
-		}
-
-		// 更新最大子数组长度和索引
-		if dp[i] > maxLen {
-			maxLen = dp[i]
-			endIdx = i
-		}
-	}
-
-	// 如果未找到递增子数组，直接返回
-	if endIdx == -1 {
-		return -1, -1, nil
-	}
-
-	// 回溯找到子数组的起始索引
-	startIdx = endIdx
-	for prev[startIdx] != -1 {
-		startIdx = prev[startIdx]
-	}
-
-	// 构造结果子数组
-	result := make([]types.Word, 0, maxLen)
-	current := endIdx
-	for current != -1 {
-		result = append(result, words[current])
-		current = prev[current]
-	}
-
-	// 由于是从后往前构造的子数组，需要反转
-	for i, j := 0, len(result)-1; i < j; i, j = i+1, j-1 {
-		result[i], result[j] = result[j], result[i]
-	}
-
-	return startIdx, endIdx, result
-}
-
-func generateSrtWithTimestamps(srtBlocks []*util.SrtBlock, tsOffset float64, words []types.Word, segmentIdx int, stepParam *types.SubtitleTaskStepParam) error {
-	if len(srtBlocks) == 0 || len(words) == 0 {
+// generateSrtWithTimestamps 生成一个片段带时间戳的字幕，aligned不为空时与srtBlocks一一对应，有对齐结果的句子优先使用
+func generateSrtWithTimestamps(srtBlocks []*util.SrtBlock, tsOffset float64, words []types.Word, aligned []*types.AlignedSentence, segmentIdx int, stepParam *types.SubtitleTaskStepParam) error {
+	if len(srtBlocks) == 0 || (len(words) == 0 && aligned == nil) {
 		return nil
 	}
 
 	// 获取每个字幕块的时间戳
 	var lastTs float64
 	shortOriginSrtMap := make(map[int][]util.SrtBlock, 0)
-	for _, srtBlock := range srtBlocks {
+	layout := newSubtitleLayout(stepParam.MaxWordOneLine)
+	sep := wordSeparator(stepParam.OriginLanguage)
+	for i, srtBlock := range srtBlocks {
 		if srtBlock.OriginLanguageSentence == "" {
 			continue
 		}
-		sentenceTs, sentenceWords, ts, err := getSentenceTimestamps(words, srtBlock.OriginLanguageSentence, lastTs, stepParam.OriginLanguage)
-		if err != nil || ts < lastTs {
-			continue
-		}
-		srtBlock.Timestamp = fmt.Sprintf("%s --> %s", util.FormatTime(float32(sentenceTs.Start+tsOffset)), util.FormatTime(float32(sentenceTs.End+tsOffset)))
-
-		// 生成短句子的英文字幕
 		var (
-			originSentence string
-			startWord      types.Word
-			endWord        types.Word
+			sentenceTs    types.SrtSentence
+			sentenceWords []types.Word
+			ts            float64
+			err           error
 		)
-
-		if len(sentenceWords) <= stepParam.MaxWordOneLine {
-			shortOriginSrtMap[srtBlock.Index] = append(shortOriginSrtMap[srtBlock.Index], util.SrtBlock{
-				Index:                  srtBlock.Index,
-				Timestamp:              fmt.Sprintf("%s --> %s", util.FormatTime(float32(sentenceTs.Start+tsOffset)), util.FormatTime(float32(sentenceTs.End+tsOffset))),
-				OriginLanguageSentence: srtBlock.OriginLanguageSentence,
-			})
-			lastTs = ts
-			continue
+		if aligned != nil && aligned[i] != nil {
+			sentenceTs, sentenceWords, ts, err = alignedSentenceTimestamps(*aligned[i], srtBlock.OriginLanguageSentence, lastTs, stepParam.OriginLanguage)
 		}
-
-		thisLineWord := stepParam.MaxWordOneLine
-		if len(sentenceWords) > stepParam.MaxWordOneLine && len(sentenceWords) <= 2*stepParam.MaxWordOneLine {
-			thisLineWord = len(sentenceWords)/2 + 1
-		} else if len(sentenceWords) > 2*stepParam.MaxWordOneLine && len(sentenceWords) <= 3*stepParam.MaxWordOneLine {
-			thisLineWord = len(sentenceWords)/3 + 1
-		} else if len(sentenceWords) > 3*stepParam.MaxWordOneLine && len(sentenceWords) <= 4*stepParam.MaxWordOneLine {
-			thisLineWord = len(sentenceWords)/4 + 1
-		} else if len(sentenceWords) > 4*stepParam.MaxWordOneLine && len(sentenceWords) <= 5*stepParam.MaxWordOneLine {
-			thisLineWord = len(sentenceWords)/5 + 1
+		if sentenceWords == nil {
+			sentenceTs, sentenceWords, ts, err = getSentenceTimestamps(words, srtBlock.OriginLanguageSentence, lastTs, stepParam.OriginLanguage)
 		}
+		if err != nil || ts < lastTs {
+			continue
+		}
+		srtBlock.Timestamp = fmt.Sprintf("%s --> %s", util.FormatTime(float32(sentenceTs.Start+tsOffset)), util.FormatTime(float32(sentenceTs.End+tsOffset)))
 
-		i := 1
-		nextStart := true
+		// 按排版限制把原文拆成短字幕，每条的时间取自词的时间戳
+		cueWords := make([]types.Word, 0, len(sentenceWords))
+		wordStart := max(lastTs, sentenceTs.Start)
 		for _, word := range sentenceWords {
-			if nextStart {
-				startWord = word
-				if startWord.Start < lastTs {
-					startWord.Start = lastTs
-				}
-				if startWord.Start < endWord.End {
-					startWord.Start = endWord.End
-				}
-
-				if startWord.Start < sentenceTs.Start {
-					startWord.Start = sentenceTs.Start
-				}
-				// 首个单词的开始时间戳大于句子的结束时间戳，说明这个单词找错了，放弃掉
-				if startWord.End > sentenceTs.End {
-					originSentence += word.Text + " "
-					continue
-				}
-				originSentence += word.Text + " "
-				endWord = startWord
-				i++
-				nextStart = false
-				continue
-			}
-
-			originSentence += word.Text + " "
-			if endWord.End < word.End {
-				endWord = word
-			}
-
-			if endWord.End > sentenceTs.End {
-				endWord.End = sentenceTs.End
-			}
-
-			if i%thisLineWord == 0 && i > 1 {
-				shortOriginSrtMap[srtBlock.Index] = append(shortOriginSrtMap[srtBlock.Index], util.SrtBlock{
-					Index:                  srtBlock.Index,
-					Timestamp:              fmt.Sprintf("%s --> %s", util.FormatTime(float32(startWord.Start+tsOffset)), util.FormatTime(float32(endWord.End+tsOffset))),
-					OriginLanguageSentence: originSentence,
-				})
-				originSentence = ""
-				nextStart = true
-			}
-			i++
+			word.Start = min(max(word.Start, wordStart), sentenceTs.End)
+			word.End = min(max(word.End, word.Start), sentenceTs.End)
+			wordStart = word.End
+			cueWords = append(cueWords, word)
 		}
-
-		if originSentence != "" {
+		cues := layout.layoutWords(cueWords, sep)
+		layout.fitTiming(cues, sentenceTs.End)
+		for _, cue := range cues {
 			shortOriginSrtMap[srtBlock.Index] = append(shortOriginSrtMap[srtBlock.Index], util.SrtBlock{
 				Index:                  srtBlock.Index,
-				Timestamp:              fmt.Sprintf("%s --> %s", util.FormatTime(float32(startWord.Start+tsOffset)), util.FormatTime(float32(endWord.End+tsOffset))),
-				OriginLanguageSentence: originSentence,
+				Timestamp:              fmt.Sprintf("%s --> %s", util.FormatTime(float32(cue.start+tsOffset)), util.FormatTime(float32(cue.end+tsOffset))),
+				OriginLanguageSentence: cue.text(),
 			})
 		}
 		lastTs = ts
@@ -1284,7 +1002,7 @@ func (s Service) splitTranslateItem(items []*TranslatedItem) ([]*TranslatedItem,
 func (s Service) splitLongSentence(item *TranslatedItem) ([]*TranslatedItem, error) {
 	prompt := fmt.Sprintf(types.SplitLongSentencePrompt, item.OriginText, item.TranslatedText)
 
-	response, err := s.ChatCompleter.ChatCompletion(prompt)
+	response, err := s.jsonChatCompleter(types.LlmRoleSplit, types.SplitLongSentenceSchema).ChatCompletion(prompt)
 	if err != nil {
 		return nil, fmt.Errorf("chat completion error: %w", err)
 	}
@@ -1320,7 +1038,7 @@ func (s Service) splitOriginLongSentence(sentence string) ([]string, error) {
 	shortSentences := make([]string, 0)
 	// 尝试调用3次
 	for i := range 3 {
-		response, err = s.ChatCompleter.ChatCompletion(prompt)
+		response, err = s.jsonChatCompleter(types.LlmRoleSplit, types.SplitOriginLongSentenceSchema).ChatCompletion(prompt)
 		if err != nil {
 			log.GetLogger().Error("splitOriginLongSentence chat completion error", zap.Error(err), zap.String("sentence", sentence), zap.Any("time", i))
 			continue
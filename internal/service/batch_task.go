@@ -0,0 +1,214 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"krillin-ai/internal/dto"
+	"krillin-ai/internal/storage"
+	"krillin-ai/internal/types"
+	"krillin-ai/log"
+	"krillin-ai/pkg/source"
+	"krillin-ai/pkg/util"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// StartBatchTask 把播放列表、合集或频道展开为多个字幕任务，子任务共用请求中的参数，依次处理
+func (s Service) StartBatchTask(req dto.StartBatchSubtitleTaskReq) (*dto.StartBatchSubtitleTaskResData, error) {
+	if !strings.HasPrefix(req.Url, "http://") && !strings.HasPrefix(req.Url, "https://") {
+		return nil, errors.New("链接不合法")
+	}
+	if req.MaxItems < 0 {
+		return nil, errors.New("max_items不能小于0")
+	}
+	batchId := "batch_" + util.GenerateRandStringWithUpperLowerNum(8)
+	batchPtr := &types.BatchTask{
+		BatchId:    batchId,
+		Link:       req.Url,
+		Status:     types.SubtitleTaskStatusProcessing,
+		CreateTime: time.Now().Unix(),
+	}
+	storage.BatchTasks.Store(batchId, batchPtr)
+
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				const size = 64 << 10
+				buf := make([]byte, size)
+				buf = buf[:runtime.Stack(buf, false)]
+				log.GetLogger().Error("batch task panic", zap.Any("panic:", r), zap.Any("stack:", buf))
+				batchPtr.Update(func(b *types.BatchTask) {
+					b.Status = types.SubtitleTaskStatusFailed
+					b.FailReason = fmt.Sprintf("batch task panic: %v", r)
+				})
+			}
+		}()
+		if err := s.runBatchTask(req, batchPtr); err != nil {
+			log.GetLogger().Error("StartBatchTask runBatchTask err", zap.Any("req", req), zap.Error(err))
+			batchPtr.Update(func(b *types.BatchTask) {
+				b.Status = types.SubtitleTaskStatusFailed
+				b.FailReason = err.Error()
+			})
+		}
+	}()
+
+	return &dto.StartBatchSubtitleTaskResData{BatchId: batchId}, nil
+}
+
+func (s Service) runBatchTask(req dto.StartBatchSubtitleTaskReq, batchPtr *types.BatchTask) error {
+	playlist, err := source.ExpandPlaylist(context.Background(), req.Url, req.MaxItems)
+	if err != nil {
+		return fmt.Errorf("runBatchTask ExpandPlaylist err: %w", err)
+	}
+	batchPtr.Update(func(b *types.BatchTask) { b.Title = playlist.Title })
+	log.GetLogger().Info("runBatchTask 播放列表展开完成", zap.String("batch id", batchPtr.BatchId), zap.Int("count", len(playlist.Entries)))
+
+	// 先创建所有子任务，便于查询整体进度
+	childReqs := make([]dto.StartVideoSubtitleTaskReq, 0, len(playlist.Entries))
+	stepParams := make([]*types.SubtitleTaskStepParam, 0, len(playlist.Entries))
+	for _, entry := range playlist.Entries {
+		childReq := req.StartVideoSubtitleTaskReq
+		childReq.Url = entry.Link
+		stepParam, err := s.newSubtitleTask(childReq)
+		if err != nil {
+			log.GetLogger().Error("runBatchTask newSubtitleTask err", zap.String("link", entry.Link), zap.Error(err))
+			continue
+		}
+		stepParam.TaskPtr.Status = types.SubtitleTaskStatusPending
+		stepParam.TaskPtr.Title = entry.Title
+		childReqs = append(childReqs, childReq)
+		stepParams = append(stepParams, stepParam)
+		batchPtr.Update(func(b *types.BatchTask) { b.TaskIds = append(b.TaskIds, stepParam.TaskId) })
+	}
+	if len(stepParams) == 0 {
+		return errors.New("runBatchTask no task created")
+	}
+
+	// 子任务依次执行，避免同时占满转录、翻译和配音的额度
+	successCount := 0
+	for i, stepParam := range stepParams {
+		stepParam.TaskPtr.Status = types.SubtitleTaskStatusProcessing
+		s.runSubtitleTask(childReqs[i], stepParam)
+		if stepParam.TaskPtr.Status == types.SubtitleTaskStatusSuccess {
+			successCount++
+		}
+	}
+	if successCount == 0 {
+		return errors.New("所有子任务均失败")
+	}
+
+	archivePath, err := archiveBatchTask(batchPtr.BatchId, stepParams)
+	if err != nil {
+		log.GetLogger().Error("runBatchTask archiveBatchTask err", zap.String("batch id", batchPtr.BatchId), zap.Error(err))
+	}
+	batchPtr.Update(func(b *types.BatchTask) {
+		if err == nil {
+			b.ArchiveDownloadUrl = "/api/file/" + archivePath
+		}
+		b.Status = types.SubtitleTaskStatusSuccess
+		if failedCount := len(stepParams) - successCount; failedCount > 0 {
+			b.Status = types.BatchTaskStatusPartialSuccess
+			b.FailReason = fmt.Sprintf("%d/%d个子任务失败", failedCount, len(stepParams))
+		}
+	})
+	log.GetLogger().Info("runBatchTask end", zap.String("batch id", batchPtr.BatchId), zap.Int("success", successCount), zap.Int("total", len(stepParams)))
+	return nil
+}
+
+// archiveBatchTask 把成功的子任务的字幕、配音和视频打包，每个视频一个目录
+func archiveBatchTask(batchId string, stepParams []*types.SubtitleTaskStepParam) (string, error) {
+	files := make(map[string]string)
+	for i, stepParam := range stepParams {
+		taskPtr := stepParam.TaskPtr
+		if taskPtr.Status != types.SubtitleTaskStatusSuccess {
+			continue
+		}
+		dirName := fmt.Sprintf("%03d_%s", i+1, util.SanitizePathName(taskPtr.Title))
+		if taskPtr.Title == "" {
+			dirName = fmt.Sprintf("%03d_%s", i+1, taskPtr.TaskId)
+		}
+		var taskFiles []string
+		for _, info := range taskPtr.SubtitleInfos {
+			taskFiles = append(taskFiles, strings.TrimPrefix(info.DownloadUrl, "/api/file/"))
+		}
+		if stepParam.TtsResultFilePath != "" {
+			taskFiles = append(taskFiles, stepParam.TtsResultFilePath)
+		}
+		videos, _ := filepath.Glob(filepath.Join(stepParam.TaskBasePath, "output", "*"))
+		taskFiles = append(taskFiles, videos...)
+		for _, file := range taskFiles {
+			if _, err := os.Stat(file); err != nil {
+				continue
+			}
+			files[filepath.Join(dirName, filepath.Base(file))] = file
+		}
+	}
+
+	batchBasePath := filepath.Join("./tasks", batchId)
+	if err := os.MkdirAll(batchBasePath, os.ModePerm); err != nil {
+		return "", err
+	}
+	archivePath := filepath.Join(batchBasePath, types.BatchTaskArchiveFileName)
+	if err := util.Zip(archivePath, files); err != nil {
+		return "", err
+	}
+	return archivePath, nil
+}
+
+// GetBatchTaskStatus 查询批量任务，整体进度为各子任务进度的平均值，失败的子任务按已完成计算
+func (s Service) GetBatchTaskStatus(req dto.GetBatchSubtitleTaskReq) (*dto.GetBatchSubtitleTaskResData, error) {
+	batch, ok := storage.BatchTasks.Load(req.BatchId)
+	if !ok || batch == nil {
+		return nil, errors.New("批量任务不存在")
+	}
+	batchPtr := batch.(*types.BatchTask).Snapshot()
+	res := &dto.GetBatchSubtitleTaskResData{
+		BatchId:            batchPtr.BatchId,
+		Title:              batchPtr.Title,
+		Status:             batchPtr.Status,
+		FailReason:         batchPtr.FailReason,
+		ArchiveDownloadUrl: batchPtr.ArchiveDownloadUrl,
+		Items:              make([]*dto.BatchTaskItem, 0, len(batchPtr.TaskIds)),
+	}
+
+	totalPercent := 0
+	for _, taskId := range batchPtr.TaskIds {
+		task, ok := storage.SubtitleTasks.Load(taskId)
+		if !ok || task == nil {
+			continue
+		}
+		taskPtr := task.(*types.SubtitleTask)
+		res.Items = append(res.Items, &dto.BatchTaskItem{
+			TaskId:         taskPtr.TaskId,
+			Title:          taskPtr.Title,
+			Link:           taskPtr.VideoSrc,
+			Status:         taskPtr.Status,
+			ProcessPercent: taskPtr.ProcessPct,
+			FailReason:     taskPtr.FailReason,
+		})
+		switch taskPtr.Status {
+		case types.SubtitleTaskStatusFailed:
+			res.FailedNum++
+			totalPercent += 100
+		case types.SubtitleTaskStatusSuccess:
+			res.SuccessNum++
+			totalPercent += int(taskPtr.ProcessPct)
+		default:
+			totalPercent += int(taskPtr.ProcessPct)
+		}
+	}
+	if len(res.Items) > 0 {
+		res.ProcessPercent = uint8(totalPercent / len(res.Items))
+	}
+	if batchPtr.Status == types.SubtitleTaskStatusProcessing && res.ProcessPercent == 100 {
+		// 子任务都已结束，还在打包
+		res.ProcessPercent = 99
+	}
+	return res, nil
+}
@@ -0,0 +1,195 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"krillin-ai/config"
+	"krillin-ai/log"
+	"krillin-ai/pkg/util"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// fileCache 按内容寻址存放在磁盘上的缓存，所有任务共享。
+// 文件的修改时间即最近使用时间，超出大小上限时淘汰最久未使用的文件。
+type fileCache struct {
+	name string
+	ext  string
+	conf func() config.CacheConfig // 每次使用时读取，修改配置后立即生效
+	lock sync.Mutex
+	size int64 // 当前缓存总大小，-1表示尚未统计
+}
+
+func newFileCache(name, ext string, conf func() config.CacheConfig) *fileCache {
+	return &fileCache{name: name, ext: ext, conf: conf, size: -1}
+}
+
+// cacheKey 把各部分用\x00连接后取sha256作为缓存键
+func cacheKey(parts ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *fileCache) enabled() bool {
+	conf := c.conf()
+	return conf.Enable && conf.Dir != ""
+}
+
+func (c *fileCache) path(key string) string {
+	return filepath.Join(c.conf().Dir, key[:2], key+c.ext)
+}
+
+// loadFile 命中时把缓存文件复制到outputFile
+func (c *fileCache) loadFile(key, outputFile string) bool {
+	cachePath := c.path(key)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if _, err := os.Stat(cachePath); err != nil {
+		return false
+	}
+	if err := util.CopyFile(cachePath, outputFile); err != nil {
+		log.GetLogger().Warn("fileCache copy error", zap.String("cache", cachePath), zap.Error(err))
+		return false
+	}
+	touch(cachePath)
+	return true
+}
+
+// exists 缓存是否存在，存在时记为最近使用
+func (c *fileCache) exists(key string) bool {
+	cachePath := c.path(key)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if _, err := os.Stat(cachePath); err != nil {
+		return false
+	}
+	touch(cachePath)
+	return true
+}
+
+// read 命中时返回缓存内容
+func (c *fileCache) read(key string) ([]byte, bool) {
+	cachePath := c.path(key)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	data, err := os.ReadFile(cachePath)
+	if err != nil {
+		return nil, false
+	}
+	touch(cachePath)
+	return data, true
+}
+
+// storeFile 把srcFile存入缓存
+func (c *fileCache) storeFile(key, srcFile string) error {
+	info, err := os.Stat(srcFile)
+	if err != nil {
+		return err
+	}
+	if info.Size() == 0 {
+		return fmt.Errorf("fileCache empty file: %s", srcFile)
+	}
+	return c.store(key, info.Size(), func(tmpPath string) error {
+		return util.CopyFile(srcFile, tmpPath)
+	})
+}
+
+// write 把内容存入缓存
+func (c *fileCache) write(key string, data []byte) error {
+	return c.store(key, int64(len(data)), func(tmpPath string) error {
+		return os.WriteFile(tmpPath, data, 0644)
+	})
+}
+
+// store 先写临时文件再重命名，避免读到写了一半的缓存
+func (c *fileCache) store(key string, size int64, writeTo func(tmpPath string) error) error {
+	cachePath := c.path(key)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if err := os.MkdirAll(filepath.Dir(cachePath), os.ModePerm); err != nil {
+		return err
+	}
+	tmpPath := cachePath + ".tmp"
+	if err := writeTo(tmpPath); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, cachePath); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if c.size >= 0 {
+		c.size += size
+	}
+	return c.evict(c.conf().MaxSizeMb * 1024 * 1024)
+}
+
+// evict 淘汰最久未使用的缓存直到总大小不超过maxSize，调用方需持有lock
+func (c *fileCache) evict(maxSize int64) error {
+	if maxSize <= 0 {
+		return nil
+	}
+	if c.size >= 0 && c.size <= maxSize {
+		return nil
+	}
+
+	type cacheFile struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+	var (
+		files []cacheFile
+		total int64
+	)
+	err := filepath.WalkDir(c.conf().Dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || filepath.Ext(path) != c.ext {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		files = append(files, cacheFile{path: path, size: info.Size(), modTime: info.ModTime()})
+		total += info.Size()
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("fileCache %s walk dir error: %w", c.name, err)
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+	evicted := 0
+	for _, f := range files {
+		if total <= maxSize {
+			break
+		}
+		if err = os.Remove(f.path); err != nil {
+			continue
+		}
+		total -= f.size
+		evicted++
+	}
+	c.size = total
+	if evicted > 0 {
+		log.GetLogger().Info("fileCache 淘汰缓存", zap.String("cache", c.name), zap.Int("evicted", evicted), zap.Int64("size", total))
+	}
+	return nil
+}
+
+// touch 更新修改时间，记为最近使用
+func touch(path string) {
+	now := time.Now()
+	_ = os.Chtimes(path, now, now)
+}
@@ -0,0 +1,56 @@
+package service
+
+import (
+	"bytes"
+	"krillin-ai/config"
+	"krillin-ai/log"
+	"os"
+	"testing"
+	"time"
+)
+
+func Test_fileCache_evict(t *testing.T) {
+	log.InitLogger()
+	dir := t.TempDir()
+	cache := newFileCache("test", ".bin", func() config.CacheConfig {
+		return config.CacheConfig{Enable: true, Dir: dir, MaxSizeMb: 1}
+	})
+	data := bytes.Repeat([]byte("x"), 400*1024)
+	keyA, keyB, keyC := cacheKey("a"), cacheKey("b"), cacheKey("c")
+
+	if err := cache.write(keyA, data); err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.write(keyB, data); err != nil {
+		t.Fatal(err)
+	}
+	// 修改时间即最近使用时间，a比b更早写入
+	now := time.Now()
+	_ = os.Chtimes(cache.path(keyA), now.Add(-3*time.Hour), now.Add(-3*time.Hour))
+	_ = os.Chtimes(cache.path(keyB), now.Add(-2*time.Hour), now.Add(-2*time.Hour))
+
+	// 读取a后a成为最近使用的，写入c超出1MB时淘汰最久未使用的b
+	if _, ok := cache.read(keyA); !ok {
+		t.Fatal("read a, want hit")
+	}
+	if err := cache.write(keyC, data); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		name string
+		key  string
+		want bool
+	}{
+		{name: "a", key: keyA, want: true},
+		{name: "b", key: keyB, want: false},
+		{name: "c", key: keyC, want: true},
+	} {
+		_, err := os.Stat(cache.path(tt.key))
+		if exists := err == nil; exists != tt.want {
+			t.Errorf("cache %s exists = %v, want %v", tt.name, exists, tt.want)
+		}
+	}
+	if cache.size != 2*int64(len(data)) {
+		t.Errorf("cache size = %d, want %d", cache.size, 2*len(data))
+	}
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"krillin-ai/internal/types"
+	"krillin-ai/log"
+	"krillin-ai/pkg/util"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// alignSegment 用强制对齐计算一个音频片段中各句原文的时间，返回与srtBlocks一一对应的结果。
+// 未启用或对齐失败时返回nil，沿用转录的词级时间戳
+func (s Service) alignSegment(ctx context.Context, audioFile string, srtBlocks []*util.SrtBlock, stepParam *types.SubtitleTaskStepParam) []*types.AlignedSentence {
+	if s.Aligner == nil || audioFile == "" {
+		return nil
+	}
+	var (
+		sentences []string
+		blockIdx  []int
+	)
+	for i, srtBlock := range srtBlocks {
+		if strings.TrimSpace(srtBlock.OriginLanguageSentence) == "" {
+			continue
+		}
+		sentences = append(sentences, srtBlock.OriginLanguageSentence)
+		blockIdx = append(blockIdx, i)
+	}
+	if len(sentences) == 0 {
+		return nil
+	}
+	aligned, err := s.Aligner.Align(ctx, audioFile, sentences, types.GetIso6391Code(stepParam.OriginLanguage))
+	if err != nil {
+		log.GetLogger().Warn("alignSegment 强制对齐失败，沿用转录的时间戳", zap.String("task id", stepParam.TaskId), zap.String("audio", audioFile), zap.Error(err))
+		return nil
+	}
+	if len(aligned) != len(sentences) {
+		log.GetLogger().Warn("alignSegment 对齐结果数与句子数不一致，沿用转录的时间戳", zap.String("task id", stepParam.TaskId),
+			zap.String("audio", audioFile), zap.Int("sentences", len(sentences)), zap.Int("aligned", len(aligned)))
+		return nil
+	}
+	result := make([]*types.AlignedSentence, len(srtBlocks))
+	for i := range aligned {
+		result[blockIdx[i]] = &aligned[i]
+	}
+	return result
+}
+
+// alignedSentenceTimestamps 取强制对齐得到的句子时间，词级时间映射到句子的排版单位，没有词级时间时按显示宽度分配
+func alignedSentenceTimestamps(aligned types.AlignedSentence, sentence string, lastTs float64, language types.StandardLanguageCode) (types.SrtSentence, []types.Word, float64, error) {
+	var srtSt types.SrtSentence
+	if aligned.End <= aligned.Start {
+		return srtSt, nil, 0, errors.New("alignedSentenceTimestamps invalid aligned time")
+	}
+	srtSt.Start = max(aligned.Start, lastTs)
+	srtSt.End = max(aligned.End, srtSt.Start)
+
+	var words []types.Word
+	if len(aligned.Words) > 0 {
+		if _, tokenWords, _, err := getSentenceTimestamps(aligned.Words, sentence, 0, language); err == nil {
+			words = tokenWords
+		}
+	}
+	if len(words) == 0 {
+		words = timedWordsOfText(sentence, srtSt.Start, srtSt.End, wordSeparator(language))
+	}
+	return srtSt, words, max(lastTs, srtSt.End), nil
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"krillin-ai/internal/types"
+	"krillin-ai/log"
+	"krillin-ai/pkg/util"
+	"testing"
+)
+
+type stubAligner struct {
+	aligned []types.AlignedSentence
+	err     error
+}
+
+func (a stubAligner) Align(ctx context.Context, audioFile string, sentences []string, language string) ([]types.AlignedSentence, error) {
+	return a.aligned, a.err
+}
+
+func Test_alignSegment(t *testing.T) {
+	log.InitLogger()
+	srtBlocks := []*util.SrtBlock{
+		{OriginLanguageSentence: "hello world"},
+		{OriginLanguageSentence: " "},
+		{OriginLanguageSentence: "good morning"},
+	}
+	stepParam := &types.SubtitleTaskStepParam{TaskId: "test", OriginLanguage: types.LanguageNameEnglish}
+	tests := []struct {
+		name    string
+		aligner stubAligner
+		want    []*types.AlignedSentence
+	}{
+		{
+			name:    "matching length",
+			aligner: stubAligner{aligned: []types.AlignedSentence{{Start: 0, End: 1}, {Start: 1.5, End: 2}}},
+			// 空句子不参与对齐，对应位置为nil
+			want: []*types.AlignedSentence{{Start: 0, End: 1}, nil, {Start: 1.5, End: 2}},
+		},
+		{
+			name:    "more results",
+			aligner: stubAligner{aligned: []types.AlignedSentence{{Start: 0, End: 1}, {Start: 1, End: 2}, {Start: 2, End: 3}}},
+		},
+		{
+			name:    "fewer results",
+			aligner: stubAligner{aligned: []types.AlignedSentence{{Start: 0, End: 1}}},
+		},
+		{
+			name:    "aligner error",
+			aligner: stubAligner{err: errors.New("align failed")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := Service{Aligner: tt.aligner}
+			got := s.alignSegment(context.Background(), "segment.wav", srtBlocks, stepParam)
+			if len(got) != len(tt.want) {
+				t.Fatalf("alignSegment() len = %d, want %d", len(got), len(tt.want))
+			}
+			for i := range tt.want {
+				if (got[i] == nil) != (tt.want[i] == nil) {
+					t.Fatalf("alignSegment()[%d] = %v, want %v", i, got[i], tt.want[i])
+				}
+				if got[i] != nil && (got[i].Start != tt.want[i].Start || got[i].End != tt.want[i].End) {
+					t.Errorf("alignSegment()[%d] = %v, want %v", i, *got[i], *tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -1,68 +1,140 @@
 package service
 
 import (
+	"encoding/json"
+	"fmt"
 	"krillin-ai/config"
 	"krillin-ai/internal/types"
 	"krillin-ai/log"
 	"krillin-ai/pkg/aliyun"
 	"krillin-ai/pkg/fasterwhisper"
+	"krillin-ai/pkg/localalign"
+	"krillin-ai/pkg/localtts"
 	"krillin-ai/pkg/openai"
 	"krillin-ai/pkg/whisper"
 	"krillin-ai/pkg/whispercpp"
 	"krillin-ai/pkg/whisperkit"
-	"krillin-ai/pkg/localtts"
 
 	"go.uber.org/zap"
 )
 
 type Service struct {
-	Transcriber      types.Transcriber
-	ChatCompleter    types.ChatCompleter
-	TtsClient        types.Ttser
-	OssClient        *aliyun.OssClient
-	VoiceCloneClient *aliyun.VoiceCloneClient
+	Transcriber    types.Transcriber
+	Transcribers   []NamedTranscriber // 按尝试顺序排列，第一个即Transcriber
+	ChatCompleter  types.ChatCompleter
+	TtsClient      types.Ttser
+	VoiceCloner    types.VoiceCloner
+	Aligner        types.ForcedAligner // 未启用强制对齐时为nil
+	llmRouter      *llmRouter
+	usage          *types.TaskUsage // 当前任务的用量，处理任务时设置
+	llmCacheBypass bool             // 当前任务不使用大模型缓存
+}
+
+// NamedTranscriber 带提供商名称的转录客户端
+type NamedTranscriber struct {
+	Provider    string
+	Transcriber types.Transcriber
 }
 
 func NewService() *Service {
-	var transcriber types.Transcriber
-	var chatCompleter types.ChatCompleter
-	var ttsClient types.Ttser
+	var transcribers []NamedTranscriber
+	for i, provider := range config.Conf.Transcribe.ProviderChain() {
+		transcriber, err := newTranscriber(provider)
+		if i == 0 && (err != nil || transcriber == nil) {
+			log.GetLogger().Error("创建转录客户端失败： ", zap.String("provider", provider), zap.Error(err))
+			return nil
+		}
+		if i > 0 && (err != nil || transcriber == nil) {
+			// 备用提供商创建失败不影响使用主提供商
+			log.GetLogger().Warn("创建备用转录客户端失败，跳过", zap.String("provider", provider), zap.Error(err))
+			continue
+		}
+		transcribers = append(transcribers, NamedTranscriber{Provider: provider, Transcriber: transcriber})
+	}
+	log.GetLogger().Info("当前选择的转录源： ", zap.String("transcriber", config.Conf.Transcribe.Provider),
+		zap.Strings("fallback", config.Conf.Transcribe.FallbackProviders))
+
+	router := newLlmRouter()
+	return &Service{
+		Transcriber:   transcribers[0].Transcriber,
+		Transcribers:  transcribers,
+		ChatCompleter: roleCompleter{router: router},
+		llmRouter:     router,
+		TtsClient:     newTtsClient(config.Conf.Tts.Provider),
+		VoiceCloner:   newVoiceCloner(),
+		Aligner:       newAligner(),
+	}
+}
+
+// chatCompleter 返回承担指定任务的大模型客户端
+func (s Service) chatCompleter(role string) types.ChatCompleter {
+	if s.llmRouter == nil {
+		return s.ChatCompleter
+	}
+	return roleCompleter{router: s.llmRouter, role: role, usage: s.usage, bypassCache: s.llmCacheBypass}
+}
+
+// jsonChatCompleter 返回承担指定任务、按schema返回json的大模型客户端
+func (s Service) jsonChatCompleter(role string, schema json.RawMessage) types.ChatCompleter {
+	if s.llmRouter == nil {
+		return s.ChatCompleter
+	}
+	return roleCompleter{router: s.llmRouter, role: role, schema: schema, usage: s.usage, bypassCache: s.llmCacheBypass}
+}
 
-	switch config.Conf.Transcribe.Provider {
+// newTranscriber 按提供商创建转录客户端
+func newTranscriber(provider string) (types.Transcriber, error) {
+	switch provider {
 	case "openai":
-		transcriber = whisper.NewClient(config.Conf.Transcribe.Openai.BaseUrl, config.Conf.Transcribe.Openai.ApiKey, config.Conf.App.Proxy)
+		return whisper.NewClient(config.Conf.Transcribe.Openai.BaseUrl, config.Conf.Transcribe.Openai.ApiKey, config.Conf.App.Proxy), nil
 	case "fasterwhisper":
-		transcriber = fasterwhisper.NewFastwhisperProcessor(config.Conf.Transcribe.Fasterwhisper.Model)
+		return fasterwhisper.NewFastwhisperProcessor(config.Conf.Transcribe.Fasterwhisper.Model), nil
 	case "whispercpp":
-		transcriber = whispercpp.NewWhispercppProcessor(config.Conf.Transcribe.Whispercpp.Model)
+		return whispercpp.NewWhispercppProcessor(config.Conf.Transcribe.Whispercpp.Model), nil
 	case "whisperkit":
-		transcriber = whisperkit.NewWhisperKitProcessor(config.Conf.Transcribe.Whisperkit.Model)
+		return whisperkit.NewWhisperKitProcessor(config.Conf.Transcribe.Whisperkit.Model), nil
 	case "aliyun":
-		cc, err := aliyun.NewAsrClient(config.Conf.Transcribe.Aliyun.Speech.AccessKeyId, config.Conf.Transcribe.Aliyun.Speech.AccessKeySecret, config.Conf.Transcribe.Aliyun.Speech.AppKey, true)
-		if err != nil {
-			log.GetLogger().Error("创建阿里云语音识别客户端失败： ", zap.Error(err))
-			return nil
-		}
-		transcriber = cc
+		return aliyun.NewAsrClient(config.Conf.Transcribe.Aliyun.Speech.AccessKeyId, config.Conf.Transcribe.Aliyun.Speech.AccessKeySecret, config.Conf.Transcribe.Aliyun.Speech.AppKey, true)
 	}
-	log.GetLogger().Info("当前选择的转录源： ", zap.String("transcriber", config.Conf.Transcribe.Provider))
-
-	chatCompleter = openai.NewClient(config.Conf.Llm.BaseUrl, config.Conf.Llm.ApiKey, config.Conf.App.Proxy)
+	return nil, fmt.Errorf("unsupported transcribe provider: %s", provider)
+}
 
-	switch config.Conf.Tts.Provider {
+// newTtsClient 按提供商创建语音合成客户端，不支持的提供商返回nil
+func newTtsClient(provider string) types.Ttser {
+	switch provider {
 	case "openai":
-		ttsClient = openai.NewClient(config.Conf.Tts.Openai.BaseUrl, config.Conf.Tts.Openai.ApiKey, config.Conf.App.Proxy)
+		return openai.NewClient(config.Conf.Tts.Openai.BaseUrl, config.Conf.Tts.Openai.ApiKey, config.Conf.App.Proxy)
 	case "aliyun":
-		ttsClient = aliyun.NewTtsClient(config.Conf.Tts.Aliyun.Speech.AccessKeyId, config.Conf.Tts.Aliyun.Speech.AccessKeySecret, config.Conf.Tts.Aliyun.Speech.AppKey)
+		return aliyun.NewTtsClient(config.Conf.Tts.Aliyun.Speech.AccessKeyId, config.Conf.Tts.Aliyun.Speech.AccessKeySecret, config.Conf.Tts.Aliyun.Speech.AppKey)
 	case "edge-tts":
-		ttsClient = localtts.NewEdgeTtsClient()
+		return localtts.NewEdgeTtsClient()
 	}
+	return nil
+}
 
-	return &Service{
-		Transcriber:      transcriber,
-		ChatCompleter:    chatCompleter,
-		TtsClient:        ttsClient,
-		OssClient:        aliyun.NewOssClient(config.Conf.Transcribe.Aliyun.Oss.AccessKeyId, config.Conf.Transcribe.Aliyun.Oss.AccessKeySecret, config.Conf.Transcribe.Aliyun.Oss.Bucket),
-		VoiceCloneClient: aliyun.NewVoiceCloneClient(config.Conf.Tts.Aliyun.Speech.AccessKeyId, config.Conf.Tts.Aliyun.Speech.AccessKeySecret, config.Conf.Tts.Aliyun.Speech.AppKey),
+func newVoiceCloner() types.VoiceCloner {
+	switch config.Conf.Tts.VoiceClone.Provider {
+	case "local":
+		return localtts.NewCommandVoiceCloner(config.Conf.Tts.VoiceClone.Command, config.Conf.Tts.VoiceClone.Args)
+	case "aliyun", "":
+		// 优先使用tts的oss配置，未配置时沿用转录的oss
+		ossConf := config.Conf.Tts.Aliyun.Oss
+		if ossConf.Bucket == "" {
+			ossConf = config.Conf.Transcribe.Aliyun.Oss
+		}
+		return aliyun.NewCosyVoiceCloner(
+			aliyun.NewOssClient(ossConf.AccessKeyId, ossConf.AccessKeySecret, ossConf.Bucket, ossConf.Region),
+			aliyun.NewVoiceCloneClient(config.Conf.Tts.Aliyun.Speech.AccessKeyId, config.Conf.Tts.Aliyun.Speech.AccessKeySecret, config.Conf.Tts.Aliyun.Speech.AppKey),
+		)
+	}
+	return nil
+}
+
+// newAligner 按配置创建强制对齐客户端，未启用时返回nil
+func newAligner() types.ForcedAligner {
+	switch config.Conf.Align.Provider {
+	case "local":
+		return localalign.NewCommandAligner(config.Conf.Align.Command, config.Conf.Align.Args)
 	}
+	return nil
 }
@@ -2,101 +2,45 @@ package service
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"go.uber.org/zap"
-	"krillin-ai/config"
-	"krillin-ai/internal/storage"
 	"krillin-ai/internal/types"
 	"krillin-ai/log"
-	"krillin-ai/pkg/util"
-	"os/exec"
-	"strings"
+	"krillin-ai/pkg/source"
 )
 
 func (s Service) linkToFile(ctx context.Context, stepParam *types.SubtitleTaskStepParam) error {
-	var (
-		err    error
-		output []byte
-	)
-	link := stepParam.Link
-	audioPath := fmt.Sprintf("%s/%s", stepParam.TaskBasePath, types.SubtitleTaskAudioFileName)
-	videoPath := fmt.Sprintf("%s/%s", stepParam.TaskBasePath, types.SubtitleTaskVideoFileName)
 	stepParam.TaskPtr.ProcessPct = 3
-	if strings.Contains(link, "local:") {
-		// 本地文件
-		videoPath = strings.ReplaceAll(link, "local:", "")
-		cmd := exec.Command(storage.FfmpegPath, "-i", videoPath, "-vn", "-ar", "44100", "-ac", "2", "-ab", "192k", "-f", "mp3", audioPath)
-		output, err = cmd.CombinedOutput()
-		if err != nil {
-			log.GetLogger().Error("generateAudioSubtitles.linkToFile ffmpeg error", zap.Any("step param", stepParam), zap.String("output", string(output)), zap.Error(err))
-			return fmt.Errorf("generateAudioSubtitles.linkToFile ffmpeg error: %w", err)
-		}
-	} else if strings.Contains(link, "youtube.com") {
-		var videoId string
-		videoId, err = util.GetYouTubeID(link)
-		if err != nil {
-			log.GetLogger().Error("linkToFile.GetYouTubeID error", zap.Any("step param", stepParam), zap.Error(err))
-			return fmt.Errorf("linkToFile.GetYouTubeID error: %w", err)
-		}
-		stepParam.Link = "https://www.youtube.com/watch?v=" + videoId
-		cmdArgs := []string{"-f", "bestaudio", "--extract-audio", "--audio-format", "mp3", "--audio-quality", "192K", "-o", audioPath, stepParam.Link}
-		if config.Conf.App.Proxy != "" {
-			cmdArgs = append(cmdArgs, "--proxy", config.Conf.App.Proxy)
-		}
-		cmdArgs = append(cmdArgs, "--cookies", "./cookies.txt")
-		if storage.FfmpegPath != "ffmpeg" {
-			cmdArgs = append(cmdArgs, "--ffmpeg-location", storage.FfmpegPath)
-		}
-		cmd := exec.Command(storage.YtdlpPath, cmdArgs...)
-		output, err = cmd.CombinedOutput()
-		if err != nil {
-			log.GetLogger().Error("linkToFile download audio yt-dlp error", zap.Any("step param", stepParam), zap.String("output", string(output)), zap.Error(err))
-			return fmt.Errorf("linkToFile download audio yt-dlp error: %w", err)
-		}
-	} else if strings.Contains(link, "bilibili.com") {
-		videoId := util.GetBilibiliVideoId(link)
-		if videoId == "" {
-			return errors.New("linkToFile error: invalid link")
-		}
-		stepParam.Link = "https://www.bilibili.com/video/" + videoId
-		cmdArgs := []string{"-f", "bestaudio[ext=m4a]", "-x", "--audio-format", "mp3", "-o", audioPath, stepParam.Link}
-		if config.Conf.App.Proxy != "" {
-			cmdArgs = append(cmdArgs, "--proxy", config.Conf.App.Proxy)
-		}
-		if storage.FfmpegPath != "ffmpeg" {
-			cmdArgs = append(cmdArgs, "--ffmpeg-location", storage.FfmpegPath)
-		}
-		cmd := exec.Command(storage.YtdlpPath, cmdArgs...)
-		output, err = cmd.CombinedOutput()
-		if err != nil {
-			log.GetLogger().Error("linkToFile download audio yt-dlp error", zap.Any("step param", stepParam), zap.String("output", string(output)), zap.Error(err))
-			return fmt.Errorf("linkToFile download audio yt-dlp error: %w", err)
-		}
-	} else {
-		log.GetLogger().Info("linkToFile.unsupported link type", zap.Any("step param", stepParam))
-		return errors.New("linkToFile error: unsupported link, only support youtube, bilibili and local file")
+	media, err := source.Resolve(ctx, stepParam.Link, types.SourceResolveOption{
+		TaskBasePath: stepParam.TaskBasePath,
+		AudioPath:    fmt.Sprintf("%s/%s", stepParam.TaskBasePath, types.SubtitleTaskAudioFileName),
+		VideoPath:    fmt.Sprintf("%s/%s", stepParam.TaskBasePath, types.SubtitleTaskVideoFileName),
+		NeedVideo:    stepParam.EmbedSubtitleVideoType != "none",
+	})
+	if err != nil {
+		log.GetLogger().Error("linkToFile resolve source error", zap.Any("step param", stepParam), zap.Error(err))
+		return fmt.Errorf("linkToFile resolve source error: %w", err)
+	}
+	stepParam.Link = media.Link
+	stepParam.AudioFilePath = media.AudioPath
+	stepParam.InputVideoPath = media.VideoPath
+	if stepParam.EmbedSubtitleVideoType != "none" && media.VideoPath == "" {
+		log.GetLogger().Warn("linkToFile 来源没有视频，跳过字幕嵌入", zap.String("link", stepParam.Link))
+		stepParam.EmbedSubtitleVideoType = "none"
+		stepParam.EmbedAspectRatios = nil
 	}
-	stepParam.TaskPtr.ProcessPct = 6
-	stepParam.AudioFilePath = audioPath
 
-	if !strings.HasPrefix(link, "local:") && stepParam.EmbedSubtitleVideoType != "none" {
-		// 需要下载原视频
-		cmdArgs := []string{"-f", "bestvideo[height<=1080][ext=mp4]+bestaudio[ext=m4a]/bestvideo[height<=720][ext=mp4]+bestaudio[ext=m4a]/bestvideo[height<=480][ext=mp4]+bestaudio[ext=m4a]", "-o", videoPath, stepParam.Link}
-		if config.Conf.App.Proxy != "" {
-			cmdArgs = append(cmdArgs, "--proxy", config.Conf.App.Proxy)
-		}
-		if storage.FfmpegPath != "ffmpeg" {
-			cmdArgs = append(cmdArgs, "--ffmpeg-location", storage.FfmpegPath)
-		}
-		cmd := exec.Command(storage.YtdlpPath, cmdArgs...)
-		output, err = cmd.CombinedOutput()
-		if err != nil {
-			log.GetLogger().Error("linkToFile download video yt-dlp error", zap.Any("step param", stepParam), zap.String("output", string(output)), zap.Error(err))
-			return fmt.Errorf("linkToFile download video yt-dlp error: %w", err)
-		}
+	// 记录来源提供的视频信息
+	taskPtr := stepParam.TaskPtr
+	if taskPtr.Title == "" {
+		taskPtr.Title = media.Title
+	}
+	if taskPtr.Description == "" {
+		taskPtr.Description = media.Description
+	}
+	if media.Duration > 0 {
+		taskPtr.Duration = uint32(media.Duration)
 	}
-	stepParam.InputVideoPath = videoPath
 
 	// 更新字幕任务信息
 	stepParam.TaskPtr.ProcessPct = 10
@@ -0,0 +1,219 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"krillin-ai/config"
+	"krillin-ai/internal/types"
+	"krillin-ai/log"
+	"krillin-ai/pkg/ollama"
+	"krillin-ai/pkg/openai"
+	"krillin-ai/pkg/util"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// llmRouter 按任务类型在多个大模型接口间分配请求，接口出错或限流时切换到其他接口
+type llmRouter struct {
+	lock      sync.Mutex
+	balance   string
+	cooldown  time.Duration
+	endpoints []*llmEndpoint
+	cursors   map[string]int   // 任务类型 -> 轮询位置
+	weights   map[string][]int // 任务类型 -> 平滑加权轮询中各候选接口的当前权重
+}
+
+type llmEndpoint struct {
+	conf          config.LlmEndpointConfig
+	client        types.ChatCompleter
+	cooldownUntil time.Time // 出错后在此之前不优先分配请求
+}
+
+func newLlmRouter() *llmRouter {
+	router := &llmRouter{
+		balance:  config.Conf.Llm.Balance,
+		cooldown: time.Duration(config.Conf.Llm.CooldownSec) * time.Second,
+		cursors:  make(map[string]int),
+		weights:  make(map[string][]int),
+	}
+	for _, conf := range config.Conf.Llm.EndpointList() {
+		router.endpoints = append(router.endpoints, &llmEndpoint{
+			conf:   conf,
+			client: newChatClient(conf),
+		})
+	}
+	return router
+}
+
+func newChatClient(conf config.LlmEndpointConfig) types.ChatCompleter {
+	if conf.Provider == "ollama" {
+		return ollama.NewClient(conf.BaseUrl, conf.Model)
+	}
+	return openai.NewChatClient(conf.BaseUrl, conf.ApiKey, conf.Model, conf.Json, conf.StreamUsageEnabled(), config.Conf.App.Proxy)
+}
+
+// llmCache 大模型返回结果的缓存，重新处理相同视频时不再重复请求
+var llmCache = newFileCache("llm", ".txt", func() config.CacheConfig { return config.Conf.Llm.Cache })
+
+// roleCompleter 只使用承担指定任务的接口，schema不为空时要求按该结构返回json
+type roleCompleter struct {
+	router      *llmRouter
+	role        string
+	schema      json.RawMessage
+	usage       *types.TaskUsage // 不为nil时记录用量
+	bypassCache bool             // 不读取缓存，结果仍会写入缓存
+}
+
+func (c roleCompleter) ChatCompletion(query string) (string, error) {
+	if llmCache.enabled() && !c.bypassCache {
+		if result, ok := c.router.loadCache(c.role, query, c.schema); ok {
+			return result, nil
+		}
+	}
+	result, endpoint, chatUsage, err := c.router.chat(c.role, query, c.schema)
+	if err != nil {
+		return "", err
+	}
+	recordUsage(c.usage, types.ProviderUsage{
+		Kind:             types.UsageKindLlm,
+		Provider:         endpoint.conf.Name,
+		Calls:            1,
+		PromptTokens:     chatUsage.PromptTokens,
+		CompletionTokens: chatUsage.CompletionTokens,
+	})
+	if llmCache.enabled() && cacheableLlmResult(result, c.schema) {
+		if err = llmCache.write(llmCacheKey(endpoint.conf.Model, c.role, query, c.schema), []byte(result)); err != nil {
+			log.GetLogger().Warn("roleCompleter store llm cache error", zap.String("role", c.role), zap.Error(err))
+		}
+	}
+	return result, nil
+}
+
+// llmCacheKey 由提示词版本、模型、任务类型、返回结构和完整提示词计算缓存键
+func llmCacheKey(model, role, query string, schema json.RawMessage) string {
+	return cacheKey(types.LlmPromptVersion, model, role, string(schema), query)
+}
+
+// loadCache 依次查找各候选接口所用模型的缓存
+func (r *llmRouter) loadCache(role, query string, schema json.RawMessage) (string, bool) {
+	checked := make(map[string]bool)
+	for _, endpoint := range r.candidates(role) {
+		if checked[endpoint.conf.Model] {
+			continue
+		}
+		checked[endpoint.conf.Model] = true
+		if data, ok := llmCache.read(llmCacheKey(endpoint.conf.Model, role, query, schema)); ok {
+			return string(data), true
+		}
+	}
+	return "", false
+}
+
+// cacheableLlmResult 空结果和要求json但格式不对的结果不缓存，以免调用方重试时拿到同样的错误结果
+func cacheableLlmResult(result string, schema json.RawMessage) bool {
+	if strings.TrimSpace(result) == "" {
+		return false
+	}
+	return len(schema) == 0 || json.Valid([]byte(util.CleanMarkdownCodeBlock(result)))
+}
+
+// chat 依次尝试各接口，返回结果、成功的接口和用量
+func (r *llmRouter) chat(role, query string, schema json.RawMessage) (string, *llmEndpoint, types.ChatUsage, error) {
+	conf := config.Conf.Llm.OptionsOf(role)
+	options := types.ChatOptions{
+		Temperature: *conf.Temperature,
+		MaxTokens:   conf.MaxTokens,
+		NumCtx:      conf.NumCtx,
+		Json:        len(schema) > 0,
+		Schema:      schema,
+	}
+	var err error
+	for _, endpoint := range r.pick(role) {
+		var (
+			result    string
+			chatUsage types.ChatUsage
+		)
+		if client, ok := endpoint.client.(types.OptionChatCompleter); ok {
+			result, chatUsage, err = client.ChatCompletionWithOptions(query, options)
+		} else {
+			result, err = endpoint.client.ChatCompletion(query)
+		}
+		if err == nil {
+			return result, endpoint, chatUsage, nil
+		}
+		r.markFailed(endpoint)
+		log.GetLogger().Warn("llmRouter 大模型接口请求失败，尝试下一个接口",
+			zap.String("role", role),
+			zap.String("endpoint", endpoint.conf.Name),
+			zap.Error(err))
+	}
+	return "", nil, types.ChatUsage{}, fmt.Errorf("all llm endpoints failed for role %s: %w", role, err)
+}
+
+// pick 返回本次请求依次尝试的接口，负载均衡选中的接口在前，冷却中的接口排在最后
+func (r *llmRouter) pick(role string) []*llmEndpoint {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	candidates := r.candidates(role)
+	start := r.next(role, candidates)
+	now := time.Now()
+	var ready, cooling []*llmEndpoint
+	for i := range candidates {
+		endpoint := candidates[(start+i)%len(candidates)]
+		if now.Before(endpoint.cooldownUntil) {
+			cooling = append(cooling, endpoint)
+		} else {
+			ready = append(ready, endpoint)
+		}
+	}
+	return append(ready, cooling...)
+}
+
+// candidates 承担该任务的接口，没有接口声明该任务时使用全部接口
+func (r *llmRouter) candidates(role string) []*llmEndpoint {
+	var candidates []*llmEndpoint
+	for _, endpoint := range r.endpoints {
+		if len(endpoint.conf.Roles) == 0 || slices.Contains(endpoint.conf.Roles, role) {
+			candidates = append(candidates, endpoint)
+		}
+	}
+	if len(candidates) == 0 {
+		return r.endpoints
+	}
+	return candidates
+}
+
+// next 按负载均衡方式选出首选接口的下标，调用方需持有lock
+func (r *llmRouter) next(role string, candidates []*llmEndpoint) int {
+	if r.balance != "weighted" {
+		index := r.cursors[role] % len(candidates)
+		r.cursors[role]++
+		return index
+	}
+	// 平滑加权轮询：每次给所有接口加上自身权重，选当前权重最大的，再减去总权重
+	current := r.weights[role]
+	if len(current) != len(candidates) {
+		current = make([]int, len(candidates))
+		r.weights[role] = current
+	}
+	best, total := 0, 0
+	for i, endpoint := range candidates {
+		current[i] += endpoint.conf.Weight
+		total += endpoint.conf.Weight
+		if current[i] > current[best] {
+			best = i
+		}
+	}
+	current[best] -= total
+	return best
+}
+
+func (r *llmRouter) markFailed(endpoint *llmEndpoint) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	endpoint.cooldownUntil = time.Now().Add(r.cooldown)
+}
@@ -0,0 +1,169 @@
+package service
+
+import (
+	"errors"
+	"krillin-ai/config"
+	"krillin-ai/log"
+	"slices"
+	"testing"
+	"time"
+)
+
+type stubChatCompleter struct {
+	result string
+	err    error
+	calls  int
+}
+
+func (c *stubChatCompleter) ChatCompletion(query string) (string, error) {
+	c.calls++
+	return c.result, c.err
+}
+
+func newTestLlmRouter(balance string, endpoints ...config.LlmEndpointConfig) *llmRouter {
+	router := &llmRouter{
+		balance:  balance,
+		cooldown: time.Minute,
+		cursors:  make(map[string]int),
+		weights:  make(map[string][]int),
+	}
+	for _, conf := range endpoints {
+		router.endpoints = append(router.endpoints, &llmEndpoint{conf: conf, client: &stubChatCompleter{result: conf.Name}})
+	}
+	return router
+}
+
+func endpointNames(endpoints []*llmEndpoint) []string {
+	names := make([]string, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		names = append(names, endpoint.conf.Name)
+	}
+	return names
+}
+
+// firstPicks 连续请求n次，返回每次首选的接口
+func firstPicks(router *llmRouter, role string, n int) []string {
+	var names []string
+	for range n {
+		names = append(names, router.pick(role)[0].conf.Name)
+	}
+	return names
+}
+
+func Test_llmRouter_candidates(t *testing.T) {
+	router := newTestLlmRouter("",
+		config.LlmEndpointConfig{Name: "local", Roles: []string{"split"}, Weight: 1},
+		config.LlmEndpointConfig{Name: "premium", Roles: []string{"translate", "qa"}, Weight: 1},
+		config.LlmEndpointConfig{Name: "any", Weight: 1},
+	)
+	tests := []struct {
+		role string
+		want []string
+	}{
+		{role: "split", want: []string{"local", "any"}},
+		{role: "qa", want: []string{"premium", "any"}},
+		{role: "title", want: []string{"any"}},
+	}
+	for _, tt := range tests {
+		if got := endpointNames(router.candidates(tt.role)); !slices.Equal(got, tt.want) {
+			t.Errorf("candidates(%s) = %v, want %v", tt.role, got, tt.want)
+		}
+	}
+
+	// 没有接口承担该任务时使用全部接口
+	router = newTestLlmRouter("", config.LlmEndpointConfig{Name: "local", Roles: []string{"split"}, Weight: 1})
+	if got := endpointNames(router.candidates("qa")); !slices.Equal(got, []string{"local"}) {
+		t.Errorf("candidates(qa) = %v, want [local]", got)
+	}
+}
+
+func Test_llmRouter_roundRobin(t *testing.T) {
+	router := newTestLlmRouter("round_robin",
+		config.LlmEndpointConfig{Name: "a", Weight: 1},
+		config.LlmEndpointConfig{Name: "b", Weight: 1},
+		config.LlmEndpointConfig{Name: "c", Weight: 1},
+	)
+	want := []string{"a", "b", "c", "a", "b"}
+	if got := firstPicks(router, "translate", len(want)); !slices.Equal(got, want) {
+		t.Errorf("round robin picks = %v, want %v", got, want)
+	}
+	// 其余接口按轮询顺序排在后面作为备用
+	if got := endpointNames(router.pick("translate")); !slices.Equal(got, []string{"c", "a", "b"}) {
+		t.Errorf("pick() = %v, want [c a b]", got)
+	}
+	// 各任务类型分别轮询
+	if got := firstPicks(router, "split", 2); !slices.Equal(got, []string{"a", "b"}) {
+		t.Errorf("split picks = %v, want [a b]", got)
+	}
+}
+
+func Test_llmRouter_weighted(t *testing.T) {
+	router := newTestLlmRouter("weighted",
+		config.LlmEndpointConfig{Name: "a", Weight: 5},
+		config.LlmEndpointConfig{Name: "b", Weight: 1},
+		config.LlmEndpointConfig{Name: "c", Weight: 1},
+	)
+	// 平滑加权轮询把权重小的接口分散在中间，而不是连续选5次a
+	want := []string{"a", "a", "b", "a", "c", "a", "a"}
+	for round := range 3 {
+		if got := firstPicks(router, "translate", len(want)); !slices.Equal(got, want) {
+			t.Fatalf("round %d weighted picks = %v, want %v", round, got, want)
+		}
+	}
+}
+
+func Test_llmRouter_cooldown(t *testing.T) {
+	router := newTestLlmRouter("round_robin",
+		config.LlmEndpointConfig{Name: "a", Weight: 1},
+		config.LlmEndpointConfig{Name: "b", Weight: 1},
+		config.LlmEndpointConfig{Name: "c", Weight: 1},
+	)
+	router.markFailed(router.endpoints[0])
+	// 冷却中的接口排在最后
+	if got := endpointNames(router.pick("translate")); !slices.Equal(got, []string{"b", "c", "a"}) {
+		t.Errorf("pick() = %v, want [b c a]", got)
+	}
+	if got := endpointNames(router.pick("translate")); !slices.Equal(got, []string{"b", "c", "a"}) {
+		t.Errorf("pick() = %v, want [b c a]", got)
+	}
+
+	// 全部接口都在冷却时仍按轮询顺序返回，不会没有接口可用
+	router.markFailed(router.endpoints[1])
+	router.markFailed(router.endpoints[2])
+	if got := endpointNames(router.pick("translate")); !slices.Equal(got, []string{"c", "a", "b"}) {
+		t.Errorf("pick() = %v, want [c a b]", got)
+	}
+
+	// 冷却结束后恢复分配
+	router.endpoints[0].cooldownUntil = time.Now().Add(-time.Second)
+	if got := router.pick("translate")[0].conf.Name; got != "a" {
+		t.Errorf("pick()[0] = %s, want a", got)
+	}
+}
+
+func Test_llmRouter_chatFailover(t *testing.T) {
+	log.InitLogger()
+	router := newTestLlmRouter("round_robin",
+		config.LlmEndpointConfig{Name: "a", Weight: 1},
+		config.LlmEndpointConfig{Name: "b", Weight: 1},
+	)
+	failing := router.endpoints[0].client.(*stubChatCompleter)
+	failing.err = errors.New("429 too many requests")
+
+	result, endpoint, _, err := router.chat("translate", "hello", nil)
+	if err != nil || result != "b" || endpoint.conf.Name != "b" {
+		t.Fatalf("chat() = %q, %v, %v, want b", result, endpoint, err)
+	}
+	if !time.Now().Before(router.endpoints[0].cooldownUntil) {
+		t.Error("failed endpoint should be cooling down")
+	}
+	// a冷却中，下一次请求直接使用b
+	if _, endpoint, _, _ = router.chat("translate", "hello", nil); endpoint.conf.Name != "b" || failing.calls != 1 {
+		t.Errorf("chat() used %s with %d calls to a, want b and 1", endpoint.conf.Name, failing.calls)
+	}
+
+	router.endpoints[1].client.(*stubChatCompleter).err = errors.New("503")
+	if _, _, _, err = router.chat("translate", "hello", nil); err == nil {
+		t.Error("chat() error = nil, want all endpoints failed")
+	}
+}
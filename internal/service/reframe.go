@@ -0,0 +1,344 @@
+package service
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"krillin-ai/internal/storage"
+	"krillin-ai/internal/types"
+	"krillin-ai/log"
+	"math"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// 场景分析时抽帧的帧率和缩放后长边的像素数
+	reframeAnalysisFps  = 2
+	reframeAnalysisSize = 160
+	// 相邻两帧平均像素差超过该值视为切换镜头
+	reframeSceneCutThreshold = 30.0
+	// 相邻镜头裁剪位置相差不到画面尺寸的该比例时合并，避免画面来回抖动
+	reframeMergeRatio = 0.03
+	// 标题的位置和字号以竖屏高度1280为基准
+	reframeTitleReferenceHeight = 1280.0
+	// 画面比例相差不到该比例时视为与源视频一致，不转换
+	aspectRatioTolerance = 0.02
+	// 非9:16的画面，长边最多使用的像素数
+	maxEmbedCanvasSize = 1920
+)
+
+// parseAspectRatio 解析形如16:9的画面比例
+func parseAspectRatio(ratio string) (int, int, error) {
+	widthStr, heightStr, ok := strings.Cut(ratio, ":")
+	width, err1 := strconv.Atoi(strings.TrimSpace(widthStr))
+	height, err2 := strconv.Atoi(strings.TrimSpace(heightStr))
+	if !ok || err1 != nil || err2 != nil || width <= 0 || height <= 0 {
+		return 0, 0, fmt.Errorf("画面比例格式不正确，应为宽:高，如16:9: %s", ratio)
+	}
+	return width, height, nil
+}
+
+// embedAspectRatiosOf 得到需要合成的画面比例，指定了比例时使用指定的，否则按横竖屏类型
+func embedAspectRatiosOf(embedType string, ratios []string) ([]string, error) {
+	switch embedType {
+	case "horizontal", "vertical", "all":
+	default:
+		return nil, nil
+	}
+	if len(ratios) == 0 {
+		switch embedType {
+		case "horizontal":
+			return []string{"16:9"}, nil
+		case "vertical":
+			return []string{"9:16"}, nil
+		default:
+			return []string{"16:9", "9:16"}, nil
+		}
+	}
+	var res []string
+	for _, ratio := range ratios {
+		width, height, err := parseAspectRatio(ratio)
+		if err != nil {
+			return nil, err
+		}
+		ratio = fmt.Sprintf("%d:%d", width, height)
+		if !slices.Contains(res, ratio) {
+			res = append(res, ratio)
+		}
+	}
+	return res, nil
+}
+
+// embedCanvasSize 得到某个画面比例的输出分辨率，宽高均为偶数；与源视频比例一致时保持源分辨率且不需要转换
+func embedCanvasSize(ratio string, srcWidth, srcHeight int, stepParam *types.SubtitleTaskStepParam) (width, height int, reframe bool, err error) {
+	ratioWidth, ratioHeight, err := parseAspectRatio(ratio)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	target := float64(ratioWidth) / float64(ratioHeight)
+	if math.Abs(float64(srcWidth)/float64(srcHeight)-target)/target < aspectRatioTolerance {
+		// 编码要求宽高为偶数，源视频为奇数时裁掉最后一列或一行
+		return srcWidth / 2 * 2, srcHeight / 2 * 2, false, nil
+	}
+	if ratioWidth*16 == ratioHeight*9 {
+		return stepParam.VerticalVideoWidth, stepParam.VerticalVideoHeight, true, nil
+	}
+	// 短边与源视频的短边一致，避免放大画面，长边不超过maxEmbedCanvasSize
+	short := float64(min(srcWidth, srcHeight))
+	long := min(short*max(target, 1/target), maxEmbedCanvasSize)
+	short = long / max(target, 1/target)
+	if target >= 1 {
+		width, height = int(long), int(short)
+	} else {
+		width, height = int(short), int(long)
+	}
+	return width / 2 * 2, height / 2 * 2, true, nil
+}
+
+// embedOutputFileName 16:9和9:16沿用横屏、竖屏的文件名，其他比例按比例命名
+func embedOutputFileName(ratio string) string {
+	switch ratio {
+	case "16:9":
+		return types.SubtitleTaskHorizontalEmbedVideoFileName
+	case "9:16":
+		return types.SubtitleTaskVerticalEmbedVideoFileName
+	}
+	return fmt.Sprintf("embed_%s.mp4", strings.ReplaceAll(ratio, ":", "x"))
+}
+
+// reframeFilter 按任务的转换方式生成把视频转为width x height画面的滤镜，竖版画面在顶部叠加标题
+func reframeFilter(inputVideo string, srcWidth, srcHeight, width, height int, stepParam *types.SubtitleTaskStepParam, fontBold, fontRegular string) string {
+	portrait := height > width
+	// 竖版画面把原画面放在偏上的位置，给下方字幕和上方标题留出空间
+	offsetY := "(oh-ih)/2"
+	if portrait {
+		offsetY = "(oh-ih)*2/5"
+	}
+	var filter string
+	switch stepParam.ReframeMode {
+	case types.ReframeModeBlur:
+		// 原画面完整显示，空白处用放大并模糊的画面填充
+		filter = fmt.Sprintf("split[src1][src2];[src1]scale=%d:%d:force_original_aspect_ratio=increase,crop=%d:%d,boxblur=20:5[bg];[src2]scale=%d:%d:force_original_aspect_ratio=decrease[fg];[bg][fg]overlay=(W-w)/2:%s",
+			width, height, width, height, width, height, strings.NewReplacer("oh", "H", "ih", "h").Replace(offsetY))
+	case types.ReframeModeCrop:
+		filter = fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=increase,crop=%d:%d", width, height, width, height)
+	case types.ReframeModeSmart:
+		filter = smartCropFilter(inputVideo, srcWidth, srcHeight, width, height)
+	default:
+		filter = fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=decrease,pad=%d:%d:(ow-iw)/2:%s", width, height, width, height, offsetY)
+		if portrait {
+			filter += fmt.Sprintf(",drawbox=y=0:h=%d:c=black@1:t=fill", scaleReframeTitle(100, height))
+		}
+	}
+	if !portrait {
+		return filter
+	}
+
+	titles := []struct {
+		text     string
+		font     string
+		y        float64
+		fontSize float64
+	}{
+		{stepParam.VerticalVideoMajorTitle, fontBold, 210, 55},
+		{stepParam.VerticalVideoMinorTitle, fontRegular, 280, 40},
+	}
+	for _, title := range titles {
+		if title.text == "" {
+			continue
+		}
+		filter += fmt.Sprintf(",drawtext=text=%s:expansion=none:x=(w-text_w)/2:y=%d:fontsize=%d:fontcolor=yellow:box=1:boxcolor=black@0.5:fontfile='%s'",
+			escapeDrawtext(title.text), scaleReframeTitle(title.y, height), scaleReframeTitle(title.fontSize, height), title.font)
+	}
+	return filter
+}
+
+// parseVideoResolution 解析形如1080x1920的分辨率，宽高需为偶数以便编码
+func parseVideoResolution(resolution string) (int, int, error) {
+	widthStr, heightStr, ok := strings.Cut(strings.ToLower(resolution), "x")
+	width, err1 := strconv.Atoi(strings.TrimSpace(widthStr))
+	height, err2 := strconv.Atoi(strings.TrimSpace(heightStr))
+	if !ok || err1 != nil || err2 != nil || width <= 0 || height <= 0 || width%2 != 0 || height%2 != 0 {
+		return 0, 0, fmt.Errorf("分辨率格式不正确，应为偶数的宽x高，如1080x1920: %s", resolution)
+	}
+	return width, height, nil
+}
+
+func scaleReframeTitle(value float64, height int) int {
+	return int(math.Round(value * float64(height) / reframeTitleReferenceHeight))
+}
+
+// escapeDrawtext 转义drawtext的文本，先按滤镜参数转义，再按滤镜图转义，引号、冒号、逗号等都按原样显示
+func escapeDrawtext(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	text = strings.NewReplacer(`\`, `\\`, `'`, `\'`, `:`, `\:`).Replace(text)
+	return strings.NewReplacer(`\`, `\\`, `'`, `\'`, `[`, `\[`, `]`, `\]`, `,`, `\,`, `;`, `\;`).Replace(text)
+}
+
+// smartCropFilter 按镜头分析画面中内容最集中的位置，生成随时间变化的裁剪滤镜，分析失败时居中裁剪。
+// 源视频比目标画面宽时左右移动裁剪框，比目标画面窄时上下移动。
+func smartCropFilter(inputVideo string, srcWidth, srcHeight, width, height int) string {
+	centerCrop := fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=increase,crop=%d:%d", width, height, width, height)
+	cropWidth, cropHeight := srcWidth, srcHeight
+	vertical := float64(srcWidth)/float64(srcHeight) < float64(width)/float64(height)
+	if vertical {
+		cropHeight = int(float64(srcWidth)*float64(height)/float64(width)) / 2 * 2
+	} else {
+		cropWidth = int(float64(srcHeight)*float64(width)/float64(height)) / 2 * 2
+	}
+	if cropWidth >= srcWidth && cropHeight >= srcHeight {
+		// 比例一致，没有裁剪的余地
+		return centerCrop
+	}
+	segments, err := analyzeCropSegments(inputVideo, srcWidth, srcHeight, cropWidth, cropHeight, vertical)
+	if err != nil || len(segments) == 0 {
+		log.GetLogger().Warn("smartCropFilter 画面分析失败，使用居中裁剪", zap.String("input", inputVideo), zap.Error(err))
+		return centerCrop
+	}
+
+	// 生成分段的裁剪位置表达式 if(lt(t,t1),p0,if(lt(t,t2),p1,...))
+	var expr strings.Builder
+	for i := 0; i < len(segments)-1; i++ {
+		expr.WriteString(fmt.Sprintf("if(lt(t,%s),%d,", strconv.FormatFloat(segments[i+1].start, 'f', 2, 64), segments[i].pos))
+	}
+	expr.WriteString(strconv.Itoa(segments[len(segments)-1].pos))
+	expr.WriteString(strings.Repeat(")", len(segments)-1))
+	x, y := "'"+expr.String()+"'", "0"
+	if vertical {
+		x, y = "0", x
+	}
+	return fmt.Sprintf("crop=%d:%d:%s:%s,scale=%d:%d", cropWidth, cropHeight, x, y, width, height)
+}
+
+// cropSegment 从start秒开始使用的裁剪位置，左右裁剪时为横坐标，上下裁剪时为纵坐标
+type cropSegment struct {
+	start float64
+	pos   int
+}
+
+// analyzeCropSegments 抽取低分辨率灰度帧，按镜头累计每列（上下裁剪时为每行）的边缘和运动强度，取强度最大的窗口作为该镜头的裁剪位置
+func analyzeCropSegments(inputVideo string, srcWidth, srcHeight, cropWidth, cropHeight int, vertical bool) ([]cropSegment, error) {
+	analysisWidth, analysisHeight := reframeAnalysisSize, reframeAnalysisSize
+	if srcWidth >= srcHeight {
+		analysisHeight = max(int(math.Round(float64(srcHeight)*reframeAnalysisSize/float64(srcWidth)/2))*2, 2)
+	} else {
+		analysisWidth = max(int(math.Round(float64(srcWidth)*reframeAnalysisSize/float64(srcHeight)/2))*2, 2)
+	}
+	// 沿裁剪方向的尺寸
+	srcSize, cropSize, analysisSize := srcWidth, cropWidth, analysisWidth
+	if vertical {
+		srcSize, cropSize, analysisSize = srcHeight, cropHeight, analysisHeight
+	}
+	windowSize := max(int(math.Round(float64(cropSize)*float64(analysisSize)/float64(srcSize))), 1)
+
+	cmd := exec.Command(storage.FfmpegPath, "-v", "error", "-i", inputVideo, "-an",
+		"-vf", fmt.Sprintf("fps=%d,scale=%d:%d,format=gray", reframeAnalysisFps, analysisWidth, analysisHeight),
+		"-f", "rawvideo", "pipe:1")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err = cmd.Start(); err != nil {
+		return nil, err
+	}
+	defer cmd.Wait()
+
+	var (
+		segments    []cropSegment
+		sceneEnergy = make([]float64, analysisSize)
+		sceneStart  float64
+		prev        []byte
+	)
+	frameSize := analysisWidth * analysisHeight
+	reader := bufio.NewReaderSize(stdout, frameSize)
+	endScene := func() {
+		segments = append(segments, cropSegment{start: sceneStart, pos: cropWindowPos(sceneEnergy, windowSize, srcSize, cropSize)})
+		clear(sceneEnergy)
+	}
+	for frameIndex := 0; ; frameIndex++ {
+		frame := make([]byte, frameSize)
+		if _, err = io.ReadFull(reader, frame); err != nil {
+			break
+		}
+		if prev != nil && frameDiff(prev, frame) > reframeSceneCutThreshold {
+			endScene()
+			sceneStart = float64(frameIndex) / reframeAnalysisFps
+		}
+		for y := 0; y < analysisHeight; y++ {
+			row := frame[y*analysisWidth : (y+1)*analysisWidth]
+			for x := 1; x < analysisWidth; x++ {
+				energy := math.Abs(float64(row[x]) - float64(row[x-1]))
+				if prev != nil {
+					// 运动的区域更可能是主体，权重更高
+					energy += 2 * math.Abs(float64(row[x])-float64(prev[y*analysisWidth+x]))
+				}
+				if vertical {
+					sceneEnergy[y] += energy
+				} else {
+					sceneEnergy[x] += energy
+				}
+			}
+		}
+		prev = frame
+	}
+	if prev == nil {
+		return nil, fmt.Errorf("no frame decoded")
+	}
+	endScene()
+	return mergeCropSegments(segments, int(float64(srcSize)*reframeMergeRatio)), nil
+}
+
+// frameDiff 两帧的平均像素差
+func frameDiff(a, b []byte) float64 {
+	var sum float64
+	for i := range a {
+		sum += math.Abs(float64(a[i]) - float64(b[i]))
+	}
+	return sum / float64(len(a))
+}
+
+// bestCropWindow 返回强度之和最大的窗口的起始位置
+func bestCropWindow(energy []float64, windowSize int) int {
+	if windowSize >= len(energy) {
+		return 0
+	}
+	var sum float64
+	for i := 0; i < windowSize; i++ {
+		sum += energy[i]
+	}
+	best, bestPos := sum, 0
+	for i := windowSize; i < len(energy); i++ {
+		sum += energy[i] - energy[i-windowSize]
+		if sum > best {
+			best, bestPos = sum, i-windowSize+1
+		}
+	}
+	return bestPos
+}
+
+// cropWindowPos 把分析画面中强度最大的窗口换算为源视频中的裁剪位置，裁剪框不超出画面
+func cropWindowPos(energy []float64, windowSize, srcSize, cropSize int) int {
+	pos := bestCropWindow(energy, windowSize)
+	return min(max(int(float64(pos)*float64(srcSize)/float64(len(energy))), 0), srcSize-cropSize)
+}
+
+// mergeCropSegments 合并裁剪位置相差不超过tolerance的相邻镜头，沿用前一个镜头的位置
+func mergeCropSegments(segments []cropSegment, tolerance int) []cropSegment {
+	if len(segments) == 0 {
+		return nil
+	}
+	merged := segments[:1]
+	for _, segment := range segments[1:] {
+		last := merged[len(merged)-1]
+		if math.Abs(float64(segment.pos-last.pos)) <= float64(tolerance) {
+			continue
+		}
+		merged = append(merged, segment)
+	}
+	return merged
+}
@@ -0,0 +1,195 @@
+package service
+
+import (
+	"krillin-ai/internal/types"
+	"slices"
+	"testing"
+)
+
+func Test_parseAspectRatio(t *testing.T) {
+	tests := []struct {
+		ratio      string
+		wantWidth  int
+		wantHeight int
+		wantErr    bool
+	}{
+		{ratio: "16:9", wantWidth: 16, wantHeight: 9},
+		{ratio: " 4 : 5 ", wantWidth: 4, wantHeight: 5},
+		{ratio: "0:1", wantErr: true},
+		{ratio: "16:0", wantErr: true},
+		{ratio: "-9:16", wantErr: true},
+		{ratio: "abc", wantErr: true},
+		{ratio: "16x9", wantErr: true},
+		{ratio: "16:", wantErr: true},
+		{ratio: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		width, height, err := parseAspectRatio(tt.ratio)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseAspectRatio(%q) error = %v, wantErr %v", tt.ratio, err, tt.wantErr)
+			continue
+		}
+		if width != tt.wantWidth || height != tt.wantHeight {
+			t.Errorf("parseAspectRatio(%q) = %d, %d, want %d, %d", tt.ratio, width, height, tt.wantWidth, tt.wantHeight)
+		}
+	}
+}
+
+func Test_bestCropWindow(t *testing.T) {
+	tests := []struct {
+		name       string
+		energy     []float64
+		windowSize int
+		want       int
+	}{
+		{name: "middle", energy: []float64{0, 1, 5, 5, 1, 0}, windowSize: 2, want: 2},
+		{name: "left edge", energy: []float64{9, 9, 1, 0, 0, 0}, windowSize: 3, want: 0},
+		{name: "right edge", energy: []float64{0, 0, 0, 1, 9, 9}, windowSize: 3, want: 3},
+		{name: "ties keep first", energy: []float64{1, 1, 1, 1}, windowSize: 2, want: 0},
+		{name: "window covers frame", energy: []float64{0, 9}, windowSize: 2, want: 0},
+	}
+	for _, tt := range tests {
+		if got := bestCropWindow(tt.energy, tt.windowSize); got != tt.want {
+			t.Errorf("%s: bestCropWindow() = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func Test_cropWindowPos(t *testing.T) {
+	tests := []struct {
+		name     string
+		energy   []float64
+		window   int
+		srcSize  int
+		cropSize int
+		want     int
+	}{
+		{name: "scaled to source", energy: []float64{0, 0, 9, 9, 9, 0, 0, 0, 0, 0}, window: 3, srcSize: 1000, cropSize: 333, want: 200},
+		{name: "left edge", energy: []float64{9, 9, 9, 0, 0, 0, 0, 0, 0, 0}, window: 3, srcSize: 1000, cropSize: 333, want: 0},
+		// 窗口按分析画面取整后换算的位置超出画面，裁剪框贴住右边
+		{name: "clamped at right edge", energy: []float64{0, 0, 0, 0, 0, 0, 0, 9, 9, 9}, window: 3, srcSize: 1000, cropSize: 333, want: 667},
+	}
+	for _, tt := range tests {
+		if got := cropWindowPos(tt.energy, tt.window, tt.srcSize, tt.cropSize); got != tt.want {
+			t.Errorf("%s: cropWindowPos() = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func Test_mergeCropSegments(t *testing.T) {
+	tests := []struct {
+		name     string
+		segments []cropSegment
+		want     []cropSegment
+	}{
+		{name: "empty"},
+		{name: "single", segments: []cropSegment{{start: 0, pos: 100}}, want: []cropSegment{{start: 0, pos: 100}}},
+		{
+			name:     "same window",
+			segments: []cropSegment{{start: 0, pos: 100}, {start: 2, pos: 100}, {start: 5, pos: 100}},
+			want:     []cropSegment{{start: 0, pos: 100}},
+		},
+		{
+			// 与上一个保留的镜头比较，小幅移动不会逐步累积
+			name:     "within tolerance",
+			segments: []cropSegment{{start: 0, pos: 100}, {start: 2, pos: 110}, {start: 4, pos: 120}, {start: 6, pos: 130}},
+			want:     []cropSegment{{start: 0, pos: 100}, {start: 6, pos: 130}},
+		},
+		{
+			name:     "scene moves",
+			segments: []cropSegment{{start: 0, pos: 100}, {start: 3, pos: 500}, {start: 5, pos: 505}, {start: 8, pos: 100}},
+			want:     []cropSegment{{start: 0, pos: 100}, {start: 3, pos: 500}, {start: 8, pos: 100}},
+		},
+	}
+	for _, tt := range tests {
+		if got := mergeCropSegments(tt.segments, 20); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: mergeCropSegments() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func Test_embedAspectRatiosOf(t *testing.T) {
+	tests := []struct {
+		embedType string
+		ratios    []string
+		want      []string
+		wantErr   bool
+	}{
+		{embedType: "none"},
+		{embedType: "soft_mp4", ratios: []string{"1:1"}},
+		{embedType: "horizontal", want: []string{"16:9"}},
+		{embedType: "vertical", want: []string{"9:16"}},
+		{embedType: "all", want: []string{"16:9", "9:16"}},
+		{embedType: "horizontal", ratios: []string{"1:1", " 4 : 5", "1:1"}, want: []string{"1:1", "4:5"}},
+		{embedType: "all", ratios: []string{"1:1", "16:0"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := embedAspectRatiosOf(tt.embedType, tt.ratios)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("embedAspectRatiosOf(%s, %v) error = %v, wantErr %v", tt.embedType, tt.ratios, err, tt.wantErr)
+			continue
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("embedAspectRatiosOf(%s, %v) = %v, want %v", tt.embedType, tt.ratios, got, tt.want)
+		}
+	}
+}
+
+func Test_embedCanvasSize(t *testing.T) {
+	stepParam := &types.SubtitleTaskStepParam{VerticalVideoWidth: 720, VerticalVideoHeight: 1280}
+	tests := []struct {
+		name        string
+		ratio       string
+		srcWidth    int
+		srcHeight   int
+		wantWidth   int
+		wantHeight  int
+		wantReframe bool
+	}{
+		{name: "same ratio", ratio: "16:9", srcWidth: 1920, srcHeight: 1080, wantWidth: 1920, wantHeight: 1080},
+		{name: "same ratio odd source", ratio: "16:9", srcWidth: 1281, srcHeight: 721, wantWidth: 1280, wantHeight: 720},
+		{name: "vertical uses configured resolution", ratio: "9:16", srcWidth: 1920, srcHeight: 1080, wantWidth: 720, wantHeight: 1280, wantReframe: true},
+		{name: "square from odd source", ratio: "1:1", srcWidth: 1281, srcHeight: 721, wantWidth: 720, wantHeight: 720, wantReframe: true},
+		{name: "4:5 from odd source", ratio: "4:5", srcWidth: 1921, srcHeight: 1081, wantWidth: 1080, wantHeight: 1350, wantReframe: true},
+		{name: "long side limited", ratio: "21:9", srcWidth: 1080, srcHeight: 1920, wantWidth: 1920, wantHeight: 822, wantReframe: true},
+		{name: "portrait odd source", ratio: "3:4", srcWidth: 1919, srcHeight: 1079, wantWidth: 1078, wantHeight: 1438, wantReframe: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			width, height, reframe, err := embedCanvasSize(tt.ratio, tt.srcWidth, tt.srcHeight, stepParam)
+			if err != nil {
+				t.Fatalf("embedCanvasSize() error = %v", err)
+			}
+			if width != tt.wantWidth || height != tt.wantHeight || reframe != tt.wantReframe {
+				t.Errorf("embedCanvasSize() = %dx%d, %v, want %dx%d, %v", width, height, reframe, tt.wantWidth, tt.wantHeight, tt.wantReframe)
+			}
+			if width%2 != 0 || height%2 != 0 {
+				t.Errorf("embedCanvasSize() = %dx%d, want even size", width, height)
+			}
+		})
+	}
+	if _, _, _, err := embedCanvasSize("abc", 1920, 1080, stepParam); err == nil {
+		t.Error("embedCanvasSize(abc) error = nil, want error")
+	}
+}
+
+func Test_escapeDrawtext(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{text: "Title", want: "Title"},
+		{text: "a:b", want: `a\\:b`},
+		{text: "it's", want: `it\\\'s`},
+		{text: `a\b`, want: `a\\\\b`},
+		// drawtext使用expansion=none，百分号不需要转义
+		{text: "100%", want: "100%"},
+		{text: "a,b;[c]", want: `a\,b\;\[c\]`},
+		{text: " multi\n line ", want: "multi line"},
+	}
+	for _, tt := range tests {
+		if got := escapeDrawtext(tt.text); got != tt.want {
+			t.Errorf("escapeDrawtext(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
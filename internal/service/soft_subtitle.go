@@ -0,0 +1,188 @@
+package service
+
+import (
+	"fmt"
+	"krillin-ai/internal/storage"
+	"krillin-ai/internal/types"
+	"krillin-ai/log"
+	"krillin-ai/pkg/util"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// softSubtitleTrack 封装进视频的一条字幕轨道
+type softSubtitleTrack struct {
+	path      string
+	language  string // ISO 639-2代码
+	title     string
+	isDefault bool
+}
+
+// muxSoftSubtitles 把生成的各条字幕作为可选轨道封装进视频，音视频流直接复制不重新编码。
+// container为mp4时字幕转为mov_text，为mkv时保留srt，双语字幕额外封装一条带样式的ass轨道并附带字体。
+func muxSoftSubtitles(stepParam *types.SubtitleTaskStepParam, container string) error {
+	input := stepParam.InputVideoPath
+	if stepParam.EnableTts {
+		input = stepParam.VideoWithTtsFilePath
+	}
+	tracks, err := softSubtitleTracks(stepParam)
+	if err != nil {
+		return err
+	}
+	if len(tracks) == 0 {
+		log.GetLogger().Info("muxSoftSubtitles 没有可封装的字幕，跳过", zap.String("task id", stepParam.TaskId))
+		return nil
+	}
+
+	outputFileName := types.SubtitleTaskSoftSubtitleMp4FileName
+	subtitleCodec := "mov_text"
+	var fonts []string
+	if container == "mkv" {
+		outputFileName = types.SubtitleTaskSoftSubtitleMkvFileName
+		subtitleCodec = "copy"
+		if isBilingualResult(stepParam.SubtitleResultType) {
+			var assTrack softSubtitleTrack
+			assTrack, fonts, err = softSubtitleAssTrack(stepParam, input, tracks)
+			if err != nil {
+				return err
+			}
+			tracks = append(tracks, assTrack)
+		}
+	}
+
+	outputPath := filepath.Join(stepParam.TaskBasePath, "output", outputFileName)
+	cmdArgs := softSubtitleArgs(input, outputPath, tracks, subtitleCodec, fonts)
+
+	output, err := exec.Command(storage.FfmpegPath, cmdArgs...).CombinedOutput()
+	if err != nil {
+		log.GetLogger().Error("muxSoftSubtitles ffmpeg error", zap.String("task id", stepParam.TaskId), zap.String("output", string(output)), zap.Error(err))
+		return fmt.Errorf("muxSoftSubtitles ffmpeg error: %w", err)
+	}
+	log.GetLogger().Info("软字幕封装成功", zap.String("task id", stepParam.TaskId), zap.String("output", outputPath), zap.Int("tracks", len(tracks)))
+	return nil
+}
+
+// softSubtitleArgs 生成封装字幕轨道的ffmpeg参数，只有默认轨道设置default标记
+func softSubtitleArgs(input, outputPath string, tracks []softSubtitleTrack, subtitleCodec string, fonts []string) []string {
+	cmdArgs := []string{"-y", "-i", input}
+	for _, track := range tracks {
+		cmdArgs = append(cmdArgs, "-i", track.path)
+	}
+	cmdArgs = append(cmdArgs, "-map", "0:v:0", "-map", "0:a?")
+	for i := range tracks {
+		cmdArgs = append(cmdArgs, "-map", fmt.Sprintf("%d:0", i+1))
+	}
+	cmdArgs = append(cmdArgs, "-c:v", "copy", "-c:a", "copy", "-c:s", subtitleCodec)
+	for i, track := range tracks {
+		disposition := "0"
+		if track.isDefault {
+			disposition = "default"
+		}
+		cmdArgs = append(cmdArgs,
+			fmt.Sprintf("-metadata:s:s:%d", i), "language="+track.language,
+			fmt.Sprintf("-metadata:s:s:%d", i), "title="+track.title,
+			fmt.Sprintf("-disposition:s:%d", i), disposition,
+		)
+	}
+	for i, font := range fonts {
+		cmdArgs = append(cmdArgs, "-attach", font, fmt.Sprintf("-metadata:s:t:%d", i), "mimetype="+fontMimeType(font))
+	}
+	return append(cmdArgs, outputPath)
+}
+
+// softSubtitleTracks 按原语言、目标语言、双语的顺序整理字幕轨道，默认显示目标语言字幕
+func softSubtitleTracks(stepParam *types.SubtitleTaskStepParam) ([]softSubtitleTrack, error) {
+	var tracks []softSubtitleTrack
+	for _, info := range stepParam.SubtitleInfos {
+		path := info.Path
+		if len(stepParam.ReplaceWordsMap) > 0 {
+			replacedSrcFile := util.AddSuffixToFileName(path, "_replaced")
+			if err := util.ReplaceFileContent(path, replacedSrcFile, stepParam.ReplaceWordsMap); err != nil {
+				return nil, fmt.Errorf("softSubtitleTracks ReplaceFileContent err: %w", err)
+			}
+			path = replacedSrcFile
+		}
+		language := types.StandardLanguageCode(info.LanguageIdentifier)
+		if info.LanguageIdentifier == "bilingual" {
+			language = stepParam.TargetLanguage
+		}
+		title := info.Name
+		if title == "" {
+			title = types.GetStandardLanguageName(language)
+		}
+		tracks = append(tracks, softSubtitleTrack{
+			path:     path,
+			language: types.GetIso6392Code(language),
+			title:    title,
+		})
+	}
+	if len(tracks) == 0 {
+		return tracks, nil
+	}
+	defaultIndex := 0
+	for i, info := range stepParam.SubtitleInfos {
+		if info.LanguageIdentifier == string(stepParam.TargetLanguage) {
+			defaultIndex = i
+			break
+		}
+	}
+	tracks[defaultIndex].isDefault = true
+	return tracks, nil
+}
+
+// softSubtitleAssTrack 用任务的字幕样式把双语字幕转为ass轨道，返回需要附带的字体文件
+func softSubtitleAssTrack(stepParam *types.SubtitleTaskStepParam, input string, tracks []softSubtitleTrack) (softSubtitleTrack, []string, error) {
+	width, height, err := getResolution(input)
+	if err != nil {
+		return softSubtitleTrack{}, nil, fmt.Errorf("softSubtitleAssTrack getResolution error: %w", err)
+	}
+	var bilingualSrt softSubtitleTrack
+	for i, info := range stepParam.SubtitleInfos {
+		if info.LanguageIdentifier == "bilingual" {
+			bilingualSrt = tracks[i]
+		}
+	}
+	if bilingualSrt.path == "" {
+		return softSubtitleTrack{}, nil, fmt.Errorf("softSubtitleAssTrack bilingual subtitle not found")
+	}
+	isHorizontal := width >= height
+	assPath := filepath.Join(stepParam.TaskBasePath, "soft_subtitles.ass")
+	if err = srtToAss(bilingualSrt.path, assPath, isHorizontal, width, height, stepParam); err != nil {
+		return softSubtitleTrack{}, nil, fmt.Errorf("softSubtitleAssTrack srtToAss error: %w", err)
+	}
+
+	major, minor, err := subtitleAssStyles(stepParam.SubtitleStyle, isHorizontal)
+	if err != nil {
+		return softSubtitleTrack{}, nil, err
+	}
+	var fonts []string
+	for _, style := range []assStyle{major, minor} {
+		font := style.fontFile
+		if font == "" {
+			font = matchFontFile(style.fontName, style.bold)
+		}
+		if font != "" && !slices.Contains(fonts, font) {
+			fonts = append(fonts, font)
+		}
+	}
+	return softSubtitleTrack{
+		path:     assPath,
+		language: bilingualSrt.language,
+		title:    bilingualSrt.title + " (ASS)",
+	}, fonts, nil
+}
+
+func isBilingualResult(resultType types.SubtitleResultType) bool {
+	return resultType == types.SubtitleResultTypeBilingualTranslationOnTop || resultType == types.SubtitleResultTypeBilingualTranslationOnBottom
+}
+
+func fontMimeType(font string) string {
+	if strings.EqualFold(filepath.Ext(font), ".otf") {
+		return "application/vnd.ms-opentype"
+	}
+	return "application/x-truetype-font"
+}
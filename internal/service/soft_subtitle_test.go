@@ -0,0 +1,111 @@
+package service
+
+import (
+	"krillin-ai/internal/types"
+	"slices"
+	"testing"
+)
+
+func Test_softSubtitleTracks(t *testing.T) {
+	tests := []struct {
+		name          string
+		infos         []types.SubtitleFileInfo
+		wantLanguages []string
+		wantTitles    []string
+		wantDefault   int
+	}{
+		{
+			name:          "origin only",
+			infos:         []types.SubtitleFileInfo{{Path: "origin.srt", LanguageIdentifier: "en", Name: "English Subtitle"}},
+			wantLanguages: []string{"eng"},
+			wantTitles:    []string{"English Subtitle"},
+			wantDefault:   0,
+		},
+		{
+			name: "target only",
+			infos: []types.SubtitleFileInfo{
+				{Path: "origin.srt", LanguageIdentifier: "en"},
+				{Path: "target.srt", LanguageIdentifier: "zh_cn"},
+			},
+			wantLanguages: []string{"eng", "chi"},
+			wantTitles:    []string{types.GetStandardLanguageName("en"), types.GetStandardLanguageName("zh_cn")},
+			wantDefault:   1,
+		},
+		{
+			name: "bilingual",
+			infos: []types.SubtitleFileInfo{
+				{Path: "origin.srt", LanguageIdentifier: "en", Name: "English 单语字幕"},
+				{Path: "target.srt", LanguageIdentifier: "zh_cn", Name: "简体中文 单语字幕"},
+				{Path: "bilingual.srt", LanguageIdentifier: "bilingual", Name: "双语字幕"},
+			},
+			// 双语字幕标记为目标语言，默认显示目标语言单语字幕
+			wantLanguages: []string{"eng", "chi", "chi"},
+			wantTitles:    []string{"English 单语字幕", "简体中文 单语字幕", "双语字幕"},
+			wantDefault:   1,
+		},
+		{
+			name:          "unknown language",
+			infos:         []types.SubtitleFileInfo{{Path: "origin.srt", LanguageIdentifier: "xx", Name: "xx"}},
+			wantLanguages: []string{"und"},
+			wantTitles:    []string{"xx"},
+			wantDefault:   0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stepParam := &types.SubtitleTaskStepParam{
+				OriginLanguage: "en",
+				TargetLanguage: "zh_cn",
+				SubtitleInfos:  tt.infos,
+			}
+			tracks, err := softSubtitleTracks(stepParam)
+			if err != nil {
+				t.Fatalf("softSubtitleTracks() error = %v", err)
+			}
+			var languages, titles []string
+			for i, track := range tracks {
+				languages = append(languages, track.language)
+				titles = append(titles, track.title)
+				if track.path != tt.infos[i].Path {
+					t.Errorf("track %d path = %s, want %s", i, track.path, tt.infos[i].Path)
+				}
+				if track.isDefault != (i == tt.wantDefault) {
+					t.Errorf("track %d isDefault = %v, want %v", i, track.isDefault, i == tt.wantDefault)
+				}
+			}
+			if !slices.Equal(languages, tt.wantLanguages) {
+				t.Errorf("languages = %v, want %v", languages, tt.wantLanguages)
+			}
+			if !slices.Equal(titles, tt.wantTitles) {
+				t.Errorf("titles = %v, want %v", titles, tt.wantTitles)
+			}
+		})
+	}
+
+	tracks, err := softSubtitleTracks(&types.SubtitleTaskStepParam{})
+	if err != nil || len(tracks) != 0 {
+		t.Errorf("softSubtitleTracks() without subtitles = %v, %v, want no tracks", tracks, err)
+	}
+}
+
+func Test_softSubtitleArgs(t *testing.T) {
+	tracks := []softSubtitleTrack{
+		{path: "origin.srt", language: "eng", title: "English"},
+		{path: "target.srt", language: "chi", title: "中文", isDefault: true},
+		{path: "bilingual.ass", language: "chi", title: "双语 (ASS)"},
+	}
+	got := softSubtitleArgs("input.mp4", "output.mkv", tracks, "copy", []string{"font.otf"})
+	want := []string{
+		"-y", "-i", "input.mp4", "-i", "origin.srt", "-i", "target.srt", "-i", "bilingual.ass",
+		"-map", "0:v:0", "-map", "0:a?", "-map", "1:0", "-map", "2:0", "-map", "3:0",
+		"-c:v", "copy", "-c:a", "copy", "-c:s", "copy",
+		"-metadata:s:s:0", "language=eng", "-metadata:s:s:0", "title=English", "-disposition:s:0", "0",
+		"-metadata:s:s:1", "language=chi", "-metadata:s:s:1", "title=中文", "-disposition:s:1", "default",
+		"-metadata:s:s:2", "language=chi", "-metadata:s:s:2", "title=双语 (ASS)", "-disposition:s:2", "0",
+		"-attach", "font.otf", "-metadata:s:t:0", "mimetype=application/vnd.ms-opentype",
+		"output.mkv",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("softSubtitleArgs() =\n%q\nwant\n%q", got, want)
+	}
+}
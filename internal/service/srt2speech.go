@@ -3,6 +3,7 @@ package service
 import (
 	"context"
 	"fmt"
+	"krillin-ai/config"
 	"krillin-ai/internal/storage"
 	"krillin-ai/internal/types"
 	"krillin-ai/log"
@@ -30,29 +31,28 @@ func (s Service) srtFileToSpeech(ctx context.Context, stepParam *types.SubtitleT
 		return fmt.Errorf("srtFileToSpeech parseSRT error: %w", err)
 	}
 
-	var audioFiles []string
-	var currentTime time.Time
-
-	// 创建文件记录音频的开始和结束时间
-	durationDetailFile, err := os.Create(filepath.Join(stepParam.TaskBasePath, types.TtsAudioDurationDetailsFileName))
-	if err != nil {
-		log.GetLogger().Error("srtFileToSpeech create durationDetailFile error", zap.Any("stepParam", stepParam), zap.Error(err))
-		return fmt.Errorf("srtFileToSpeech create durationDetailFile error: %w", err)
-	}
-	defer durationDetailFile.Close()
-
 	// Step 2: 使用 阿里云TTS
 	// 判断是否使用音色克隆
 	voiceCode := stepParam.TtsVoiceCode
-	if stepParam.VoiceCloneAudioUrl != "" {
+	voiceCloneSrc := stepParam.VoiceCloneSrcFilePath
+	if voiceCloneSrc == "" && stepParam.VoiceCloneFromSource {
+		voiceCloneSrc = filepath.Join(stepParam.TaskBasePath, types.SubtitleTaskVoiceCloneSampleFileName)
+		err = extractVoiceCloneSample(stepParam.AudioFilePath, voiceCloneSrc)
+		if err != nil {
+			log.GetLogger().Error("srtFileToSpeech extractVoiceCloneSample error", zap.Any("stepParam", stepParam), zap.Error(err))
+			return fmt.Errorf("srtFileToSpeech extractVoiceCloneSample error: %w", err)
+		}
+	}
+	if voiceCloneSrc != "" {
 		var code string
-		code, err = s.VoiceCloneClient.CosyVoiceClone("krillinai", stepParam.VoiceCloneAudioUrl)
+		code, err = s.cloneVoice(voiceCloneSrc)
 		if err != nil {
-			log.GetLogger().Error("srtFileToSpeech CosyVoiceClone error", zap.Any("stepParam", stepParam), zap.Error(err))
-			return fmt.Errorf("srtFileToSpeech CosyVoiceClone error: %w", err)
+			log.GetLogger().Error("srtFileToSpeech cloneVoice error", zap.Any("stepParam", stepParam), zap.Error(err))
+			return fmt.Errorf("srtFileToSpeech cloneVoice error: %w", err)
 		}
 		voiceCode = code
 	}
+	stepParam.TtsResolvedVoiceCode = voiceCode
 
 	// 并发处理TTS转换
 	err = s.processSubtitlesConcurrently(subtitles, voiceCode, stepParam)
@@ -61,19 +61,41 @@ func (s Service) srtFileToSpeech(ctx context.Context, stepParam *types.SubtitleT
 		return fmt.Errorf("srtFileToSpeech processSubtitlesConcurrently error: %w", err)
 	}
 
+	if err = buildTtsAudio(subtitles, stepParam); err != nil {
+		return fmt.Errorf("srtFileToSpeech %w", err)
+	}
+	// 更新字幕任务信息
+	stepParam.TaskPtr.ProcessPct = 98
+	log.GetLogger().Info("srtFileToSpeech success", zap.String("task id", stepParam.TaskId))
+	return nil
+}
+
+// buildTtsAudio 按字幕时间轴对齐每句配音，拼接成完整音频并替换进源视频
+func buildTtsAudio(subtitles []types.SrtSentenceWithStrTime, stepParam *types.SubtitleTaskStepParam) error {
+	var audioFiles []string
+	var currentTime time.Time
+
+	// 创建文件记录音频的开始和结束时间
+	durationDetailFile, err := os.Create(filepath.Join(stepParam.TaskBasePath, types.TtsAudioDurationDetailsFileName))
+	if err != nil {
+		log.GetLogger().Error("buildTtsAudio create durationDetailFile error", zap.Any("stepParam", stepParam), zap.Error(err))
+		return fmt.Errorf("buildTtsAudio create durationDetailFile error: %w", err)
+	}
+	defer durationDetailFile.Close()
+
 	for i, sub := range subtitles {
 		outputFile := filepath.Join(stepParam.TaskBasePath, fmt.Sprintf("subtitle_%d.wav", i+1))
 
 		// Step 3: 调整音频时长
 		startTime, err := time.Parse("15:04:05,000", sub.Start)
 		if err != nil {
-			log.GetLogger().Error("srtFileToSpeech parse time error", zap.Any("stepParam", stepParam), zap.Any("num", i+1), zap.String("time str", sub.Start), zap.Error(err))
-			return fmt.Errorf("srtFileToSpeech parse time error: %w", err)
+			log.GetLogger().Error("buildTtsAudio parse time error", zap.Any("stepParam", stepParam), zap.Any("num", i+1), zap.String("time str", sub.Start), zap.Error(err))
+			return fmt.Errorf("buildTtsAudio parse time error: %w", err)
 		}
 		endTime, err := time.Parse("15:04:05,000", sub.End)
 		if err != nil {
-			log.GetLogger().Error("audioToSubtitle.time.Parse error", zap.Any("stepParam", stepParam), zap.Any("num", i+1), zap.String("time str", sub.Start), zap.Error(err))
-			return fmt.Errorf("srtFileToSpeech audioToSubtitle.time.Parse error: %w", err)
+			log.GetLogger().Error("buildTtsAudio parse time error", zap.Any("stepParam", stepParam), zap.Any("num", i+1), zap.String("time str", sub.Start), zap.Error(err))
+			return fmt.Errorf("buildTtsAudio parse time error: %w", err)
 		}
 		if i == 0 {
 			// 如果第一条字幕不是从00:00开始，增加静音帧
@@ -82,8 +104,8 @@ func (s Service) srtFileToSpeech(ctx context.Context, stepParam *types.SubtitleT
 				silenceFilePath := filepath.Join(stepParam.TaskBasePath, "silence_0.wav")
 				err := newGenerateSilence(silenceFilePath, float64(silenceDurationMs)/1000)
 				if err != nil {
-					log.GetLogger().Error("srtFileToSpeech newGenerateSilence error", zap.Any("stepParam", stepParam), zap.Error(err))
-					return fmt.Errorf("srtFileToSpeech newGenerateSilence error: %w", err)
+					log.GetLogger().Error("buildTtsAudio newGenerateSilence error", zap.Any("stepParam", stepParam), zap.Error(err))
+					return fmt.Errorf("buildTtsAudio newGenerateSilence error: %w", err)
 				}
 				audioFiles = append(audioFiles, silenceFilePath)
 
@@ -99,8 +121,8 @@ func (s Service) srtFileToSpeech(ctx context.Context, stepParam *types.SubtitleT
 			// 如果不是最后一条字幕，增加静音帧时长
 			nextStartTime, err := time.Parse("15:04:05,000", subtitles[i+1].Start)
 			if err != nil {
-				log.GetLogger().Error("srtFileToSpeech parse time error", zap.Any("stepParam", stepParam), zap.Any("num", i+2), zap.String("time str", subtitles[i+1].Start), zap.Error(err))
-				return fmt.Errorf("srtFileToSpeech parse time error: %w", err)
+				log.GetLogger().Error("buildTtsAudio parse time error", zap.Any("stepParam", stepParam), zap.Any("num", i+2), zap.String("time str", subtitles[i+1].Start), zap.Error(err))
+				return fmt.Errorf("buildTtsAudio parse time error: %w", err)
 			}
 			if endTime.Before(nextStartTime) {
 				duration = nextStartTime.Sub(startTime).Seconds()
@@ -110,8 +132,8 @@ func (s Service) srtFileToSpeech(ctx context.Context, stepParam *types.SubtitleT
 		adjustedFile := filepath.Join(stepParam.TaskBasePath, fmt.Sprintf("adjusted_%d.wav", i+1))
 		err = adjustAudioDuration(outputFile, adjustedFile, stepParam.TaskBasePath, duration)
 		if err != nil {
-			log.GetLogger().Error("srtFileToSpeech adjustAudioDuration error", zap.Any("stepParam", stepParam), zap.Any("num", i+1), zap.Error(err))
-			return fmt.Errorf("srtFileToSpeech adjustAudioDuration error: %w", err)
+			log.GetLogger().Error("buildTtsAudio adjustAudioDuration error", zap.Any("stepParam", stepParam), zap.Any("num", i+1), zap.Error(err))
+			return fmt.Errorf("buildTtsAudio adjustAudioDuration error: %w", err)
 		}
 
 		audioFiles = append(audioFiles, adjustedFile)
@@ -119,8 +141,8 @@ func (s Service) srtFileToSpeech(ctx context.Context, stepParam *types.SubtitleT
 		// 计算音频的实际时长
 		audioDuration, err := util.GetAudioDuration(adjustedFile)
 		if err != nil {
-			log.GetLogger().Error("srtFileToSpeech GetAudioDuration error", zap.Any("stepParam", stepParam), zap.Any("num", i+1), zap.Error(err))
-			return fmt.Errorf("srtFileToSpeech GetAudioDuration error: %w", err)
+			log.GetLogger().Error("buildTtsAudio GetAudioDuration error", zap.Any("stepParam", stepParam), zap.Any("num", i+1), zap.Error(err))
+			return fmt.Errorf("buildTtsAudio GetAudioDuration error: %w", err)
 		}
 
 		// 计算音频的结束时间
@@ -134,8 +156,8 @@ func (s Service) srtFileToSpeech(ctx context.Context, stepParam *types.SubtitleT
 	finalOutput := filepath.Join(stepParam.TaskBasePath, types.TtsResultAudioFileName)
 	err = concatenateAudioFiles(audioFiles, finalOutput, stepParam.TaskBasePath)
 	if err != nil {
-		log.GetLogger().Error("srtFileToSpeech concatenateAudioFiles error", zap.Any("stepParam", stepParam), zap.Error(err))
-		return fmt.Errorf("srtFileToSpeech concatenateAudioFiles error: %w", err)
+		log.GetLogger().Error("buildTtsAudio concatenateAudioFiles error", zap.Any("stepParam", stepParam), zap.Error(err))
+		return fmt.Errorf("buildTtsAudio concatenateAudioFiles error: %w", err)
 	}
 	stepParam.TtsResultFilePath = finalOutput
 
@@ -143,23 +165,22 @@ func (s Service) srtFileToSpeech(ctx context.Context, stepParam *types.SubtitleT
 	// 合成音频替换后的新视频
 	err = util.ReplaceAudioInVideo(stepParam.InputVideoPath, finalOutput, videoWithTtsPath)
 	if err != nil {
-		log.GetLogger().Error("srtFileToSpeech ReplaceAudioInVideo error", zap.Any("stepParam", stepParam), zap.Error(err))
+		log.GetLogger().Error("buildTtsAudio ReplaceAudioInVideo error", zap.Any("stepParam", stepParam), zap.Error(err))
 	}
 	stepParam.VideoWithTtsFilePath = videoWithTtsPath
-	// 更新字幕任务信息
-	stepParam.TaskPtr.ProcessPct = 98
-	log.GetLogger().Info("srtFileToSpeech success", zap.String("task id", stepParam.TaskId))
 	return nil
 }
 
 func (s Service) processSubtitlesConcurrently(subtitles []types.SrtSentenceWithStrTime, voiceCode string, stepParam *types.SubtitleTaskStepParam) error {
 	// 创建一个结果数组来存储每个字幕的处理结果
 	type processingResult struct {
-		index int
-		err   error
+		index    int
+		err      error
+		cacheHit bool
 	}
 
-	maxConcurrency := 3 // 降低并发数以减少网络压力
+	// 实际的请求并发和速率由提供商的共享限流器控制
+	maxConcurrency := config.Conf.Tts.LimitOf(config.Conf.Tts.Provider).Concurrency
 	semaphore := make(chan struct{}, maxConcurrency)
 	var wg sync.WaitGroup
 	resultCh := make(chan processingResult, len(subtitles))
@@ -175,7 +196,7 @@ func (s Service) processSubtitlesConcurrently(subtitles []types.SrtSentenceWithS
 			defer func() { <-semaphore }()
 
 			outputFile := filepath.Join(stepParam.TaskBasePath, fmt.Sprintf("subtitle_%d.wav", index+1))
-			err := s.TtsClient.Text2Speech(subtitle.Text, voiceCode, outputFile)
+			cacheHit, err := s.synthesize(s.TtsClient, config.Conf.Tts.Provider, subtitle.Text, voiceCode, outputFile)
 			if err != nil {
 				log.GetLogger().Error("processSubtitlesConcurrently Text2Speech error",
 					zap.Any("index", index+1),
@@ -186,7 +207,7 @@ func (s Service) processSubtitlesConcurrently(subtitles []types.SrtSentenceWithS
 			}
 
 			// 成功处理
-			resultCh <- processingResult{index: index, err: nil}
+			resultCh <- processingResult{index: index, err: nil, cacheHit: cacheHit}
 		}(i, sub)
 	}
 
@@ -197,10 +218,14 @@ func (s Service) processSubtitlesConcurrently(subtitles []types.SrtSentenceWithS
 	// 收集所有结果并统计错误
 	results := make([]processingResult, len(subtitles))
 	errorCount := 0
+	cacheHitCount := 0
 	var firstError error
 
 	for result := range resultCh {
 		results[result.index] = result
+		if result.cacheHit {
+			cacheHitCount++
+		}
 		if result.err != nil {
 			errorCount++
 			if firstError == nil {
@@ -208,6 +233,24 @@ func (s Service) processSubtitlesConcurrently(subtitles []types.SrtSentenceWithS
 			}
 		}
 	}
+	failedSentences := make([]types.TtsFailedSentence, 0, errorCount)
+	for i, result := range results {
+		if result.err != nil {
+			failedSentences = append(failedSentences, types.TtsFailedSentence{
+				Index:  i + 1,
+				Text:   subtitles[i].Text,
+				Reason: result.err.Error(),
+			})
+		}
+	}
+	stepParam.TaskPtr.TtsFailedSentences = failedSentences
+
+	stepParam.TaskPtr.TtsCacheHitNum = cacheHitCount
+	stepParam.TaskPtr.TtsCacheMissNum = len(subtitles) - cacheHitCount - errorCount
+	log.GetLogger().Info("processSubtitlesConcurrently tts cache stats",
+		zap.String("task id", stepParam.TaskId),
+		zap.Int("hit", cacheHitCount),
+		zap.Int("miss", stepParam.TaskPtr.TtsCacheMissNum))
 
 	// 如果有超过一半的字幕失败，则返回错误
 	failureThreshold := len(subtitles) / 2
@@ -5,15 +5,16 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"krillin-ai/config"
 	"krillin-ai/internal/storage"
 	"krillin-ai/internal/types"
 	"krillin-ai/log"
 	"krillin-ai/pkg/util"
+	"math"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"regexp"
-	"runtime"
 	"strconv"
 	"strings"
 	"time"
@@ -23,42 +24,39 @@ import (
 
 func (s Service) embedSubtitles(ctx context.Context, stepParam *types.SubtitleTaskStepParam) error {
 	var err error
-	if stepParam.EmbedSubtitleVideoType == "horizontal" || stepParam.EmbedSubtitleVideoType == "vertical" || stepParam.EmbedSubtitleVideoType == "all" {
+	if stepParam.EmbedSubtitleVideoType == "soft_mp4" || stepParam.EmbedSubtitleVideoType == "soft_mkv" {
+		log.GetLogger().Info("合成视频：软字幕", zap.String("type", stepParam.EmbedSubtitleVideoType))
+		err = muxSoftSubtitles(stepParam, strings.TrimPrefix(stepParam.EmbedSubtitleVideoType, "soft_"))
+		if err != nil {
+			log.GetLogger().Error("embedSubtitles muxSoftSubtitles error", zap.Any("step param", stepParam), zap.Error(err))
+			return fmt.Errorf("embedSubtitles muxSoftSubtitles error: %w", err)
+		}
+		return nil
+	}
+	if len(stepParam.EmbedAspectRatios) > 0 {
+		input := stepParam.InputVideoPath
+		if stepParam.EnableTts {
+			input = stepParam.VideoWithTtsFilePath
+		}
 		var width, height int
-		width, height, err = getResolution(stepParam.InputVideoPath)
+		width, height, err = getResolution(input)
 		if err != nil {
 			log.GetLogger().Error("embedSubtitles getResolution error", zap.Any("step param", stepParam), zap.Error(err))
 			return fmt.Errorf("embedSubtitles getResolution error: %w", err)
 		}
 
-		// 横屏可以合成竖屏的，但竖屏暂时不支持合成横屏的
-		if stepParam.EmbedSubtitleVideoType == "horizontal" || stepParam.EmbedSubtitleVideoType == "all" {
-			if width < height {
-				log.GetLogger().Info("检测到输入视频是竖屏，无法合成横屏视频，跳过")
-				return nil
-			}
-			log.GetLogger().Info("合成视频：横屏")
-			err = embedSubtitles(stepParam, true, stepParam.EnableTts)
-			if err != nil {
-				log.GetLogger().Error("embedSubtitles embedSubtitles error", zap.Any("step param", stepParam), zap.Error(err))
-				return fmt.Errorf("embedSubtitles embedSubtitles error: %w", err)
-			}
+		var profile config.EncodingProfile
+		profile, err = config.Conf.Encoding.ProfileOf(stepParam.EncodingProfile)
+		if err != nil {
+			return fmt.Errorf("embedSubtitles %w", err)
 		}
-		if stepParam.EmbedSubtitleVideoType == "vertical" || stepParam.EmbedSubtitleVideoType == "all" {
-			if width > height {
-				// 生成竖屏视频
-				transferredVerticalVideoPath := filepath.Join(stepParam.TaskBasePath, types.SubtitleTaskTransferredVerticalVideoFileName)
-				err = convertToVertical(stepParam.InputVideoPath, transferredVerticalVideoPath, stepParam.VerticalVideoMajorTitle, stepParam.VerticalVideoMinorTitle)
-				if err != nil {
-					log.GetLogger().Error("embedSubtitles convertToVertical error", zap.Any("step param", stepParam), zap.Error(err))
-					return fmt.Errorf("embedSubtitles convertToVertical error: %w", err)
-				}
-				stepParam.InputVideoPath = transferredVerticalVideoPath
-			}
-			log.GetLogger().Info("合成视频：竖屏")
-			err = embedSubtitles(stepParam, false, stepParam.EnableTts)
+		// 每个画面比例编码一次，用于折算进度
+		progress := newEncodeProgress(stepParam.TaskPtr, len(stepParam.EmbedAspectRatios))
+		for _, ratio := range stepParam.EmbedAspectRatios {
+			log.GetLogger().Info("合成视频", zap.String("aspect ratio", ratio))
+			err = embedSubtitles(stepParam, input, width, height, ratio, profile, progress)
 			if err != nil {
-				log.GetLogger().Error("embedSubtitles embedSubtitles error", zap.Any("step param", stepParam), zap.Error(err))
+				log.GetLogger().Error("embedSubtitles embedSubtitles error", zap.Any("step param", stepParam), zap.String("aspect ratio", ratio), zap.Error(err))
 				return fmt.Errorf("embedSubtitles embedSubtitles error: %w", err)
 			}
 		}
@@ -69,64 +67,6 @@ func (s Service) embedSubtitles(ctx context.Context, stepParam *types.SubtitleTa
 	return nil
 }
 
-func splitMajorTextInHorizontal(text string, language types.StandardLanguageCode, maxWordOneLine int) []string {
-	// 按语言情况分割
-	var (
-		segments []string
-		sep      string
-	)
-	if language == types.LanguageNameSimplifiedChinese || language == types.LanguageNameTraditionalChinese ||
-		language == types.LanguageNameJapanese || language == types.LanguageNameKorean || language == types.LanguageNameThai {
-		segments = regexp.MustCompile(`.`).FindAllString(text, -1)
-		sep = ""
-	} else {
-		segments = strings.Split(text, " ")
-		sep = " "
-	}
-
-	totalWidth := len(segments)
-
-	// 直接返回原句子
-	if totalWidth <= maxWordOneLine {
-		return []string{text}
-	}
-
-	// 确定拆分点，按2/5和3/5的比例拆分
-	line1MaxWidth := int(float64(totalWidth) * 2 / 5)
-	currentWidth := 0
-	splitIndex := 0
-
-	for i := range segments {
-		currentWidth++
-
-		// 当达到 2/5 宽度时，设置拆分点
-		if currentWidth >= line1MaxWidth {
-			splitIndex = i + 1
-			break
-		}
-	}
-
-	// 分割文本，保留原有句子格式
-
-	line1 := util.CleanPunction(strings.Join(segments[:splitIndex], sep))
-	line2 := util.CleanPunction(strings.Join(segments[splitIndex:], sep))
-
-	return []string{line1, line2}
-}
-
-func splitChineseText(text string, maxWordLine int) []string {
-	var lines []string
-	words := []rune(text)
-	for i := 0; i < len(words); i += maxWordLine {
-		end := i + maxWordLine
-		if end > len(words) {
-			end = len(words)
-		}
-		lines = append(lines, string(words[i:end]))
-	}
-	return lines
-}
-
 func parseSrtTime(timeStr string) (time.Duration, error) {
 	timeStr = strings.Replace(timeStr, ",", ".", 1)
 	parts := strings.Split(timeStr, ":")
@@ -171,7 +111,11 @@ func formatTimestamp(t time.Duration) string {
 	return fmt.Sprintf("%02d:%02d:%02d.%02d", hours, minutes, seconds, milliseconds)
 }
 
-func srtToAss(inputSRT, outputASS string, isHorizontal bool, stepParam *types.SubtitleTaskStepParam) error {
+func srtToAss(inputSRT, outputASS string, isHorizontal bool, width, height int, stepParam *types.SubtitleTaskStepParam) error {
+	majorStyle, minorStyle, err := subtitleAssStyles(stepParam.SubtitleStyle, isHorizontal)
+	if err != nil {
+		return fmt.Errorf("srtToAss subtitle style error: %w", err)
+	}
 	file, err := os.Open(inputSRT)
 	if err != nil {
 		log.GetLogger().Error("srtToAss Open input srt error", zap.Error(err))
@@ -187,8 +131,10 @@ func srtToAss(inputSRT, outputASS string, isHorizontal bool, stepParam *types.Su
 	defer assFile.Close()
 	scanner := bufio.NewScanner(file)
 
+	scale := assCanvasScale(width, height, isHorizontal)
+	_, _ = assFile.WriteString(buildAssHeader(width, height, scale, majorStyle, minorStyle))
 	if isHorizontal {
-		_, _ = assFile.WriteString(types.AssHeaderHorizontal)
+		majorLayout := newSubtitleLayout(stepParam.MaxWordOneLine)
 		for scanner.Scan() {
 			line := scanner.Text()
 			if line == "" {
@@ -229,24 +175,27 @@ func srtToAss(inputSRT, outputASS string, isHorizontal bool, stepParam *types.Su
 			if len(subtitleLines) < 2 {
 				continue
 			}
-			//var majorTextLanguage types.StandardLanguageCode
-			//if stepParam.SubtitleResultType == types.SubtitleResultTypeBilingualTranslationOnTop { // 一定是bilingual
-			//	majorTextLanguage = stepParam.TargetLanguage
-			//} else {
-			//	majorTextLanguage = stepParam.OriginLanguage
-			//}
-
-			//majorLine := strings.Join(splitMajorTextInHorizontal(subtitleLines[0], majorTextLanguage, stepParam.MaxWordOneLine), "      \\N")
+			// 主字幕按排版限制折行，双语字幕需要同时显示，不拆分时间
+			majorTextLanguage := stepParam.OriginLanguage
+			if stepParam.SubtitleResultType == types.SubtitleResultTypeBilingualTranslationOnTop {
+				majorTextLanguage = stepParam.TargetLanguage
+			}
+			majorLines, _ := majorLayout.wrapLines(wordsOfText(subtitleLines[0], wordSeparator(majorTextLanguage)), wordSeparator(majorTextLanguage))
 
 			// ASS条目
 			startFormatted := formatTimestamp(startTime)
 			endFormatted := formatTimestamp(endTime)
-			combinedText := fmt.Sprintf("{\\an2}{\\rMajor}%s\\N{\\rMinor}%s", subtitleLines[0], util.CleanPunction(subtitleLines[1]))
+			combinedText := fmt.Sprintf("{\\an%d}{\\rMajor}%s\\N{\\rMinor}%s", majorStyle.alignment, strings.Join(majorLines, "\\N"), util.CleanPunction(subtitleLines[1]))
 			_, _ = assFile.WriteString(fmt.Sprintf("Dialogue: 0,%s,%s,Major,,0,0,0,,%s\n", startFormatted, endFormatted, combinedText))
 		}
 	} else {
-		// TODO 竖屏拆分调优
-		_, _ = assFile.WriteString(types.AssHeaderVertical)
+		// 竖屏每行的宽度随画面宽度变化，副样式字号较小，每行可以多放一些
+		majorLayout := newSubtitleLayout(stepParam.MaxWordOneLine)
+		majorLayout.maxLineWidth = float64(2 * assVerticalLineChars(width, scale))
+		minorLayout := majorLayout
+		if minorStyle.fontSize > 0 {
+			minorLayout.maxLineWidth = math.Floor(majorLayout.maxLineWidth * majorStyle.fontSize / minorStyle.fontSize)
+		}
 		for scanner.Scan() {
 			line := scanner.Text()
 			if line == "" {
@@ -278,75 +227,75 @@ func srtToAss(inputSRT, outputASS string, isHorizontal bool, stepParam *types.Su
 			if content == "" {
 				continue
 			}
-			totalTime := endTime - startTime
-
-			if !util.ContainsAlphabetic(content) {
-				// 处理中文字幕
-				chineseLines := splitChineseText(content, 10)
-				for i, line := range chineseLines {
-					iStart := startTime + time.Duration(float64(i)*float64(totalTime)/float64(len(chineseLines)))
-					iEnd := startTime + time.Duration(float64(i+1)*float64(totalTime)/float64(len(chineseLines)))
-					if iEnd > endTime {
-						iEnd = endTime
-					}
 
-					startFormatted := formatTimestamp(iStart)
-					endFormatted := formatTimestamp(iEnd)
-					cleanedText := util.CleanPunction(line)
-					combinedText := fmt.Sprintf("{\\an2}{\\rMajor}%s", cleanedText)
-					_, _ = assFile.WriteString(fmt.Sprintf("Dialogue: 0,%s,%s,Major,,0,0,0,,%s\n", startFormatted, endFormatted, combinedText))
+			// 中文字幕用主样式、英文字幕用副样式，按排版限制拆成多条，时间按显示宽度分配
+			layout, style, sep := majorLayout, majorStyle, ""
+			if util.ContainsAlphabetic(content) {
+				layout, style, sep = minorLayout, minorStyle, " "
+			}
+			for _, cue := range layout.layoutText(content, startTime.Seconds(), endTime.Seconds(), sep) {
+				cleanedLines := make([]string, 0, len(cue.lines))
+				for _, cueLine := range cue.lines {
+					cleanedLines = append(cleanedLines, util.CleanPunction(cueLine))
 				}
-			} else {
-				// 处理英文字幕
-				startFormatted := formatTimestamp(startTime)
-				endFormatted := formatTimestamp(endTime)
-				cleanedText := util.CleanPunction(content)
-				combinedText := fmt.Sprintf("{\\an2}{\\rMinor}%s", cleanedText)
-				_, _ = assFile.WriteString(fmt.Sprintf("Dialogue: 0,%s,%s,Minor,,0,0,0,,%s\n", startFormatted, endFormatted, combinedText))
+				startFormatted := formatTimestamp(time.Duration(cue.start * float64(time.Second)))
+				endFormatted := formatTimestamp(time.Duration(cue.end * float64(time.Second)))
+				combinedText := fmt.Sprintf("{\\an%d}{\\r%s}%s", style.alignment, style.name, strings.Join(cleanedLines, "\\N"))
+				_, _ = assFile.WriteString(fmt.Sprintf("Dialogue: 0,%s,%s,%s,,0,0,0,,%s\n", startFormatted, endFormatted, style.name, combinedText))
 			}
 		}
 	}
 	return nil
 }
 
-func embedSubtitles(stepParam *types.SubtitleTaskStepParam, isHorizontal bool, withTts bool) error {
-	outputFileName := types.SubtitleTaskVerticalEmbedVideoFileName
-	if isHorizontal {
-		outputFileName = types.SubtitleTaskHorizontalEmbedVideoFileName
+// embedSubtitles 把双语字幕烧录进视频并输出为ratio画面比例，与源视频比例不同时在同一次编码中转换画面
+func embedSubtitles(stepParam *types.SubtitleTaskStepParam, input string, srcWidth, srcHeight int, ratio string, profile config.EncodingProfile, progress *encodeProgress) error {
+	width, height, reframe, err := embedCanvasSize(ratio, srcWidth, srcHeight, stepParam)
+	if err != nil {
+		return err
 	}
-	assPath := filepath.Join(stepParam.TaskBasePath, "formatted_subtitles.ass")
-
-	if err := srtToAss(stepParam.BilingualSrtFilePath, assPath, isHorizontal, stepParam); err != nil {
+	isHorizontal := width >= height
+	assPath := filepath.Join(stepParam.TaskBasePath, fmt.Sprintf("formatted_subtitles_%dx%d.ass", width, height))
+	if err = srtToAss(stepParam.BilingualSrtFilePath, assPath, isHorizontal, width, height, stepParam); err != nil {
 		log.GetLogger().Error("embedSubtitles srtToAss error", zap.Any("step param", stepParam), zap.Error(err))
 		return fmt.Errorf("embedSubtitles srtToAss error: %w", err)
 	}
-	input := stepParam.InputVideoPath
-	if withTts {
-		input = stepParam.VideoWithTtsFilePath
+	fontsDir, err := prepareSubtitleFonts(stepParam)
+	if err != nil {
+		return fmt.Errorf("embedSubtitles prepareSubtitleFonts error: %w", err)
+	}
+	videoFilter := fmt.Sprintf("ass=%s", strings.ReplaceAll(assPath, "\\", "/"))
+	if fontsDir != "" {
+		videoFilter += ":fontsdir=" + ffmpegFilterPath(fontsDir)
+	}
+	if reframe {
+		var fontBold, fontRegular string
+		if height > width && (stepParam.VerticalVideoMajorTitle != "" || stepParam.VerticalVideoMinorTitle != "") {
+			fontBold, fontRegular, err = getFontPaths(stepParam.SubtitleStyle)
+			if err != nil {
+				log.GetLogger().Error("获取字体路径失败", zap.Error(err))
+				return err
+			}
+		}
+		videoFilter = reframeFilter(input, srcWidth, srcHeight, width, height, stepParam, fontBold, fontRegular) + "," + videoFilter
+	} else if width != srcWidth || height != srcHeight {
+		videoFilter = fmt.Sprintf("crop=%d:%d:0:0,%s", width, height, videoFilter)
 	}
 
-	cmd := exec.Command(storage.FfmpegPath, "-y", "-i", input, "-vf", fmt.Sprintf("ass=%s", strings.ReplaceAll(assPath, "\\", "/")), "-c:a", "aac", "-b:a", "192k", filepath.Join(stepParam.TaskBasePath, fmt.Sprintf("/output/%s", outputFileName)))
-	output, err := cmd.CombinedOutput()
+	err = runVideoEncode(videoEncodeJob{
+		input:       input,
+		output:      filepath.Join(stepParam.TaskBasePath, "output", embedOutputFileName(ratio)),
+		videoFilter: videoFilter,
+		profile:     profile,
+		progress:    progress,
+	})
 	if err != nil {
-		log.GetLogger().Error("embedSubtitles embed subtitle into video ffmpeg error", zap.String("video path", stepParam.InputVideoPath), zap.String("output", string(output)), zap.Error(err))
+		log.GetLogger().Error("embedSubtitles embed subtitle into video ffmpeg error", zap.String("video path", input), zap.String("aspect ratio", ratio), zap.Error(err))
 		return fmt.Errorf("embedSubtitles embed subtitle into video ffmpeg error: %w", err)
 	}
 	return nil
 }
 
-func getFontPaths() (string, string, error) {
-	switch runtime.GOOS {
-	case "windows":
-		return "C\\:/Windows/Fonts/msyhbd.ttc", "C\\:/Windows/Fonts/msyh.ttc", nil // 在ffmpeg参数里必须这样写
-	case "darwin":
-		return "/System/Library/Fonts/Supplemental/Arial Bold.ttf", "/System/Library/Fonts/Supplemental/Arial.ttf", nil
-	case "linux":
-		return "/usr/share/fonts/truetype/dejavu/DejaVuSans-Bold.ttf", "/usr/share/fonts/truetype/dejavu/DejaVuSans.ttf", nil
-	default:
-		return "", "", fmt.Errorf("unsupported OS: %s", runtime.GOOS)
-	}
-}
-
 func getResolution(inputVideo string) (int, int, error) {
 	// 获取视频信息
 	cmdArgs := []string{
@@ -380,40 +329,3 @@ func getResolution(inputVideo string) (int, int, error) {
 	height, _ := strconv.Atoi(dimensions[2])
 	return width, height, nil
 }
-
-func convertToVertical(inputVideo, outputVideo, majorTitle, minorTitle string) error {
-	if _, err := os.Stat(outputVideo); err == nil {
-		log.GetLogger().Info("竖屏视频已存在", zap.String("outputVideo", outputVideo))
-		return nil
-	}
-
-	fontBold, fontRegular, err := getFontPaths()
-	if err != nil {
-		log.GetLogger().Error("获取字体路径失败", zap.Error(err))
-		return err
-	}
-
-	cmdArgs := []string{
-		"-i", inputVideo,
-		"-vf", fmt.Sprintf("scale=720:1280:force_original_aspect_ratio=decrease,pad=720:1280:(ow-iw)/2:(oh-ih)*2/5,drawbox=y=0:h=100:c=black@1:t=fill,drawtext=text='%s':x=(w-text_w)/2:y=210:fontsize=55:fontcolor=yellow:box=1:boxcolor=black@0.5:fontfile='%s',drawtext=text='%s':x=(w-text_w)/2:y=280:fontsize=40:fontcolor=yellow:box=1:boxcolor=black@0.5:fontfile='%s'",
-			majorTitle, fontBold, minorTitle, fontRegular),
-		"-r", "30",
-		"-b:v", "7587k",
-		"-c:a", "aac",
-		"-b:a", "192k",
-		"-c:v", "libx264",
-		"-preset", "fast",
-		"-y",
-		outputVideo,
-	}
-	cmd := exec.Command(storage.FfmpegPath, cmdArgs...)
-	var output []byte
-	output, err = cmd.CombinedOutput()
-	if err != nil {
-		log.GetLogger().Error("视频转竖屏失败", zap.String("output", string(output)), zap.Error(err))
-		return err
-	}
-
-	fmt.Printf("竖屏视频已保存到: %s\n", outputVideo)
-	return nil
-}
@@ -0,0 +1,295 @@
+package service
+
+import (
+	"errors"
+	"krillin-ai/internal/types"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// 对齐的打分：完全相同、相近（转录和大模型写法略有差异）、不同，以及一侧多出一个单位
+const (
+	alignScoreExact    = 2.0
+	alignScoreFuzzy    = 1.0
+	alignScoreMismatch = -1.0
+	alignScoreGap      = -1.0
+)
+
+// alignUnit 对齐的最小单位：按空格分词的文字为一个词，不分词的文字为一个字
+type alignUnit struct {
+	key   string // 用于比较的文本：小写，去掉标点和附加符号
+	runes int    // key的字符数
+	start float64
+	end   float64
+}
+
+// splitAlignUnits 按语言的书写特征把文本拆成对齐单位
+func splitAlignUnits(text string, script types.LanguageScript) []alignUnit {
+	var (
+		units   []alignUnit
+		current []rune
+	)
+	flush := func() {
+		if len(current) > 0 {
+			units = append(units, alignUnit{key: string(current), runes: len(current)})
+			current = nil
+		}
+	}
+	for _, r := range text {
+		switch {
+		case unicode.In(r, script.CharScripts...) && isAlignKeyRune(r):
+			flush()
+			units = append(units, alignUnit{key: string(unicode.ToLower(r)), runes: 1})
+		case isAlignKeyRune(r):
+			current = append(current, unicode.ToLower(r))
+		case unicode.Is(unicode.Mn, r) || unicode.Is(unicode.Mc, r) || unicode.Is(unicode.Me, r) || r == '\'' || r == '’':
+			// 元音符号、声调等附加符号和词内的撇号不拆词，也不参与比较，转录结果常常省略它们
+		default:
+			flush()
+		}
+	}
+	flush()
+	return units
+}
+
+func isAlignKeyRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsNumber(r)
+}
+
+// alignKeyRunes 文本中参与比较的字符数
+func alignKeyRunes(text string) int {
+	var n int
+	for _, r := range text {
+		if isAlignKeyRune(r) {
+			n++
+		}
+	}
+	return n
+}
+
+// alignSimilarity 两个单位的相似度得分
+func alignSimilarity(a, b string) float64 {
+	if a == b {
+		return alignScoreExact
+	}
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) < 3 || len(rb) < 3 {
+		return alignScoreMismatch
+	}
+	if strings.HasPrefix(a, b) || strings.HasPrefix(b, a) || editDistance(ra, rb)*3 <= max(len(ra), len(rb)) {
+		return alignScoreFuzzy
+	}
+	return alignScoreMismatch
+}
+
+func editDistance(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+// alignUnits 用动态规划把句子的单位整体对齐到转录单位中的一段，转录单位两端多出的部分不扣分。
+// 返回句子每个单位对应的转录单位下标，没有对应的为-1
+func alignUnits(sentence, asr []alignUnit) ([]int, float64) {
+	n, m := len(sentence), len(asr)
+	const (
+		moveDiag = iota
+		moveSentenceGap
+		moveAsrGap
+	)
+	score := make([][]float64, n+1)
+	move := make([][]int8, n+1)
+	for i := range score {
+		score[i] = make([]float64, m+1)
+		move[i] = make([]int8, m+1)
+		if i > 0 {
+			score[i][0] = score[i-1][0] + alignScoreGap
+			move[i][0] = moveSentenceGap
+		}
+	}
+	for i := 1; i <= n; i++ {
+		for j := 1; j <= m; j++ {
+			best, bestMove := score[i-1][j-1]+alignSimilarity(sentence[i-1].key, asr[j-1].key), int8(moveDiag)
+			if s := score[i-1][j] + alignScoreGap; s > best {
+				best, bestMove = s, moveSentenceGap
+			}
+			if s := score[i][j-1] + alignScoreGap; s > best {
+				best, bestMove = s, moveAsrGap
+			}
+			score[i][j], move[i][j] = best, bestMove
+		}
+	}
+
+	endJ := 0
+	for j := 1; j <= m; j++ {
+		if score[n][j] > score[n][endJ] {
+			endJ = j
+		}
+	}
+	matched := make([]int, n)
+	for i, j := n, endJ; i > 0; {
+		switch move[i][j] {
+		case moveDiag:
+			matched[i-1] = -1
+			if alignSimilarity(sentence[i-1].key, asr[j-1].key) > 0 {
+				matched[i-1] = j - 1
+			}
+			i--
+			j--
+		case moveSentenceGap:
+			matched[i-1] = -1
+			i--
+		default:
+			j--
+		}
+	}
+	return matched, score[n][endJ]
+}
+
+// asrAlignUnits 把lastTs之后的转录词拆成对齐单位，一个词拆成多个单位时按字符数分配词的时间。
+// 句子按顺序出现，只取开头一段足够覆盖句子的单位
+func asrAlignUnits(words []types.Word, lastTs float64, limit int, script types.LanguageScript) []alignUnit {
+	var units []alignUnit
+	for _, word := range words {
+		if word.Start < lastTs {
+			continue
+		}
+		wordUnits := splitAlignUnits(word.Text, script)
+		var total int
+		for _, unit := range wordUnits {
+			total += unit.runes
+		}
+		offset := 0
+		for _, unit := range wordUnits {
+			unit.start = word.Start + (word.End-word.Start)*float64(offset)/float64(total)
+			offset += unit.runes
+			unit.end = word.Start + (word.End-word.Start)*float64(offset)/float64(total)
+			units = append(units, unit)
+		}
+		if len(units) >= limit {
+			break
+		}
+	}
+	return units
+}
+
+// getSentenceTimestamps 把大模型拆分的句子与转录的词对齐，得到句子的起止时间，
+// 以及句子按排版单位拆开后每个单位的时间，返回的lastTs为下一句对齐的起点
+func getSentenceTimestamps(words []types.Word, sentence string, lastTs float64, language types.StandardLanguageCode) (types.SrtSentence, []types.Word, float64, error) {
+	var srtSt types.SrtSentence
+	script := types.GetLanguageScript(language)
+	sentenceUnits := splitAlignUnits(sentence, script)
+	if len(sentenceUnits) == 0 {
+		return srtSt, nil, 0, errors.New("getSentenceTimestamps sentence is empty")
+	}
+	asrUnits := asrAlignUnits(words, lastTs, 4*len(sentenceUnits)+100, script)
+	matched, score := alignUnits(sentenceUnits, asrUnits)
+	first, last := -1, -1
+	for i, j := range matched {
+		if j < 0 {
+			continue
+		}
+		if first < 0 {
+			first = i
+		}
+		last = i
+	}
+	if first < 0 || score <= 0 {
+		return srtSt, nil, 0, errors.New("getSentenceTimestamps no valid sentence")
+	}
+
+	// 对上的单位取转录的时间，没对上的在前后对上的单位之间按字符数分配时间
+	for i, j := range matched {
+		if j >= 0 {
+			sentenceUnits[i].start, sentenceUnits[i].end = asrUnits[j].start, asrUnits[j].end
+		}
+	}
+	for i := 0; i < len(sentenceUnits); {
+		if matched[i] >= 0 {
+			i++
+			continue
+		}
+		k := i
+		for k < len(sentenceUnits) && matched[k] < 0 {
+			k++
+		}
+		// 句首没对上的单位放在第一个对上的单位开始处，句尾的放在最后一个结束处
+		var from, to float64
+		if i > 0 {
+			from = sentenceUnits[i-1].end
+		}
+		if k < len(sentenceUnits) {
+			to = sentenceUnits[k].start
+		}
+		if i == 0 {
+			from = to
+		}
+		if k == len(sentenceUnits) {
+			to = from
+		}
+		to = max(to, from)
+		var total, offset int
+		for _, unit := range sentenceUnits[i:k] {
+			total += unit.runes
+		}
+		for u := i; u < k; u++ {
+			sentenceUnits[u].start = from + (to-from)*float64(offset)/float64(total)
+			offset += sentenceUnits[u].runes
+			sentenceUnits[u].end = from + (to-from)*float64(offset)/float64(total)
+		}
+		i = k
+	}
+
+	srtSt.Start = max(sentenceUnits[first].start, lastTs)
+	srtSt.End = max(sentenceUnits[last].end, srtSt.Start)
+	return srtSt, sentenceTokenWords(sentence, language, sentenceUnits), max(lastTs, srtSt.End), nil
+}
+
+// sentenceTokenWords 把对齐单位的时间映射回句子的排版单位，排版时保留原句的写法和标点
+func sentenceTokenWords(sentence string, language types.StandardLanguageCode, units []alignUnit) []types.Word {
+	// 每个参与比较的字符所属单位的时间
+	type span struct{ start, end float64 }
+	var runeSpans []span
+	for _, unit := range units {
+		for range unit.runes {
+			runeSpans = append(runeSpans, span{unit.start, unit.end})
+		}
+	}
+	tokens := splitLayoutTokens(sentence, wordSeparator(language))
+	result := make([]types.Word, 0, len(tokens))
+	offset := 0
+	var prevEnd float64
+	if len(units) > 0 {
+		prevEnd = units[0].start
+	}
+	for i, token := range tokens {
+		word := types.Word{Num: i, Text: token, Start: prevEnd, End: prevEnd}
+		n := alignKeyRunes(token)
+		if n > 0 && offset+n <= len(runeSpans) {
+			word.Start, word.End = math.Inf(1), math.Inf(-1)
+			for _, s := range runeSpans[offset : offset+n] {
+				word.Start = min(word.Start, s.start)
+				word.End = max(word.End, s.end)
+			}
+		}
+		offset += n
+		prevEnd = word.End
+		result = append(result, word)
+	}
+	return result
+}
@@ -0,0 +1,173 @@
+package service
+
+import (
+	"krillin-ai/internal/types"
+	"math"
+	"testing"
+)
+
+// asrWords 按给定的文本和起止时间构造转录词
+func asrWords(items ...any) []types.Word {
+	var words []types.Word
+	for i := 0; i+2 < len(items); i += 3 {
+		words = append(words, types.Word{Num: len(words), Text: items[i].(string), Start: items[i+1].(float64), End: items[i+2].(float64)})
+	}
+	return words
+}
+
+func almostEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-6
+}
+
+func Test_alignUnits(t *testing.T) {
+	script := types.GetLanguageScript(types.LanguageNameEnglish)
+	tests := []struct {
+		name     string
+		sentence string
+		asr      string
+		want     []int
+	}{
+		{name: "exact", sentence: "hello world", asr: "hello world", want: []int{0, 1}},
+		{name: "asr has extra words on both sides", sentence: "hello world", asr: "um so hello world and", want: []int{2, 3}},
+		{name: "fuzzy spelling", sentence: "colour theory", asr: "color theory", want: []int{0, 1}},
+		{name: "word missing from asr", sentence: "the quick brown fox", asr: "the fox", want: []int{0, -1, -1, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, score := alignUnits(splitAlignUnits(tt.sentence, script), splitAlignUnits(tt.asr, script))
+			if len(got) != len(tt.want) {
+				t.Fatalf("alignUnits() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("alignUnits() = %v, want %v", got, tt.want)
+				}
+			}
+			if score <= 0 {
+				t.Errorf("alignUnits() score = %v, want > 0", score)
+			}
+		})
+	}
+}
+
+func Test_getSentenceTimestamps(t *testing.T) {
+	tests := []struct {
+		name      string
+		language  types.StandardLanguageCode
+		words     []types.Word
+		sentence  string
+		lastTs    float64
+		wantStart float64
+		wantEnd   float64
+	}{
+		{
+			name:     "english with punctuation",
+			language: types.LanguageNameEnglish,
+			words:    asrWords("Hello", 0.0, 0.5, "world", 0.5, 1.0, "it's", 1.2, 1.4, "fine", 1.4, 1.8, "next", 2.0, 2.5),
+			sentence: "Hello, world! It's fine.", wantStart: 0, wantEnd: 1.8,
+		},
+		{
+			name:     "chinese",
+			language: types.LanguageNameSimplifiedChinese,
+			words:    asrWords("你好", 0.0, 1.0, "世界", 1.0, 2.0, "再见", 2.0, 3.0),
+			sentence: "你好，世界。", wantStart: 0, wantEnd: 2,
+		},
+		{
+			name:     "thai",
+			language: types.LanguageNameThai,
+			words:    asrWords("สวัสดี", 0.0, 1.0, "ครับ", 1.0, 1.5, "ลาก่อน", 2.0, 3.0),
+			sentence: "สวัสดีครับ", wantStart: 0, wantEnd: 1.5,
+		},
+		{
+			name:     "arabic with diacritics",
+			language: types.LanguageNameArabic,
+			words:    asrWords("مرحبا", 0.0, 1.0, "بكم", 1.0, 2.0, "جميعا", 2.0, 3.0),
+			sentence: "مَرْحَبًا بِكُمْ", wantStart: 0, wantEnd: 2,
+		},
+		{
+			name:     "korean",
+			language: types.LanguageNameKorean,
+			words:    asrWords("안녕하세요", 0.0, 1.0, "여러분", 1.0, 2.0, "감사합니다", 2.0, 3.0),
+			sentence: "안녕하세요 여러분", wantStart: 0, wantEnd: 2,
+		},
+		{
+			name:     "words missing from asr",
+			language: types.LanguageNameEnglish,
+			words:    asrWords("the", 0.0, 0.5, "fox", 1.5, 2.0, "jumps", 2.0, 2.5),
+			sentence: "The quick brown fox", wantStart: 0, wantEnd: 2,
+		},
+		{
+			name:     "starts after lastTs",
+			language: types.LanguageNameEnglish,
+			words:    asrWords("one", 0.0, 1.0, "two", 1.0, 2.0, "one", 3.0, 4.0, "two", 4.0, 5.0),
+			sentence: "one two", lastTs: 2, wantStart: 3, wantEnd: 5,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srtSt, tokenWords, lastTs, err := getSentenceTimestamps(tt.words, tt.sentence, tt.lastTs, tt.language)
+			if err != nil {
+				t.Fatalf("getSentenceTimestamps() error = %v", err)
+			}
+			if !almostEqual(srtSt.Start, tt.wantStart) || !almostEqual(srtSt.End, tt.wantEnd) {
+				t.Errorf("getSentenceTimestamps() = [%v, %v], want [%v, %v]", srtSt.Start, srtSt.End, tt.wantStart, tt.wantEnd)
+			}
+			if !almostEqual(lastTs, tt.wantEnd) {
+				t.Errorf("getSentenceTimestamps() lastTs = %v, want %v", lastTs, tt.wantEnd)
+			}
+			if len(tokenWords) == 0 {
+				t.Fatal("getSentenceTimestamps() returned no token words")
+			}
+			prevEnd := tokenWords[0].Start
+			for _, word := range tokenWords {
+				if word.Start < prevEnd-1e-6 || word.End < word.Start {
+					t.Errorf("getSentenceTimestamps() token words not in order: %+v", tokenWords)
+					break
+				}
+				prevEnd = word.End
+			}
+		})
+	}
+}
+
+func Test_getSentenceTimestamps_missingWordsInterpolated(t *testing.T) {
+	words := asrWords("the", 0.0, 0.5, "fox", 1.5, 2.0)
+	_, tokenWords, _, err := getSentenceTimestamps(words, "the quick brown fox", 0, types.LanguageNameEnglish)
+	if err != nil {
+		t.Fatalf("getSentenceTimestamps() error = %v", err)
+	}
+	if len(tokenWords) != 4 {
+		t.Fatalf("getSentenceTimestamps() token words = %+v, want 4", tokenWords)
+	}
+	// quick和brown字符数相同，平分the和fox之间的空档
+	quick, brown := tokenWords[1], tokenWords[2]
+	if !almostEqual(quick.Start, 0.5) || !almostEqual(quick.End, 1.0) || !almostEqual(brown.Start, 1.0) || !almostEqual(brown.End, 1.5) {
+		t.Errorf("getSentenceTimestamps() quick = %+v, brown = %+v, want [0.5, 1] and [1, 1.5]", quick, brown)
+	}
+}
+
+func Test_getSentenceTimestamps_lastTsProgression(t *testing.T) {
+	words := asrWords("one", 0.0, 1.0, "two", 1.0, 2.0, "three", 2.0, 3.0, "four", 3.0, 4.0)
+	var lastTs float64
+	for i, tt := range []struct {
+		sentence       string
+		start, end     float64
+		wantNextLastTs float64
+	}{
+		{sentence: "One two.", start: 0, end: 2, wantNextLastTs: 2},
+		{sentence: "Three, four.", start: 2, end: 4, wantNextLastTs: 4},
+	} {
+		srtSt, _, next, err := getSentenceTimestamps(words, tt.sentence, lastTs, types.LanguageNameEnglish)
+		if err != nil {
+			t.Fatalf("sentence %d error = %v", i, err)
+		}
+		if !almostEqual(srtSt.Start, tt.start) || !almostEqual(srtSt.End, tt.end) || !almostEqual(next, tt.wantNextLastTs) {
+			t.Errorf("sentence %d = [%v, %v] lastTs %v, want [%v, %v] lastTs %v", i, srtSt.Start, srtSt.End, next, tt.start, tt.end, tt.wantNextLastTs)
+		}
+		lastTs = next
+	}
+	// 没有任何词能对上时返回错误
+	if _, _, _, err := getSentenceTimestamps(words, "completely different", lastTs, types.LanguageNameEnglish); err == nil {
+		t.Error("getSentenceTimestamps() with no matching words, want error")
+	}
+}
@@ -0,0 +1,258 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"krillin-ai/internal/dto"
+	"krillin-ai/internal/storage"
+	"krillin-ai/internal/types"
+	"krillin-ai/log"
+	"runtime"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// 修改字幕后需要重新生成的产物
+const (
+	regenerateSubtitle = "subtitle"
+	regenerateTts      = "tts"
+	regenerateAudio    = "audio"
+	regenerateVideo    = "video"
+)
+
+// bilingualLineIndex 原文和译文在双语字幕中的行号
+func bilingualLineIndex(resultType types.SubtitleResultType) (originIndex, targetIndex int) {
+	if resultType == types.SubtitleResultTypeBilingualTranslationOnTop {
+		return 1, 0
+	}
+	return 0, 1
+}
+
+func loadSubtitleTaskStepParam(taskId string) (*types.SubtitleTaskStepParam, error) {
+	task, ok := storage.SubtitleTasks.Load(taskId)
+	if !ok || task == nil {
+		return nil, errors.New("任务不存在")
+	}
+	param, ok := storage.SubtitleTaskStepParams.Load(taskId)
+	if !ok || param == nil {
+		return nil, errors.New("任务参数不存在，无法编辑字幕")
+	}
+	stepParam := param.(*types.SubtitleTaskStepParam)
+	if stepParam.BilingualSrtFilePath == "" {
+		return nil, errors.New("任务还没有生成字幕")
+	}
+	return stepParam, nil
+}
+
+// GetSubtitleCues 按条返回任务字幕的原文、译文和时间
+func (s Service) GetSubtitleCues(req dto.GetSubtitleCuesReq) (*dto.GetSubtitleCuesResData, error) {
+	stepParam, err := loadSubtitleTaskStepParam(req.TaskId)
+	if err != nil {
+		return nil, err
+	}
+	cues, err := parseQaCues(stepParam.BilingualSrtFilePath)
+	if err != nil {
+		log.GetLogger().Error("GetSubtitleCues parse bilingual srt error", zap.Any("req", req), zap.Error(err))
+		return nil, fmt.Errorf("解析字幕失败: %w", err)
+	}
+	originIndex, targetIndex := bilingualLineIndex(stepParam.SubtitleResultType)
+	res := &dto.GetSubtitleCuesResData{TaskId: req.TaskId, Cues: make([]*dto.SubtitleCue, 0, len(cues))}
+	for i, cue := range cues {
+		res.Cues = append(res.Cues, &dto.SubtitleCue{
+			Index:      i + 1,
+			StartTime:  cue.start,
+			EndTime:    cue.end,
+			OriginText: cue.line(originIndex),
+			TargetText: cue.line(targetIndex),
+		})
+	}
+	return res, nil
+}
+
+// UpdateSubtitleCues 修改任务中的字幕，然后只重新生成受影响的产物：单语字幕、改过文字的配音、最终音频和视频
+func (s Service) UpdateSubtitleCues(req dto.UpdateSubtitleCuesReq) (*dto.UpdateSubtitleCuesResData, error) {
+	stepParam, err := loadSubtitleTaskStepParam(req.TaskId)
+	if err != nil {
+		return nil, err
+	}
+	taskPtr := stepParam.TaskPtr
+	// 与重新合成配音共用任务锁，读取字幕之前加锁，直到任务状态改为处理中
+	unlock := lockTaskEdit(req.TaskId)
+	defer unlock()
+	if taskPtr.Status == types.SubtitleTaskStatusProcessing {
+		return nil, errors.New("任务正在处理中，请稍后再试")
+	}
+	if len(req.Cues) == 0 {
+		return nil, errors.New("没有需要修改的字幕")
+	}
+
+	cues, err := parseQaCues(stepParam.BilingualSrtFilePath)
+	if err != nil {
+		log.GetLogger().Error("UpdateSubtitleCues parse bilingual srt error", zap.Any("req", req), zap.Error(err))
+		return nil, fmt.Errorf("解析字幕失败: %w", err)
+	}
+	textChanged, timingChanged, err := applyCuePatches(cues, req.Cues, stepParam.SubtitleResultType)
+	if err != nil {
+		return nil, err
+	}
+	if !textChanged && !timingChanged {
+		return nil, errors.New("字幕没有变化")
+	}
+
+	// 配音已经生成过时，比较修改前后每句的配音文本，只重新合成变化的句子
+	ttsDone := stepParam.EnableTts && stepParam.TtsResultFilePath != ""
+	var oldSubtitles []types.SrtSentenceWithStrTime
+	if ttsDone {
+		if s.TtsClient == nil && textChanged {
+			return nil, errors.New("未配置tts")
+		}
+		if oldSubtitles, err = parseSRT(stepParam.TtsSourceFilePath); err != nil {
+			log.GetLogger().Error("UpdateSubtitleCues parseSRT error", zap.Any("req", req), zap.Error(err))
+			return nil, fmt.Errorf("解析配音字幕失败: %w", err)
+		}
+	}
+
+	if err = writeQaCues(stepParam.BilingualSrtFilePath, cues); err != nil {
+		log.GetLogger().Error("UpdateSubtitleCues write bilingual srt error", zap.Any("req", req), zap.Error(err))
+		return nil, fmt.Errorf("保存字幕失败: %w", err)
+	}
+	if err = writeSplitSrtFiles(stepParam); err != nil {
+		return nil, fmt.Errorf("生成单语字幕失败: %w", err)
+	}
+	res := &dto.UpdateSubtitleCuesResData{TaskId: req.TaskId, Regenerated: []string{regenerateSubtitle}}
+
+	var subtitles []types.SrtSentenceWithStrTime
+	var ttsItems []dto.TtsResynthesizeItem
+	if ttsDone {
+		if subtitles, err = parseSRT(stepParam.TtsSourceFilePath); err != nil {
+			return nil, fmt.Errorf("解析配音字幕失败: %w", err)
+		}
+		for i := range subtitles {
+			if i < len(oldSubtitles) && subtitles[i].Text == oldSubtitles[i].Text {
+				continue
+			}
+			// 字幕改过后之前为这句单独指定的配音文本不再适用
+			delete(stepParam.TtsTextOverrides, i+1)
+			ttsItems = append(ttsItems, dto.TtsResynthesizeItem{Index: i + 1})
+			res.TtsIndexes = append(res.TtsIndexes, i+1)
+		}
+		if len(ttsItems) > 0 {
+			res.Regenerated = append(res.Regenerated, regenerateTts)
+		}
+		if len(ttsItems) > 0 || timingChanged {
+			res.Regenerated = append(res.Regenerated, regenerateAudio)
+		}
+	}
+	if len(stepParam.EmbedAspectRatios) > 0 || strings.HasPrefix(stepParam.EmbedSubtitleVideoType, "soft_") {
+		res.Regenerated = append(res.Regenerated, regenerateVideo)
+	}
+
+	taskPtr.Status = types.SubtitleTaskStatusProcessing
+	taskPtr.FailReason = ""
+	taskPtr.ProcessPct = 90
+
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				const size = 64 << 10
+				buf := make([]byte, size)
+				buf = buf[:runtime.Stack(buf, false)]
+				log.GetLogger().Error("UpdateSubtitleCues panic", zap.Any("panic:", r), zap.Any("stack:", buf))
+				taskPtr.Status = types.SubtitleTaskStatusFailed
+				taskPtr.FailReason = fmt.Sprintf("subtitle edit panic: %v", r)
+			}
+		}()
+		if err := s.regenerateAfterEdit(subtitles, ttsItems, ttsDone && timingChanged, stepParam); err != nil {
+			log.GetLogger().Error("UpdateSubtitleCues regenerate error", zap.Any("req", req), zap.Error(err))
+			taskPtr.Status = types.SubtitleTaskStatusFailed
+			taskPtr.FailReason = err.Error()
+		}
+	}()
+
+	log.GetLogger().Info("UpdateSubtitleCues success", zap.String("task id", req.TaskId), zap.Int("cues", len(req.Cues)), zap.Strings("regenerated", res.Regenerated))
+	return res, nil
+}
+
+// applyCuePatches 把修改应用到字幕上并校验，返回文字和时间是否有变化
+func applyCuePatches(cues []*qaCue, patches []dto.SubtitleCuePatch, resultType types.SubtitleResultType) (textChanged, timingChanged bool, err error) {
+	originIndex, targetIndex := bilingualLineIndex(resultType)
+	setLine := func(cue *qaCue, index int, text string) bool {
+		text = strings.TrimSpace(text)
+		if cue.line(index) == text {
+			return false
+		}
+		for len(cue.lines) <= index {
+			cue.lines = append(cue.lines, "")
+		}
+		cue.lines[index] = text
+		return true
+	}
+
+	patched := make(map[int]bool)
+	for _, patch := range patches {
+		if patch.Index < 1 || patch.Index > len(cues) {
+			return false, false, fmt.Errorf("字幕序号超出范围: %d", patch.Index)
+		}
+		cue := cues[patch.Index-1]
+		if patch.OriginText != nil && setLine(cue, originIndex, *patch.OriginText) {
+			textChanged = true
+		}
+		if patch.TargetText != nil && setLine(cue, targetIndex, *patch.TargetText) {
+			textChanged = true
+		}
+		if patch.StartTime != nil && *patch.StartTime != cue.start {
+			cue.start = *patch.StartTime
+			cue.hasTimestamp = true
+			timingChanged = true
+		}
+		if patch.EndTime != nil && *patch.EndTime != cue.end {
+			cue.end = *patch.EndTime
+			cue.hasTimestamp = true
+			timingChanged = true
+		}
+		patched[patch.Index-1] = true
+	}
+
+	for i := range patched {
+		cue := cues[i]
+		if cue.text() == "" {
+			return false, false, fmt.Errorf("第%d条字幕的文字不能为空", i+1)
+		}
+		if cue.start < 0 || cue.end <= cue.start {
+			return false, false, fmt.Errorf("第%d条字幕的时间不正确", i+1)
+		}
+		if i > 0 && cues[i-1].hasTimestamp && cue.start < cues[i-1].end {
+			return false, false, fmt.Errorf("第%d条字幕与前一条字幕时间重叠", i+1)
+		}
+		if i < len(cues)-1 && cues[i+1].hasTimestamp && cue.end > cues[i+1].start {
+			return false, false, fmt.Errorf("第%d条字幕与后一条字幕时间重叠", i+1)
+		}
+	}
+	return textChanged, timingChanged, nil
+}
+
+// regenerateAfterEdit 重新生成修改字幕后受影响的配音、音频和视频
+func (s Service) regenerateAfterEdit(subtitles []types.SrtSentenceWithStrTime, ttsItems []dto.TtsResynthesizeItem, rebuildAudio bool, stepParam *types.SubtitleTaskStepParam) error {
+	if len(ttsItems) > 0 {
+		// 重新合成会接着重新生成音频和视频
+		return s.resynthesizeTts(subtitles, ttsItems, stepParam.TtsResolvedVoiceCode, stepParam)
+	}
+	if rebuildAudio {
+		stepParam.TaskPtr.ProcessPct = 95
+		if err := buildTtsAudio(subtitles, stepParam); err != nil {
+			return fmt.Errorf("regenerateAfterEdit %w", err)
+		}
+	}
+	stepParam.TaskPtr.ProcessPct = 98
+	ctx := context.Background()
+	if err := s.embedSubtitles(ctx, stepParam); err != nil {
+		return fmt.Errorf("regenerateAfterEdit %w", err)
+	}
+	if err := s.uploadSubtitles(ctx, stepParam); err != nil {
+		return fmt.Errorf("regenerateAfterEdit %w", err)
+	}
+	log.GetLogger().Info("regenerateAfterEdit success", zap.String("task id", stepParam.TaskId))
+	return nil
+}
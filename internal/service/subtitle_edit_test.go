@@ -0,0 +1,101 @@
+package service
+
+import (
+	"krillin-ai/internal/dto"
+	"krillin-ai/internal/types"
+	"slices"
+	"testing"
+)
+
+func Test_applyCuePatches(t *testing.T) {
+	ptr := func(v float64) *float64 { return &v }
+	str := func(v string) *string { return &v }
+	newCues := func() []*qaCue {
+		return []*qaCue{
+			{index: 1, start: 0, end: 2, hasTimestamp: true, lines: []string{"译文一", "origin one"}},
+			{index: 2, start: 3, end: 5, hasTimestamp: true, lines: []string{"译文二", "origin two"}},
+			{index: 3, start: 6, end: 8, hasTimestamp: true, lines: []string{"译文三", "origin three"}},
+		}
+	}
+	tests := []struct {
+		name       string
+		patches    []dto.SubtitleCuePatch
+		wantText   bool
+		wantTiming bool
+		wantErr    bool
+		wantLines  []string // 第2条字幕修改后的文字
+		wantStart  float64  // 第2条字幕修改后的时间
+		wantEnd    float64
+	}{
+		{
+			name:      "edit text",
+			patches:   []dto.SubtitleCuePatch{{Index: 2, OriginText: str(" origin 2 "), TargetText: str("译文2")}},
+			wantText:  true,
+			wantLines: []string{"译文2", "origin 2"},
+			wantStart: 3, wantEnd: 5,
+		},
+		{
+			name:       "edit timing",
+			patches:    []dto.SubtitleCuePatch{{Index: 2, StartTime: ptr(2.5), EndTime: ptr(5.5)}},
+			wantTiming: true,
+			wantLines:  []string{"译文二", "origin two"},
+			wantStart:  2.5, wantEnd: 5.5,
+		},
+		{
+			name:      "no-op patch",
+			patches:   []dto.SubtitleCuePatch{{Index: 2, StartTime: ptr(3), EndTime: ptr(5), OriginText: str("origin two")}},
+			wantLines: []string{"译文二", "origin two"},
+			wantStart: 3, wantEnd: 5,
+		},
+		{name: "index zero", patches: []dto.SubtitleCuePatch{{Index: 0, TargetText: str("x")}}, wantErr: true},
+		{name: "index out of range", patches: []dto.SubtitleCuePatch{{Index: 4, TargetText: str("x")}}, wantErr: true},
+		{name: "negative start", patches: []dto.SubtitleCuePatch{{Index: 1, StartTime: ptr(-1)}}, wantErr: true},
+		{name: "end before start", patches: []dto.SubtitleCuePatch{{Index: 2, EndTime: ptr(2.9)}}, wantErr: true},
+		{name: "overlap previous", patches: []dto.SubtitleCuePatch{{Index: 2, StartTime: ptr(1.5)}}, wantErr: true},
+		{name: "overlap next", patches: []dto.SubtitleCuePatch{{Index: 2, EndTime: ptr(6.5)}}, wantErr: true},
+		{name: "empty text", patches: []dto.SubtitleCuePatch{{Index: 2, OriginText: str(""), TargetText: str(" ")}}, wantErr: true},
+		{
+			// 同时移动相邻两条时按修改后的时间校验
+			name: "move adjacent cues",
+			patches: []dto.SubtitleCuePatch{
+				{Index: 2, EndTime: ptr(6.5)},
+				{Index: 3, StartTime: ptr(6.5)},
+			},
+			wantTiming: true,
+			wantLines:  []string{"译文二", "origin two"},
+			wantStart:  3, wantEnd: 6.5,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cues := newCues()
+			textChanged, timingChanged, err := applyCuePatches(cues, tt.patches, types.SubtitleResultTypeBilingualTranslationOnTop)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("applyCuePatches() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if textChanged != tt.wantText || timingChanged != tt.wantTiming {
+				t.Errorf("applyCuePatches() = %v, %v, want %v, %v", textChanged, timingChanged, tt.wantText, tt.wantTiming)
+			}
+			cue := cues[1]
+			if !slices.Equal(cue.lines, tt.wantLines) || cue.start != tt.wantStart || cue.end != tt.wantEnd {
+				t.Errorf("cue 2 = %q %v-%v, want %q %v-%v", cue.lines, cue.start, cue.end, tt.wantLines, tt.wantStart, tt.wantEnd)
+			}
+		})
+	}
+}
+
+func Test_applyCuePatches_originOnTop(t *testing.T) {
+	cues := []*qaCue{{index: 1, start: 0, end: 1, hasTimestamp: true, lines: []string{"origin"}}}
+	target := "译文"
+	textChanged, _, err := applyCuePatches(cues, []dto.SubtitleCuePatch{{Index: 1, TargetText: &target}}, types.SubtitleResultTypeBilingualTranslationOnBottom)
+	if err != nil || !textChanged {
+		t.Fatalf("applyCuePatches() = %v, %v, want text changed", textChanged, err)
+	}
+	// 原文在上时译文补在第二行
+	if !slices.Equal(cues[0].lines, []string{"origin", "译文"}) {
+		t.Errorf("lines = %q, want [origin 译文]", cues[0].lines)
+	}
+}
@@ -0,0 +1,389 @@
+package service
+
+import (
+	"krillin-ai/config"
+	"krillin-ai/internal/types"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// subtitleLayout 字幕排版的限制，宽度以半角字符计，全角字符算2
+type subtitleLayout struct {
+	maxLineWidth float64
+	maxLineWords int // 按空格分词的语言每行最多的词数，0为不限制
+	maxLines     int
+	maxCps       float64 // 每秒最多显示的字符宽度
+	minDuration  float64 // 每条字幕的最短显示时间，秒
+}
+
+func newSubtitleLayout(maxLineWords int) subtitleLayout {
+	limits := config.Conf.Subtitle.Limits()
+	return subtitleLayout{
+		maxLineWidth: float64(limits.MaxLineWidth),
+		maxLineWords: maxLineWords,
+		maxLines:     limits.MaxLines,
+		maxCps:       limits.MaxCps,
+		minDuration:  float64(limits.MinDurationMs) / 1000,
+	}
+}
+
+// layoutCue 排版后的一条字幕
+type layoutCue struct {
+	lines []string
+	width float64
+	start float64
+	end   float64
+}
+
+func (c layoutCue) text() string {
+	return strings.Join(c.lines, "\n")
+}
+
+// textWidth 文本的显示宽度，中日韩文字和全角符号算2，其他算1
+func textWidth(text string) float64 {
+	var width float64
+	for _, r := range text {
+		if isFullWidthRune(r) {
+			width += 2
+		} else {
+			width++
+		}
+	}
+	return width
+}
+
+func isFullWidthRune(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) ||
+		(r >= 0x3000 && r <= 0x303F) || (r >= 0xFF01 && r <= 0xFF60) || (r >= 0xFFE0 && r <= 0xFFE6)
+}
+
+// wordSeparator 词之间的分隔符，中日泰等不用空格分词的语言为空
+func wordSeparator(language types.StandardLanguageCode) string {
+	if !types.GetLanguageScript(language).SpaceDelimited {
+		return ""
+	}
+	return " "
+}
+
+// splitLayoutTokens 把文本拆成排版的最小单位。按空格分词的语言以词为单位；
+// 其他语言每个全角字符为一个单位，连续的字母数字合为一个单位，标点跟随前一个单位，避免出现在行首
+func splitLayoutTokens(text string, sep string) []string {
+	if sep != "" {
+		return strings.Fields(text)
+	}
+	var (
+		tokens  []string
+		current strings.Builder
+	)
+	flush := func() {
+		if current.Len() > 0 {
+			tokens = append(tokens, current.String())
+			current.Reset()
+		}
+	}
+	for _, r := range text {
+		switch {
+		case unicode.IsSpace(r):
+			// 保留字母词之间的空格，行首行尾的空格在折行后去掉
+			if current.Len() > 0 {
+				current.WriteRune(' ')
+				flush()
+			} else if len(tokens) > 0 && !strings.HasSuffix(tokens[len(tokens)-1], " ") {
+				tokens[len(tokens)-1] += " "
+			}
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			if current.Len() > 0 {
+				current.WriteRune(r)
+			} else if len(tokens) > 0 {
+				tokens[len(tokens)-1] += string(r)
+			} else {
+				current.WriteRune(r)
+			}
+		case isFullWidthRune(r):
+			flush()
+			tokens = append(tokens, string(r))
+		default:
+			if current.Len() > 0 && isFullWidthRune([]rune(current.String())[0]) {
+				flush()
+			}
+			current.WriteRune(r)
+		}
+	}
+	flush()
+	return tokens
+}
+
+// wordsOfText 把文本拆成不带时间戳的词，用于只折行的场景
+func wordsOfText(text string, sep string) []types.Word {
+	tokens := splitLayoutTokens(text, sep)
+	words := make([]types.Word, len(tokens))
+	for i, token := range tokens {
+		words[i] = types.Word{Num: i, Text: token}
+	}
+	return words
+}
+
+// timedWordsOfText 把文本拆成词，按各部分的显示宽度分配start到end之间的时间
+func timedWordsOfText(text string, start, end float64, sep string) []types.Word {
+	words := wordsOfText(text, sep)
+	var total float64
+	for _, word := range words {
+		total += textWidth(word.Text)
+	}
+	if total == 0 {
+		return nil
+	}
+	var offset float64
+	for i := range words {
+		words[i].Start = start + (end-start)*offset/total
+		offset += textWidth(words[i].Text)
+		words[i].End = start + (end-start)*offset/total
+	}
+	return words
+}
+
+// layoutText 没有词级时间戳时，按各部分的显示宽度分配start到end之间的时间后排版
+func (l subtitleLayout) layoutText(text string, start, end float64, sep string) []layoutCue {
+	words := timedWordsOfText(text, start, end, sep)
+	if len(words) == 0 {
+		return nil
+	}
+	cues := l.layoutWords(words, sep)
+	l.fitTiming(cues, end)
+	return cues
+}
+
+// layoutWords 按排版限制把带时间戳的词分成若干条字幕，每条折成不超过maxLines行。
+// 分条时优先在标点和停顿处断开，让各条长度均衡、显示速度不超过maxCps，每条的时间取自首尾词的时间戳
+func (l subtitleLayout) layoutWords(words []types.Word, sep string) []layoutCue {
+	n := len(words)
+	if n == 0 {
+		return nil
+	}
+	if sep == "" {
+		l.maxLineWords = 0
+	}
+	widths := make([]float64, n)
+	// sentenceEnds[i]为前i个词中以句末标点结尾的词数
+	sentenceEnds := make([]int, n+1)
+	for i, word := range words {
+		widths[i] = textWidth(strings.TrimSpace(word.Text))
+		sentenceEnds[i+1] = sentenceEnds[i]
+		if isSentenceEnd(word.Text) {
+			sentenceEnds[i+1]++
+		}
+	}
+
+	// cost[j]为前j个词分条的最小代价，prev[j]为此时最后一条的起始位置
+	cost := make([]float64, n+1)
+	prev := make([]int, n+1)
+	for j := 1; j <= n; j++ {
+		cost[j] = math.Inf(1)
+	}
+	for i := 0; i < n; i++ {
+		if math.IsInf(cost[i], 1) {
+			continue
+		}
+		packer := linePacker{layout: l, sepWidth: textWidth(sep)}
+		for j := i; j < n; j++ {
+			if !packer.add(widths[j]) {
+				break
+			}
+			// 一条字幕中间包含句末时，下一句的开头不易阅读
+			c := cost[i] + l.cueCost(words, i, j+1, packer.width) + 0.5*float64(sentenceEnds[j]-sentenceEnds[i])
+			if c < cost[j+1] {
+				cost[j+1] = c
+				prev[j+1] = i
+			}
+		}
+	}
+
+	var cues []layoutCue
+	for j := n; j > 0; j = prev[j] {
+		i := prev[j]
+		lines, width := l.wrapLines(words[i:j], sep)
+		cues = append(cues, layoutCue{lines: lines, width: width, start: words[i].Start, end: words[j-1].End})
+	}
+	for i, j := 0, len(cues)-1; i < j; i, j = i+1, j-1 {
+		cues[i], cues[j] = cues[j], cues[i]
+	}
+	return cues
+}
+
+// cueCost 把words[i:j]作为一条字幕的代价，越小越好
+func (l subtitleLayout) cueCost(words []types.Word, i, j int, width float64) float64 {
+	// 填充越满代价越小，条数多时各条长度越均衡代价越小
+	capacity := l.maxLineWidth * float64(l.maxLines)
+	slack := max(capacity-width, 0) / capacity
+	cost := slack * slack
+
+	duration := words[j-1].End - words[i].Start
+	if duration > 0 && width/duration > l.maxCps {
+		cost += width/duration/l.maxCps - 1
+	}
+	if l.minDuration > 0 && duration < l.minDuration {
+		// 过短的字幕倾向于与相邻的合并
+		cost += 1 - max(duration, 0)/l.minDuration
+	}
+	if j < len(words) {
+		cost -= breakBonus(words[j-1], words[j])
+	}
+	return cost
+}
+
+// breakBonus 在两个词之间断开的好处，句末标点和停顿处最适合断开
+func breakBonus(before, after types.Word) float64 {
+	var bonus float64
+	if isSentenceEnd(before.Text) {
+		bonus += 0.5
+	} else if last, ok := lastRune(strings.TrimSpace(before.Text)); ok && strings.ContainsRune(",;:，、；：", last) {
+		bonus += 0.3
+	}
+	if after.Start-before.End >= 0.5 {
+		bonus += 0.3
+	}
+	return bonus
+}
+
+func isSentenceEnd(text string) bool {
+	last, ok := lastRune(strings.TrimSpace(text))
+	return ok && strings.ContainsRune(".?!。？！…", last)
+}
+
+func lastRune(text string) (rune, bool) {
+	runes := []rune(text)
+	if len(runes) == 0 {
+		return 0, false
+	}
+	return runes[len(runes)-1], true
+}
+
+// wrapLines 把一条字幕折成行数最少的若干行，行数相同时让各行宽度尽量接近，并优先在标点处折行
+func (l subtitleLayout) wrapLines(words []types.Word, sep string) ([]string, float64) {
+	n := len(words)
+	if n == 0 {
+		return nil, 0
+	}
+	if sep == "" {
+		l.maxLineWords = 0
+	}
+	widths := make([]float64, n)
+	for i, word := range words {
+		widths[i] = textWidth(strings.TrimSpace(word.Text))
+	}
+	sepWidth := textWidth(sep)
+	lineWidth := func(i, j int) float64 {
+		width := sepWidth * float64(j-i-1)
+		for k := i; k < j; k++ {
+			width += widths[k]
+		}
+		return width
+	}
+	fits := func(i, j int) bool {
+		return j-i == 1 || (lineWidth(i, j) <= l.maxLineWidth && (l.maxLineWords <= 0 || j-i <= l.maxLineWords))
+	}
+
+	packer := linePacker{layout: l, sepWidth: sepWidth}
+	packer.layout.maxLines = n
+	for _, width := range widths {
+		packer.add(width)
+	}
+	lines := packer.lines
+	average := packer.width / float64(lines)
+
+	// best[m][j]为前j个词折成m行的最小代价
+	best := make([][]float64, lines+1)
+	from := make([][]int, lines+1)
+	for m := range best {
+		best[m] = make([]float64, n+1)
+		from[m] = make([]int, n+1)
+		for j := range best[m] {
+			best[m][j] = math.Inf(1)
+		}
+	}
+	best[0][0] = 0
+	for m := 1; m <= lines; m++ {
+		for j := m; j <= n; j++ {
+			for i := m - 1; i < j; i++ {
+				if math.IsInf(best[m-1][i], 1) || !fits(i, j) {
+					continue
+				}
+				deviation := (lineWidth(i, j) - average) / l.maxLineWidth
+				c := best[m-1][i] + deviation*deviation
+				if j < n {
+					c -= breakBonus(words[j-1], words[j]) / 4
+				}
+				if c < best[m][j] {
+					best[m][j] = c
+					from[m][j] = i
+				}
+			}
+		}
+	}
+
+	result := make([]string, lines)
+	for m, j := lines, n; m > 0; m, j = m-1, from[m][j] {
+		texts := make([]string, 0, j-from[m][j])
+		for _, word := range words[from[m][j]:j] {
+			if sep == "" {
+				// 不分词的语言里，字母词之间的空格保留在词尾
+				texts = append(texts, word.Text)
+			} else {
+				texts = append(texts, strings.TrimSpace(word.Text))
+			}
+		}
+		result[m-1] = strings.TrimSpace(strings.Join(texts, sep))
+	}
+	return result, packer.width
+}
+
+// fitTiming 显示速度超过maxCps或短于minDuration的字幕，在不与下一条重叠、不超过limit的前提下延长结束时间
+func (l subtitleLayout) fitTiming(cues []layoutCue, limit float64) {
+	for i := range cues {
+		next := limit
+		if i+1 < len(cues) {
+			next = min(cues[i+1].start, limit)
+		}
+		cue := &cues[i]
+		need := max(cue.width/l.maxCps, l.minDuration)
+		if cue.end-cue.start < need && cue.end < next {
+			cue.end = min(cue.start+need, next)
+		}
+		if cue.end > next && next > cue.start {
+			cue.end = next
+		}
+	}
+}
+
+// linePacker 按顺序把词尽量放进当前行，放不下时另起一行，得到的行数是最少的
+type linePacker struct {
+	layout    subtitleLayout
+	sepWidth  float64
+	lines     int
+	lineWidth float64
+	lineWords int
+	width     float64 // 包含词间分隔符的总宽度
+}
+
+// add 加入一个词，超出最大行数时返回false且不加入
+func (p *linePacker) add(width float64) bool {
+	if p.lines > 0 && p.lineWidth+p.sepWidth+width <= p.layout.maxLineWidth &&
+		(p.layout.maxLineWords <= 0 || p.lineWords < p.layout.maxLineWords) {
+		p.lineWidth += p.sepWidth + width
+		p.lineWords++
+		p.width += p.sepWidth + width
+		return true
+	}
+	if p.lines >= p.layout.maxLines {
+		return false
+	}
+	if p.lines > 0 {
+		p.width += p.sepWidth
+	}
+	p.lines++
+	p.lineWidth = width
+	p.lineWords = 1
+	p.width += width
+	return true
+}
@@ -0,0 +1,138 @@
+package service
+
+import (
+	"krillin-ai/internal/types"
+	"strings"
+	"testing"
+)
+
+func Test_textWidth(t *testing.T) {
+	tests := []struct {
+		text string
+		want float64
+	}{
+		{text: "hello", want: 5},
+		{text: "你好", want: 4},
+		{text: "안녕", want: 4},
+		{text: "你好，AI", want: 8},
+	}
+	for _, tt := range tests {
+		if got := textWidth(tt.text); got != tt.want {
+			t.Errorf("textWidth(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func Test_splitLayoutTokens(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		sep  string
+		want []string
+	}{
+		{name: "space delimited", text: " Hello,  world! ", sep: " ", want: []string{"Hello,", "world!"}},
+		{name: "cjk with punctuation", text: "你好，世界。", sep: "", want: []string{"你", "好，", "世", "界。"}},
+		{name: "cjk mixed with latin", text: "我用ChatGPT 翻译", sep: "", want: []string{"我", "用", "ChatGPT ", "翻", "译"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitLayoutTokens(tt.text, tt.sep)
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("splitLayoutTokens(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_wrapLines(t *testing.T) {
+	tests := []struct {
+		name   string
+		layout subtitleLayout
+		text   string
+		sep    string
+		want   []string
+	}{
+		{
+			name:   "fits one line",
+			layout: subtitleLayout{maxLineWidth: 42, maxLines: 2},
+			text:   "Hello world", sep: " ",
+			want: []string{"Hello world"},
+		},
+		{
+			name:   "balanced lines",
+			layout: subtitleLayout{maxLineWidth: 20, maxLines: 2},
+			text:   "the quick brown fox jumps over", sep: " ",
+			want: []string{"the quick brown", "fox jumps over"},
+		},
+		{
+			name:   "word longer than max line width",
+			layout: subtitleLayout{maxLineWidth: 10, maxLines: 2},
+			text:   "a supercalifragilistic word", sep: " ",
+			want: []string{"a", "supercalifragilistic", "word"},
+		},
+		{
+			name:   "max line words",
+			layout: subtitleLayout{maxLineWidth: 42, maxLineWords: 2, maxLines: 2},
+			text:   "one two three four", sep: " ",
+			want: []string{"one two", "three four"},
+		},
+		{
+			name:   "cjk counts width 2",
+			layout: subtitleLayout{maxLineWidth: 8, maxLines: 2},
+			text:   "今天天气很好", sep: "",
+			want: []string{"今天天", "气很好"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _ := tt.layout.wrapLines(wordsOfText(tt.text, tt.sep), tt.sep)
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("wrapLines(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_layoutWords(t *testing.T) {
+	layout := subtitleLayout{maxLineWidth: 20, maxLines: 1, maxCps: 17}
+	words := []types.Word{
+		{Text: "Hello", Start: 0, End: 0.5},
+		{Text: "there.", Start: 0.5, End: 1},
+		{Text: "How", Start: 2, End: 2.3},
+		{Text: "are", Start: 2.3, End: 2.6},
+		{Text: "you?", Start: 2.6, End: 3},
+	}
+	cues := layout.layoutWords(words, " ")
+	if len(cues) != 2 {
+		t.Fatalf("layoutWords() = %+v, want 2 cues", cues)
+	}
+	// 在句末和停顿处分条，每条的时间取自首尾词
+	if cues[0].text() != "Hello there." || cues[0].start != 0 || cues[0].end != 1 {
+		t.Errorf("layoutWords() cue 0 = %+v", cues[0])
+	}
+	if cues[1].text() != "How are you?" || cues[1].start != 2 || cues[1].end != 3 {
+		t.Errorf("layoutWords() cue 1 = %+v", cues[1])
+	}
+	for _, cue := range cues {
+		if cue.width > layout.maxLineWidth*float64(layout.maxLines) {
+			t.Errorf("layoutWords() cue %q exceeds capacity", cue.text())
+		}
+	}
+}
+
+func Test_fitTiming(t *testing.T) {
+	layout := subtitleLayout{maxLineWidth: 42, maxLines: 2, maxCps: 17, minDuration: 1}
+	cues := []layoutCue{
+		{lines: []string{"fast"}, width: 34, start: 0, end: 1},   // 需要2秒，下一条3秒开始
+		{lines: []string{"short"}, width: 5, start: 3, end: 3.2}, // 短于最短时间
+		{lines: []string{"crowded"}, width: 34, start: 4, end: 4.5},
+		{lines: []string{"next"}, width: 4, start: 5, end: 6},
+	}
+	layout.fitTiming(cues, 10)
+	want := []float64{2, 4, 5, 6}
+	for i, cue := range cues {
+		if cue.end != want[i] {
+			t.Errorf("fitTiming() cue %d end = %v, want %v", i, cue.end, want[i])
+		}
+	}
+}
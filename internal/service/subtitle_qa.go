@@ -0,0 +1,425 @@
+package service
+
+import (
+	"bufio"
+	"fmt"
+	"krillin-ai/config"
+	"krillin-ai/internal/dto"
+	"krillin-ai/internal/types"
+	"krillin-ai/log"
+	"krillin-ai/pkg/util"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"go.uber.org/zap"
+)
+
+var srtTimestampRegexp = regexp.MustCompile(`^\s*(\d{2}:\d{2}:\d{2}[,.]\d{3})\s*-->\s*(\d{2}:\d{2}:\d{2}[,.]\d{3})\s*$`)
+
+// qaEmptyLine 字幕中间某一行为空时写出的占位符（零宽空格），避免空行把一条字幕断开
+const qaEmptyLine = "\u200b"
+
+// qaCue 质量检查时解析出的一条双语字幕
+type qaCue struct {
+	index        int // 检查前的序号
+	start        float64
+	end          float64
+	hasTimestamp bool
+	lines        []string // 按在双语字幕中从上到下的顺序
+	removed      bool
+}
+
+func (c *qaCue) line(i int) string {
+	if i < len(c.lines) {
+		return strings.TrimSpace(strings.ReplaceAll(c.lines[i], qaEmptyLine, ""))
+	}
+	return ""
+}
+
+func (c *qaCue) text() string {
+	var parts []string
+	for i := range c.lines {
+		if line := c.line(i); line != "" {
+			parts = append(parts, line)
+		}
+	}
+	return strings.Join(parts, " / ")
+}
+
+// readingWidth 阅读一条字幕需要的宽度，双语时观众通常只看其中一种语言，取最宽的一行
+func (c *qaCue) readingWidth() float64 {
+	var width float64
+	for i := range c.lines {
+		width = max(width, textWidth(c.line(i)))
+	}
+	return width
+}
+
+// checkSubtitleQuality 检查双语字幕的时间轴和译文，按配置自动修复能安全修复的问题，
+// 有修复时重新生成单语字幕。检查结果记录到任务上并保存到输出目录
+func (s Service) checkSubtitleQuality(stepParam *types.SubtitleTaskStepParam) error {
+	limits := config.Conf.Subtitle.Limits()
+	if !limits.QaEnable {
+		return nil
+	}
+	log.GetLogger().Info("audioToSubtitle.checkSubtitleQuality start", zap.String("task id", stepParam.TaskId))
+	cues, err := parseQaCues(stepParam.BilingualSrtFilePath)
+	if err != nil {
+		log.GetLogger().Error("checkSubtitleQuality parse bilingual srt error", zap.String("task id", stepParam.TaskId), zap.Error(err))
+		return fmt.Errorf("checkSubtitleQuality parse bilingual srt error: %w", err)
+	}
+
+	checker := subtitleQaChecker{
+		limits:     limits,
+		stepParam:  stepParam,
+		report:     &types.SubtitleQaReport{CueNum: len(cues)},
+		translator: s.chatCompleter(types.LlmRoleQa),
+	}
+	checker.check(cues)
+
+	if checker.changed {
+		if err = writeQaCues(stepParam.BilingualSrtFilePath, cues); err != nil {
+			log.GetLogger().Error("checkSubtitleQuality write bilingual srt error", zap.String("task id", stepParam.TaskId), zap.Error(err))
+			return fmt.Errorf("checkSubtitleQuality write bilingual srt error: %w", err)
+		}
+		if err = writeSplitSrtFiles(stepParam); err != nil {
+			return fmt.Errorf("checkSubtitleQuality %w", err)
+		}
+	}
+
+	report := checker.report
+	stepParam.TaskPtr.QaReport = report
+	reportPath := filepath.Join(stepParam.TaskBasePath, "output", types.SubtitleTaskQaReportFileName)
+	if err = util.SaveToDisk(report, reportPath); err != nil {
+		log.GetLogger().Warn("checkSubtitleQuality save report error", zap.String("task id", stepParam.TaskId), zap.Error(err))
+	}
+	log.GetLogger().Info("audioToSubtitle.checkSubtitleQuality end", zap.String("task id", stepParam.TaskId),
+		zap.Int("cues", report.CueNum), zap.Int("issues", report.IssueNum), zap.Int("fixed", report.FixedNum))
+	return nil
+}
+
+// subtitleQaChecker 逐条检查字幕，开启自动修复时直接修改字幕
+type subtitleQaChecker struct {
+	limits     config.Subtitle
+	stepParam  *types.SubtitleTaskStepParam
+	report     *types.SubtitleQaReport
+	translator types.ChatCompleter // 补译用的大模型，为nil时只报告
+	changed    bool
+}
+
+func (q *subtitleQaChecker) addIssue(cue *qaCue, issueType, detail, action string) {
+	if action != "" {
+		q.changed = true
+		q.report.FixedNum++
+	}
+	q.report.IssueNum++
+	q.report.Issues = append(q.report.Issues, types.SubtitleQaIssue{
+		Index:  cue.index,
+		Type:   issueType,
+		Detail: detail,
+		Text:   cue.text(),
+		Action: action,
+	})
+}
+
+func (q *subtitleQaChecker) check(cues []*qaCue) {
+	for _, cue := range cues {
+		if cue.text() == "" {
+			q.remove(cue, types.SubtitleQaIssueEmptyText, "字幕没有文字")
+		}
+	}
+	for i, cue := range cues {
+		if !cue.removed && !cue.hasTimestamp {
+			q.fillTimestamp(cues, i)
+		}
+	}
+	for _, cue := range cues {
+		if !cue.removed {
+			q.checkTranslation(cue)
+		}
+	}
+
+	var active []*qaCue
+	for _, cue := range cues {
+		if !cue.removed && cue.hasTimestamp {
+			active = append(active, cue)
+		}
+	}
+	for i, cue := range active {
+		// 下一条字幕的开始时间，延长当前字幕时不能超过
+		next := math.Inf(1)
+		var nextCue *qaCue
+		for _, candidate := range active[i+1:] {
+			if !candidate.removed {
+				nextCue = candidate
+				next = candidate.start
+				break
+			}
+		}
+		q.checkTiming(cue, nextCue, next)
+	}
+	sort.SliceStable(q.report.Issues, func(i, j int) bool {
+		return q.report.Issues[i].Index < q.report.Issues[j].Index
+	})
+}
+
+func (q *subtitleQaChecker) remove(cue *qaCue, issueType, detail string) {
+	action := ""
+	if q.limits.QaAutoFix {
+		cue.removed = true
+		action = types.SubtitleQaActionRemoved
+	}
+	q.addIssue(cue, issueType, detail, action)
+}
+
+// fillTimestamp 缺少时间戳的字幕，放在前一条结束和后一条开始之间，按阅读速度估计时长；没有空间时删除
+func (q *subtitleQaChecker) fillTimestamp(cues []*qaCue, i int) {
+	cue := cues[i]
+	var prevEnd float64
+	for j := i - 1; j >= 0; j-- {
+		if !cues[j].removed && cues[j].hasTimestamp {
+			prevEnd = cues[j].end
+			break
+		}
+	}
+	next := math.Inf(1)
+	for _, candidate := range cues[i+1:] {
+		if !candidate.removed && candidate.hasTimestamp {
+			next = candidate.start
+			break
+		}
+	}
+	if next-prevEnd <= 0 {
+		q.remove(cue, types.SubtitleQaIssueMissingTimestamp, "缺少时间戳，前后字幕之间没有空余时间")
+		return
+	}
+	action := ""
+	if q.limits.QaAutoFix {
+		cue.start = prevEnd
+		cue.end = min(prevEnd+q.readingDuration(cue), next)
+		cue.hasTimestamp = true
+		action = types.SubtitleQaActionAdjusted
+	}
+	q.addIssue(cue, types.SubtitleQaIssueMissingTimestamp, "缺少时间戳，按前后字幕推算", action)
+}
+
+// checkTranslation 检查缺少译文和译文与原文相同的字幕，开启自动修复时用大模型重新翻译
+func (q *subtitleQaChecker) checkTranslation(cue *qaCue) {
+	stepParam := q.stepParam
+	if stepParam.SubtitleResultType == types.SubtitleResultTypeOriginOnly {
+		return
+	}
+	originIndex, targetIndex := bilingualLineIndex(stepParam.SubtitleResultType)
+	origin, target := cue.line(originIndex), cue.line(targetIndex)
+	switch {
+	case origin != "" && target == "":
+		q.addIssue(cue, types.SubtitleQaIssueUntranslated, "缺少译文", q.retranslate(cue, origin, targetIndex))
+	case stepParam.OriginLanguage != stepParam.TargetLanguage && strings.EqualFold(origin, target) &&
+		strings.IndexFunc(origin, unicode.IsLetter) >= 0:
+		q.addIssue(cue, types.SubtitleQaIssueIdentical, "译文与原文相同", q.retranslate(cue, origin, targetIndex))
+	}
+}
+
+// retranslate 重新翻译原文并替换译文行，翻译失败或结果仍与原文相同时不修改
+func (q *subtitleQaChecker) retranslate(cue *qaCue, origin string, targetIndex int) string {
+	if !q.limits.QaAutoFix || q.translator == nil {
+		return ""
+	}
+	prompt := fmt.Sprintf(types.QaRetranslatePrompt, types.GetStandardLanguageName(q.stepParam.TargetLanguage), origin)
+	result, err := q.translator.ChatCompletion(prompt)
+	if err != nil {
+		log.GetLogger().Warn("subtitleQaChecker retranslate error", zap.String("task id", q.stepParam.TaskId), zap.Int("index", cue.index), zap.Error(err))
+		return ""
+	}
+	translated := strings.Join(strings.Fields(result), " ")
+	if translated == "" || strings.EqualFold(translated, origin) {
+		return ""
+	}
+	for len(cue.lines) <= targetIndex {
+		cue.lines = append(cue.lines, "")
+	}
+	cue.lines[targetIndex] = translated
+	return types.SubtitleQaActionRetranslated
+}
+
+// checkTiming 检查一条字幕的时间，延长时不超过下一条的开始时间next
+func (q *subtitleQaChecker) checkTiming(cue, nextCue *qaCue, next float64) {
+	minDuration := float64(q.limits.MinDurationMs) / 1000
+	maxDuration := float64(q.limits.MaxDurationMs) / 1000
+	minGap := float64(q.limits.MinGapMs) / 1000
+	// extend 在不超过next的前提下把结束时间延长到target，返回是否修改
+	extend := func(target float64) bool {
+		end := min(target, next)
+		if !q.limits.QaAutoFix || end <= cue.end {
+			return false
+		}
+		cue.end = end
+		return true
+	}
+	adjusted := func(ok bool) string {
+		if ok {
+			return types.SubtitleQaActionAdjusted
+		}
+		return ""
+	}
+
+	if cue.end <= cue.start {
+		detail := fmt.Sprintf("结束时间%s不晚于开始时间%s", util.FormatTime(float32(cue.end)), util.FormatTime(float32(cue.start)))
+		// 下一条在本条开始前就出现时无法安全修复，只报告
+		q.addIssue(cue, types.SubtitleQaIssueZeroDuration, detail, adjusted(next > cue.start && extend(cue.start+q.readingDuration(cue))))
+	}
+	if nextCue != nil && cue.end > next {
+		detail := fmt.Sprintf("与第%d条字幕重叠%.2f秒", nextCue.index, cue.end-next)
+		action := ""
+		if q.limits.QaAutoFix && next > cue.start {
+			cue.end = next
+			action = types.SubtitleQaActionAdjusted
+		}
+		q.addIssue(cue, types.SubtitleQaIssueOverlap, detail, action)
+	}
+	if gap := next - cue.end; nextCue != nil && gap > 0 && gap < minGap {
+		q.addIssue(cue, types.SubtitleQaIssueGap, fmt.Sprintf("与第%d条字幕间隔%.3f秒", nextCue.index, gap), adjusted(extend(next)))
+	}
+	if duration := cue.end - cue.start; duration > 0 && duration < minDuration {
+		q.addIssue(cue, types.SubtitleQaIssueTooShort, fmt.Sprintf("显示%.2f秒", duration), adjusted(extend(cue.start+minDuration)))
+	}
+	if duration := cue.end - cue.start; duration > 0 && cue.readingWidth()/duration > q.limits.MaxCps {
+		detail := fmt.Sprintf("每秒%.1f个字符宽度", cue.readingWidth()/duration)
+		q.addIssue(cue, types.SubtitleQaIssueReadingSpeed, detail, adjusted(extend(cue.start+cue.readingWidth()/q.limits.MaxCps)))
+	}
+	if duration := cue.end - cue.start; duration > maxDuration {
+		q.addIssue(cue, types.SubtitleQaIssueTooLong, fmt.Sprintf("显示%.2f秒", duration), "")
+	}
+}
+
+// readingDuration 按阅读速度估计一条字幕需要的显示时间
+func (q *subtitleQaChecker) readingDuration(cue *qaCue) float64 {
+	return max(cue.readingWidth()/q.limits.MaxCps, float64(q.limits.MinDurationMs)/1000)
+}
+
+// parseQaCues 解析双语字幕。生成字幕时缺少时间戳或某一行为空会写出空行，这里把被空行隔开的文字归回所属的字幕
+func parseQaCues(path string) ([]*qaCue, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var groups [][]string
+	var group []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" {
+			if len(group) > 0 {
+				groups = append(groups, group)
+				group = nil
+			}
+			continue
+		}
+		group = append(group, line)
+	}
+	if len(group) > 0 {
+		groups = append(groups, group)
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	var (
+		cues []*qaCue
+		// 上一条字幕只有序号和时间戳时，后面隔开的文字前少了一个空行
+		missingFirstLine bool
+	)
+	for _, group := range groups {
+		isCueStart := util.IsNumber(strings.TrimSpace(group[0])) && (len(group) == 1 || srtTimestampRegexp.MatchString(group[1]))
+		if !isCueStart {
+			if len(cues) == 0 {
+				continue
+			}
+			last := cues[len(cues)-1]
+			if missingFirstLine {
+				last.lines = append(last.lines, "")
+				missingFirstLine = false
+			}
+			last.lines = append(last.lines, group...)
+			continue
+		}
+		cue := &qaCue{}
+		fmt.Sscanf(strings.TrimSpace(group[0]), "%d", &cue.index)
+		if len(group) >= 2 {
+			matches := srtTimestampRegexp.FindStringSubmatch(group[1])
+			start, err1 := parseSrtTime(matches[1])
+			end, err2 := parseSrtTime(matches[2])
+			if err1 == nil && err2 == nil {
+				cue.start, cue.end, cue.hasTimestamp = start.Seconds(), end.Seconds(), true
+			}
+			cue.lines = append(cue.lines, group[2:]...)
+		}
+		missingFirstLine = len(group) == 2
+		cues = append(cues, cue)
+	}
+	return cues, nil
+}
+
+// writeQaCues 按检查后的结果重新写出双语字幕，删除的字幕不再输出，序号重新编排，字幕内不会出现空行
+func writeQaCues(path string, cues []*qaCue) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	writer := bufio.NewWriter(file)
+	index := 1
+	for _, cue := range cues {
+		if cue.removed {
+			continue
+		}
+		timestamp := ""
+		if cue.hasTimestamp {
+			timestamp = fmt.Sprintf("%s --> %s", util.FormatTime(float32(cue.start)), util.FormatTime(float32(cue.end)))
+		}
+		_, _ = writer.WriteString(fmt.Sprintf("%d\n%s\n", index, timestamp))
+		// 末尾的空行去掉，中间的空行写占位符，保持原文和译文所在的行
+		lines := cue.lines
+		for len(lines) > 0 && cue.line(len(lines)-1) == "" {
+			lines = lines[:len(lines)-1]
+		}
+		for i := range lines {
+			line := cue.line(i)
+			if line == "" {
+				line = qaEmptyLine
+			}
+			_, _ = writer.WriteString(line + "\n")
+		}
+		_, _ = writer.WriteString("\n")
+		index++
+	}
+	return writer.Flush()
+}
+
+func newQaReport(report *types.SubtitleQaReport) *dto.SubtitleQaReport {
+	if report == nil {
+		return nil
+	}
+	res := &dto.SubtitleQaReport{
+		CueNum:   report.CueNum,
+		IssueNum: report.IssueNum,
+		FixedNum: report.FixedNum,
+	}
+	for _, issue := range report.Issues {
+		res.Issues = append(res.Issues, &dto.SubtitleQaIssue{
+			Index:  issue.Index,
+			Type:   issue.Type,
+			Detail: issue.Detail,
+			Text:   issue.Text,
+			Action: issue.Action,
+		})
+	}
+	return res
+}
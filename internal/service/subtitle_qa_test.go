@@ -0,0 +1,245 @@
+package service
+
+import (
+	"errors"
+	"krillin-ai/config"
+	"krillin-ai/internal/types"
+	"krillin-ai/log"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func Test_writeQaCues_emptyLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bilingual.srt")
+	cues := []*qaCue{
+		{start: 0, end: 1, hasTimestamp: true, lines: []string{"", "译文"}},
+		{start: 1, end: 2, hasTimestamp: true, lines: []string{"origin", ""}},
+	}
+	if err := writeQaCues(path, cues); err != nil {
+		t.Fatalf("writeQaCues() error = %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 每条字幕之间只有一个空行，字幕内部没有空行
+	blocks := strings.Split(strings.TrimRight(string(data), "\n"), "\n\n")
+	if len(blocks) != 2 {
+		t.Fatalf("writeQaCues() wrote %d blocks, want 2:\n%s", len(blocks), data)
+	}
+
+	parsed, err := parseQaCues(path)
+	if err != nil {
+		t.Fatalf("parseQaCues() error = %v", err)
+	}
+	if len(parsed) != 2 {
+		t.Fatalf("parseQaCues() = %d cues, want 2", len(parsed))
+	}
+	if parsed[0].line(0) != "" || parsed[0].line(1) != "译文" {
+		t.Errorf("cue 1 lines = %q, want empty origin and 译文", parsed[0].lines)
+	}
+	if parsed[1].line(0) != "origin" || parsed[1].line(1) != "" {
+		t.Errorf("cue 2 lines = %q, want origin and empty target", parsed[1].lines)
+	}
+}
+
+func newTestQaChecker(autoFix bool, translator types.ChatCompleter) *subtitleQaChecker {
+	limits := config.Subtitle{QaEnable: true, QaAutoFix: autoFix, MinDurationMs: 1000, MinGapMs: 80}.Limits()
+	return &subtitleQaChecker{
+		limits: limits,
+		stepParam: &types.SubtitleTaskStepParam{
+			TaskId:             "test",
+			OriginLanguage:     types.LanguageNameEnglish,
+			TargetLanguage:     types.LanguageNameSimplifiedChinese,
+			SubtitleResultType: types.SubtitleResultTypeBilingualTranslationOnTop,
+		},
+		report:     &types.SubtitleQaReport{},
+		translator: translator,
+	}
+}
+
+// qaIssueActions 按顺序返回 问题类型:处理方式
+func qaIssueActions(report *types.SubtitleQaReport) []string {
+	var actions []string
+	for _, issue := range report.Issues {
+		actions = append(actions, issue.Type+":"+issue.Action)
+	}
+	return actions
+}
+
+func Test_subtitleQaChecker_checkTiming(t *testing.T) {
+	tests := []struct {
+		name        string
+		start, end  float64
+		text        string
+		next        float64 // 下一条字幕的开始时间，0表示没有下一条
+		autoFix     bool
+		wantEnd     float64
+		wantActions []string
+	}{
+		{name: "ok", start: 0, end: 2, text: "hello", next: 3, autoFix: true, wantEnd: 2},
+		{name: "overlap", start: 0, end: 3, text: "hello", next: 2.5, autoFix: true, wantEnd: 2.5,
+			wantActions: []string{"overlap:adjusted"}},
+		{name: "overlap report only", start: 0, end: 3, text: "hello", next: 2.5, wantEnd: 3,
+			wantActions: []string{"overlap:"}},
+		{name: "too short", start: 0, end: 0.5, text: "hi", next: 5, autoFix: true, wantEnd: 1,
+			wantActions: []string{"too_short:adjusted"}},
+		{name: "too short limited by next", start: 0, end: 0.5, text: "hi", next: 0.7, autoFix: true, wantEnd: 0.7,
+			wantActions: []string{"too_short:adjusted"}},
+		{name: "too short report only", start: 0, end: 0.5, text: "hi", next: 5, wantEnd: 0.5,
+			wantActions: []string{"too_short:"}},
+		{name: "zero duration", start: 2, end: 2, text: "hello", next: 10, autoFix: true, wantEnd: 3,
+			wantActions: []string{"zero_duration:adjusted"}},
+		{name: "flicker gap", start: 0, end: 2, text: "hello", next: 2.05, autoFix: true, wantEnd: 2.05,
+			wantActions: []string{"gap:adjusted"}},
+		{name: "too long", start: 0, end: 10, text: "hello", autoFix: true, wantEnd: 10,
+			wantActions: []string{"too_long:"}},
+		{name: "reading speed", start: 0, end: 1.5, text: "abcdefghij abcdefghij abcdefghij", autoFix: true, wantEnd: 32.0 / 17,
+			wantActions: []string{"reading_speed:adjusted"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := newTestQaChecker(tt.autoFix, nil)
+			cue := &qaCue{index: 1, start: tt.start, end: tt.end, hasTimestamp: true, lines: []string{tt.text}}
+			next := math.Inf(1)
+			var nextCue *qaCue
+			if tt.next > 0 {
+				next = tt.next
+				nextCue = &qaCue{index: 2, start: tt.next, end: tt.next + 2, hasTimestamp: true, lines: []string{"next"}}
+			}
+			q.checkTiming(cue, nextCue, next)
+			if math.Abs(cue.end-tt.wantEnd) > 1e-9 {
+				t.Errorf("end = %v, want %v", cue.end, tt.wantEnd)
+			}
+			if got := qaIssueActions(q.report); !slices.Equal(got, tt.wantActions) {
+				t.Errorf("issues = %v, want %v", got, tt.wantActions)
+			}
+			if q.changed != (tt.end != tt.wantEnd) {
+				t.Errorf("changed = %v, want %v", q.changed, tt.end != tt.wantEnd)
+			}
+		})
+	}
+}
+
+func Test_subtitleQaChecker_fillTimestamp(t *testing.T) {
+	newCues := func(nextStart float64) []*qaCue {
+		return []*qaCue{
+			{index: 1, start: 0, end: 1, hasTimestamp: true, lines: []string{"first"}},
+			{index: 2, lines: []string{"hello"}},
+			{index: 3, start: nextStart, end: nextStart + 1, hasTimestamp: true, lines: []string{"third"}},
+		}
+	}
+	tests := []struct {
+		name        string
+		nextStart   float64
+		autoFix     bool
+		wantTs      bool
+		wantStart   float64
+		wantEnd     float64
+		wantRemoved bool
+		wantActions []string
+	}{
+		{name: "fill between cues", nextStart: 5, autoFix: true, wantTs: true, wantStart: 1, wantEnd: 2,
+			wantActions: []string{"missing_timestamp:adjusted"}},
+		{name: "limited by next cue", nextStart: 1.5, autoFix: true, wantTs: true, wantStart: 1, wantEnd: 1.5,
+			wantActions: []string{"missing_timestamp:adjusted"}},
+		{name: "no room", nextStart: 1, autoFix: true, wantRemoved: true,
+			wantActions: []string{"missing_timestamp:removed"}},
+		{name: "report only", nextStart: 5, wantActions: []string{"missing_timestamp:"}},
+		{name: "no room report only", nextStart: 1, wantActions: []string{"missing_timestamp:"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := newTestQaChecker(tt.autoFix, nil)
+			cues := newCues(tt.nextStart)
+			q.fillTimestamp(cues, 1)
+			cue := cues[1]
+			if cue.hasTimestamp != tt.wantTs || cue.removed != tt.wantRemoved {
+				t.Fatalf("hasTimestamp = %v, removed = %v, want %v, %v", cue.hasTimestamp, cue.removed, tt.wantTs, tt.wantRemoved)
+			}
+			if tt.wantTs && (cue.start != tt.wantStart || cue.end != tt.wantEnd) {
+				t.Errorf("time = %v-%v, want %v-%v", cue.start, cue.end, tt.wantStart, tt.wantEnd)
+			}
+			if got := qaIssueActions(q.report); !slices.Equal(got, tt.wantActions) {
+				t.Errorf("issues = %v, want %v", got, tt.wantActions)
+			}
+		})
+	}
+}
+
+func Test_subtitleQaChecker_checkTranslation(t *testing.T) {
+	log.InitLogger()
+	tests := []struct {
+		name        string
+		lines       []string // 译文在上
+		translator  *stubChatCompleter
+		autoFix     bool
+		wantLines   []string
+		wantCalls   int
+		wantActions []string
+	}{
+		{name: "translated", lines: []string{"你好", "hello"}, translator: &stubChatCompleter{result: "你好"}, autoFix: true,
+			wantLines: []string{"你好", "hello"}},
+		{name: "untranslated", lines: []string{"", "hello"}, translator: &stubChatCompleter{result: " 你好\n"}, autoFix: true,
+			wantLines: []string{"你好", "hello"}, wantCalls: 1, wantActions: []string{"untranslated:retranslated"}},
+		{name: "identical", lines: []string{"Hello", "hello"}, translator: &stubChatCompleter{result: "你好"}, autoFix: true,
+			wantLines: []string{"你好", "hello"}, wantCalls: 1, wantActions: []string{"identical:retranslated"}},
+		{name: "identical without letters", lines: []string{"42", "42"}, translator: &stubChatCompleter{result: "四十二"}, autoFix: true,
+			wantLines: []string{"42", "42"}},
+		{name: "translator error", lines: []string{"", "hello"}, translator: &stubChatCompleter{err: errors.New("timeout")}, autoFix: true,
+			wantLines: []string{"", "hello"}, wantCalls: 1, wantActions: []string{"untranslated:"}},
+		{name: "still identical", lines: []string{"hello", "hello"}, translator: &stubChatCompleter{result: "Hello"}, autoFix: true,
+			wantLines: []string{"hello", "hello"}, wantCalls: 1, wantActions: []string{"identical:"}},
+		{name: "report only", lines: []string{"", "hello"}, translator: &stubChatCompleter{result: "你好"},
+			wantLines: []string{"", "hello"}, wantActions: []string{"untranslated:"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := newTestQaChecker(tt.autoFix, tt.translator)
+			cue := &qaCue{index: 1, start: 0, end: 1, hasTimestamp: true, lines: tt.lines}
+			q.checkTranslation(cue)
+			if !slices.Equal(cue.lines, tt.wantLines) {
+				t.Errorf("lines = %q, want %q", cue.lines, tt.wantLines)
+			}
+			if tt.translator.calls != tt.wantCalls {
+				t.Errorf("translator calls = %d, want %d", tt.translator.calls, tt.wantCalls)
+			}
+			if got := qaIssueActions(q.report); !slices.Equal(got, tt.wantActions) {
+				t.Errorf("issues = %v, want %v", got, tt.wantActions)
+			}
+		})
+	}
+
+	// 只有原文时不检查译文
+	q := newTestQaChecker(true, nil)
+	q.stepParam.SubtitleResultType = types.SubtitleResultTypeOriginOnly
+	q.checkTranslation(&qaCue{index: 1, lines: []string{"hello"}})
+	if len(q.report.Issues) != 0 {
+		t.Errorf("origin only issues = %v, want none", qaIssueActions(q.report))
+	}
+}
+
+func Test_subtitleQaChecker_check(t *testing.T) {
+	q := newTestQaChecker(true, nil)
+	cues := []*qaCue{
+		{index: 1, start: 0, end: 2, hasTimestamp: true, lines: []string{"你好", "hello"}},
+		{index: 2, start: 2, end: 3, hasTimestamp: true, lines: []string{"", ""}},
+		{index: 3, start: 1.5, end: 4, hasTimestamp: true, lines: []string{"世界", "world"}},
+	}
+	q.check(cues)
+	if !cues[1].removed {
+		t.Error("empty cue should be removed")
+	}
+	// 删除空字幕后第1条与第3条重叠
+	want := []string{"overlap:adjusted", "empty_text:removed"}
+	if got := qaIssueActions(q.report); !slices.Equal(got, want) {
+		t.Errorf("issues = %v, want %v", got, want)
+	}
+	if cues[0].end != 1.5 || q.report.FixedNum != 2 || q.report.IssueNum != 2 {
+		t.Errorf("end = %v, fixed = %d, issues = %d, want 1.5, 2, 2", cues[0].end, q.report.FixedNum, q.report.IssueNum)
+	}
+}
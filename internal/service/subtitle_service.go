@@ -4,36 +4,42 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"krillin-ai/config"
 	"krillin-ai/internal/dto"
 	"krillin-ai/internal/storage"
 	"krillin-ai/internal/types"
 	"krillin-ai/log"
+	"krillin-ai/pkg/source"
 	"krillin-ai/pkg/util"
 	"os"
 	"path/filepath"
 	"runtime"
 	"strings"
+	"time"
 	"github.com/samber/lo"
 	"go.uber.org/zap"
 )
 
 func (s Service) StartSubtitleTask(req dto.StartVideoSubtitleTaskReq) (*dto.StartVideoSubtitleTaskResData, error) {
-	// 校验链接
-	if strings.Contains(req.Url, "youtube.com") {
-		videoId, _ := util.GetYouTubeID(req.Url)
-		if videoId == "" {
-			return nil, fmt.Errorf("链接不合法")
-		}
+	stepParam, err := s.newSubtitleTask(req)
+	if err != nil {
+		return nil, err
 	}
-	if strings.Contains(req.Url, "bilibili.com") {
-		videoId := util.GetBilibiliVideoId(req.Url)
-		if videoId == "" {
-			return nil, fmt.Errorf("链接不合法")
-		}
+	go s.runSubtitleTask(req, stepParam)
+
+	return &dto.StartVideoSubtitleTaskResData{
+		TaskId: stepParam.TaskId,
+	}, nil
+}
+
+// newSubtitleTask 校验参数并创建任务，不开始处理
+func (s Service) newSubtitleTask(req dto.StartVideoSubtitleTaskReq) (*types.SubtitleTaskStepParam, error) {
+	// 校验链接
+	if _, ok := source.Find(req.Url); !ok {
+		return nil, fmt.Errorf("链接不合法")
 	}
 	// 生成任务id
-	seperates := strings.Split(req.Url, "/")
-	taskId := fmt.Sprintf("%s_%s", util.SanitizePathName(string([]rune(strings.ReplaceAll(seperates[len(seperates)-1], " ", ""))[:16])), util.GenerateRandStringWithUpperLowerNum(4))
+	taskId := fmt.Sprintf("%s_%s", util.SanitizePathName(taskIdPrefix(req.Url)), util.GenerateRandStringWithUpperLowerNum(4))
 	taskId = strings.ReplaceAll(taskId, "=", "") // 等于号影响ffmpeg处理
 	taskId = strings.ReplaceAll(taskId, "?", "") // 问号影响ffmpeg处理
 	// 构造任务所需参数
@@ -65,7 +71,6 @@ func (s Service) StartSubtitleTask(req dto.StartVideoSubtitleTaskReq) (*dto.Star
 		}
 	}
 	var err error
-	ctx := context.Background()
 	// 创建字幕任务文件夹
 	taskBasePath := filepath.Join("./tasks", taskId)
 	if _, err = os.Stat(taskBasePath); os.IsNotExist(err) {
@@ -76,26 +81,59 @@ func (s Service) StartSubtitleTask(req dto.StartVideoSubtitleTaskReq) (*dto.Star
 		}
 	}
 
+	subtitleStyle := types.SubtitleStyle{
+		Major: types.SubtitleLineStyle(req.SubtitleStyle.Major),
+		Minor: types.SubtitleLineStyle(req.SubtitleStyle.Minor),
+	}
+	if err = validateSubtitleStyle(subtitleStyle); err != nil {
+		log.GetLogger().Error("StartVideoSubtitleTask invalid subtitle style", zap.Any("req", req), zap.Error(err))
+		return nil, fmt.Errorf("字幕样式参数错误: %w", err)
+	}
+
+	verticalWidth, verticalHeight := types.DefaultVerticalVideoWidth, types.DefaultVerticalVideoHeight
+	if req.VerticalResolution != "" {
+		if verticalWidth, verticalHeight, err = parseVideoResolution(req.VerticalResolution); err != nil {
+			return nil, err
+		}
+	}
+	reframeMode := req.ReframeMode
+	if reframeMode == "" {
+		// 兼容旧参数名vertical_reframe_mode
+		reframeMode = req.VerticalReframeMode
+	}
+	switch reframeMode {
+	case "":
+		reframeMode = types.ReframeModeLetterbox
+	case types.ReframeModeLetterbox, types.ReframeModeBlur, types.ReframeModeCrop, types.ReframeModeSmart:
+	default:
+		return nil, fmt.Errorf("不支持的画面比例转换方式: %s", reframeMode)
+	}
+	embedAspectRatios, err := embedAspectRatiosOf(req.EmbedSubtitleVideoType, req.EmbedAspectRatios)
+	if err != nil {
+		log.GetLogger().Error("StartVideoSubtitleTask invalid embed aspect ratios", zap.Any("req", req), zap.Error(err))
+		return nil, err
+	}
+	if _, err = config.Conf.Encoding.ProfileOf(req.EncodingProfile); err != nil {
+		log.GetLogger().Error("StartVideoSubtitleTask invalid encoding profile", zap.Any("req", req), zap.Error(err))
+		return nil, err
+	}
+
 	// 创建任务
 	taskPtr := &types.SubtitleTask{
 		TaskId:   taskId,
 		VideoSrc: req.Url,
 		Status:   types.SubtitleTaskStatusProcessing,
+		Usage:    &types.TaskUsage{},
 	}
 	storage.SubtitleTasks.Store(taskId, taskPtr)
 
 	// 处理声音克隆源
-	var voiceCloneAudioUrl string
-	if req.TtsVoiceCloneSrcFileUrl != "" {
-		localFileUrl := strings.TrimPrefix(req.TtsVoiceCloneSrcFileUrl, "local:")
-		fileKey := util.GenerateRandStringWithUpperLowerNum(5) + filepath.Ext(localFileUrl) // 防止url encode的问题，这里统一处理
-		err = s.OssClient.UploadFile(context.Background(), fileKey, localFileUrl, s.OssClient.Bucket)
-		if err != nil {
-			log.GetLogger().Error("StartVideoSubtitleTask UploadFile err", zap.Any("req", req), zap.Error(err))
-			return nil, errors.New("上传声音克隆源失败")
+	voiceCloneSrcFilePath := strings.TrimPrefix(req.TtsVoiceCloneSrcFileUrl, "local:")
+	if voiceCloneSrcFilePath != "" {
+		if _, err = os.Stat(voiceCloneSrcFilePath); err != nil {
+			log.GetLogger().Error("StartVideoSubtitleTask voice clone source not found", zap.Any("req", req), zap.Error(err))
+			return nil, errors.New("声音克隆源文件不存在")
 		}
-		voiceCloneAudioUrl = fmt.Sprintf("https://%s.oss-cn-shanghai.aliyuncs.com/%s", s.OssClient.Bucket, fileKey)
-		log.GetLogger().Info("StartVideoSubtitleTask 上传声音克隆源成功", zap.Any("oss url", voiceCloneAudioUrl))
 	}
 
 	stepParam := types.SubtitleTaskStepParam{
@@ -107,7 +145,9 @@ func (s Service) StartSubtitleTask(req dto.StartVideoSubtitleTaskReq) (*dto.Star
 		EnableModalFilter:       req.ModalFilter == types.SubtitleTaskModalFilterYes,
 		EnableTts:               req.Tts == types.SubtitleTaskTtsYes,
 		TtsVoiceCode:            req.TtsVoiceCode,
-		VoiceCloneAudioUrl:      voiceCloneAudioUrl,
+		VoiceCloneSrcFilePath:   voiceCloneSrcFilePath,
+		VoiceCloneFromSource:    req.TtsVoiceCloneFromSource == types.SubtitleTaskTtsVoiceCloneFromSourceYes,
+		LlmCacheBypass:          req.LlmCacheBypass == types.SubtitleTaskLlmCacheBypassYes,
 		ReplaceWordsMap:         replaceWordsMap,
 		OriginLanguage:          types.StandardLanguageCode(req.OriginLanguage),
 		TargetLanguage:          types.StandardLanguageCode(req.TargetLang),
@@ -115,76 +155,116 @@ func (s Service) StartSubtitleTask(req dto.StartVideoSubtitleTaskReq) (*dto.Star
 		EmbedSubtitleVideoType:  req.EmbedSubtitleVideoType,
 		VerticalVideoMajorTitle: req.VerticalMajorTitle,
 		VerticalVideoMinorTitle: req.VerticalMinorTitle,
+		EmbedAspectRatios:       embedAspectRatios,
+		ReframeMode:             reframeMode,
+		VerticalVideoWidth:      verticalWidth,
+		VerticalVideoHeight:     verticalHeight,
 		MaxWordOneLine:          12, // 默认值
+		SubtitleStyle:           subtitleStyle,
+		EncodingProfile:         req.EncodingProfile,
 	}
 	if req.OriginLanguageWordOneLine != 0 {
 		stepParam.MaxWordOneLine = req.OriginLanguageWordOneLine
 	}
 
 	log.GetLogger().Info("current task info", zap.String("taskId", taskId), zap.Any("param", stepParam))
+	storage.SubtitleTaskStepParams.Store(taskId, &stepParam)
+	return &stepParam, nil
+}
 
-	go func() {
-		defer func() {
-			if r := recover(); r != nil {
-				const size = 64 << 10
-				buf := make([]byte, size)
-				buf = buf[:runtime.Stack(buf, false)]
-				log.GetLogger().Error("autoVideoSubtitle panic", zap.Any("panic:", r), zap.Any("stack:", buf))
-				stepParam.TaskPtr.Status = types.SubtitleTaskStatusFailed
-			}
-		}()
-		// 新版流程：链接->本地音频文件->视频信息获取（若有）->本地字幕文件->语言合成->视频合成->字幕文件链接生成
-		log.GetLogger().Info("video subtitle start task", zap.String("taskId", taskId))
-		err = s.linkToFile(ctx, &stepParam)
-		if err != nil {
-			log.GetLogger().Error("StartVideoSubtitleTask linkToFile err", zap.Any("req", req), zap.Error(err))
-			stepParam.TaskPtr.Status = types.SubtitleTaskStatusFailed
-			stepParam.TaskPtr.FailReason = err.Error()
-			return
-		}
-		// 暂时不加视频信息
-		//err = s.getVideoInfo(ctx, &stepParam)
-		//if err != nil {
-		//	log.GetLogger().Error("StartVideoSubtitleTask getVideoInfo err", zap.Any("req", req), zap.Error(err))
-		//	stepParam.TaskPtr.Status = types.SubtitleTaskStatusFailed
-		//	stepParam.TaskPtr.FailReason = "get video info error"
-		//	return
-		//}
-		err = s.audioToSubtitle(ctx, &stepParam)
-		if err != nil {
-			log.GetLogger().Error("StartVideoSubtitleTask audioToSubtitle err", zap.Any("req", req), zap.Error(err))
-			stepParam.TaskPtr.Status = types.SubtitleTaskStatusFailed
-			stepParam.TaskPtr.FailReason = err.Error()
-			return
-		}
-		err = s.srtFileToSpeech(ctx, &stepParam)
-		if err != nil {
-			log.GetLogger().Error("StartVideoSubtitleTask srtFileToSpeech err", zap.Any("req", req), zap.Error(err))
-			stepParam.TaskPtr.Status = types.SubtitleTaskStatusFailed
-			stepParam.TaskPtr.FailReason = err.Error()
-			return
-		}
-		err = s.embedSubtitles(ctx, &stepParam)
-		if err != nil {
-			log.GetLogger().Error("StartVideoSubtitleTask embedSubtitles err", zap.Any("req", req), zap.Error(err))
-			stepParam.TaskPtr.Status = types.SubtitleTaskStatusFailed
-			stepParam.TaskPtr.FailReason = err.Error()
-			return
-		}
-		err = s.uploadSubtitles(ctx, &stepParam)
-		if err != nil {
-			log.GetLogger().Error("StartVideoSubtitleTask uploadSubtitles err", zap.Any("req", req), zap.Error(err))
+// runSubtitleTask 同步执行任务的完整流程
+func (s Service) runSubtitleTask(req dto.StartVideoSubtitleTaskReq, stepParam *types.SubtitleTaskStepParam) {
+	var err error
+	ctx := context.Background()
+	s.usage = stepParam.TaskPtr.Usage
+	s.llmCacheBypass = stepParam.LlmCacheBypass
+	defer saveTaskUsage(stepParam)
+	defer func() {
+		if r := recover(); r != nil {
+			const size = 64 << 10
+			buf := make([]byte, size)
+			buf = buf[:runtime.Stack(buf, false)]
+			log.GetLogger().Error("autoVideoSubtitle panic", zap.Any("panic:", r), zap.Any("stack:", buf))
 			stepParam.TaskPtr.Status = types.SubtitleTaskStatusFailed
-			stepParam.TaskPtr.FailReason = err.Error()
-			return
 		}
-
-		log.GetLogger().Info("video subtitle task end", zap.String("taskId", taskId))
 	}()
+	// 新版流程：链接->本地音频文件->视频信息获取（若有）->本地字幕文件->语言合成->视频合成->字幕文件链接生成
+	log.GetLogger().Info("video subtitle start task", zap.String("taskId", stepParam.TaskId))
+	err = s.linkToFile(ctx, stepParam)
+	if err != nil {
+		log.GetLogger().Error("StartVideoSubtitleTask linkToFile err", zap.Any("req", req), zap.Error(err))
+		stepParam.TaskPtr.Status = types.SubtitleTaskStatusFailed
+		stepParam.TaskPtr.FailReason = err.Error()
+		return
+	}
+	// 暂时不加视频信息
+	//err = s.getVideoInfo(ctx, stepParam)
+	//if err != nil {
+	//	log.GetLogger().Error("StartVideoSubtitleTask getVideoInfo err", zap.Any("req", req), zap.Error(err))
+	//	stepParam.TaskPtr.Status = types.SubtitleTaskStatusFailed
+	//	stepParam.TaskPtr.FailReason = "get video info error"
+	//	return
+	//}
+	err = s.audioToSubtitle(ctx, stepParam)
+	if err != nil {
+		log.GetLogger().Error("StartVideoSubtitleTask audioToSubtitle err", zap.Any("req", req), zap.Error(err))
+		stepParam.TaskPtr.Status = types.SubtitleTaskStatusFailed
+		stepParam.TaskPtr.FailReason = err.Error()
+		return
+	}
+	err = s.srtFileToSpeech(ctx, stepParam)
+	if err != nil {
+		log.GetLogger().Error("StartVideoSubtitleTask srtFileToSpeech err", zap.Any("req", req), zap.Error(err))
+		stepParam.TaskPtr.Status = types.SubtitleTaskStatusFailed
+		stepParam.TaskPtr.FailReason = err.Error()
+		return
+	}
+	err = s.embedSubtitles(ctx, stepParam)
+	if err != nil {
+		log.GetLogger().Error("StartVideoSubtitleTask embedSubtitles err", zap.Any("req", req), zap.Error(err))
+		stepParam.TaskPtr.Status = types.SubtitleTaskStatusFailed
+		stepParam.TaskPtr.FailReason = err.Error()
+		return
+	}
+	err = s.uploadSubtitles(ctx, stepParam)
+	if err != nil {
+		log.GetLogger().Error("StartVideoSubtitleTask uploadSubtitles err", zap.Any("req", req), zap.Error(err))
+		stepParam.TaskPtr.Status = types.SubtitleTaskStatusFailed
+		stepParam.TaskPtr.FailReason = err.Error()
+		return
+	}
 
-	return &dto.StartVideoSubtitleTaskResData{
-		TaskId: taskId,
-	}, nil
+	log.GetLogger().Info("video subtitle task end", zap.String("taskId", stepParam.TaskId))
+}
+
+// RunSubtitleTaskSync 在当前协程中执行完整的字幕任务，供命令行等进程内调用。
+// progress不为nil时，任务执行期间每秒回调一次当前进度
+func (s Service) RunSubtitleTaskSync(req dto.StartVideoSubtitleTaskReq, progress func(percent uint8)) (*types.SubtitleTaskStepParam, error) {
+	stepParam, err := s.newSubtitleTask(req)
+	if err != nil {
+		return nil, err
+	}
+	done := make(chan struct{})
+	if progress != nil {
+		go func() {
+			ticker := time.NewTicker(time.Second)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-done:
+					return
+				case <-ticker.C:
+					progress(stepParam.TaskPtr.ProcessPct)
+				}
+			}
+		}()
+	}
+	s.runSubtitleTask(req, stepParam)
+	close(done)
+	if stepParam.TaskPtr.Status != types.SubtitleTaskStatusSuccess {
+		return stepParam, fmt.Errorf("任务失败，原因：%s", stepParam.TaskPtr.FailReason)
+	}
+	return stepParam, nil
 }
 
 func (s Service) GetTaskStatus(req dto.GetVideoSubtitleTaskReq) (*dto.GetVideoSubtitleTaskResData, error) {
@@ -213,5 +293,27 @@ func (s Service) GetTaskStatus(req dto.GetVideoSubtitleTaskReq) (*dto.GetVideoSu
 		}),
 		TargetLanguage:    taskPtr.TargetLanguage,
 		SpeechDownloadUrl: taskPtr.SpeechDownloadUrl,
+		TtsCacheHit:       taskPtr.TtsCacheHitNum,
+		TtsCacheMiss:      taskPtr.TtsCacheMissNum,
+		TtsFailedSentences: lo.Map(taskPtr.TtsFailedSentences, func(item types.TtsFailedSentence, _ int) *dto.TtsFailedSentence {
+			return &dto.TtsFailedSentence{
+				Index:  item.Index,
+				Text:   item.Text,
+				Reason: item.Reason,
+			}
+		}),
+		Usage:    newTaskUsage(taskPtr),
+		QaReport: newQaReport(taskPtr.QaReport),
 	}, nil
 }
+
+// taskIdPrefix 取链接最后一段的前16个字符作为任务id前缀
+func taskIdPrefix(link string) string {
+	link = strings.TrimRight(link, "/")
+	seperates := strings.Split(link, "/")
+	prefix := []rune(strings.ReplaceAll(seperates[len(seperates)-1], " ", ""))
+	if len(prefix) > 16 {
+		prefix = prefix[:16]
+	}
+	return string(prefix)
+}
@@ -0,0 +1,344 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"krillin-ai/internal/types"
+	"krillin-ai/pkg/util"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// assStyle 解析后的一行字幕样式，尺寸以视频高度1080为基准
+type assStyle struct {
+	name         string
+	fontName     string
+	fontFile     string
+	fontSize     float64
+	bold         bool
+	primaryColor string // ASS颜色格式 &HAABBGGRR
+	outlineColor string
+	outline      float64
+	shadow       float64
+	spacing      float64
+	box          bool
+	boxColor     string
+	alignment    int
+	marginL      float64
+	marginR      float64
+	marginV      float64
+}
+
+// 样式尺寸以高1080的画面为基准，横屏基准宽1920，竖屏为9:16的607.5
+const (
+	assStyleReferenceHeight          = 1080
+	assStyleReferenceHorizontalWidth = 1920
+	assStyleReferenceVerticalWidth   = 607.5
+	// 竖屏基准宽度下每行的中文字数
+	assVerticalReferenceLineChars = 10
+)
+
+// 默认样式与原先固定的样式一致：橙色粗体Arial，黑色描边
+var (
+	defaultHorizontalMajorStyle = assStyle{
+		name: "Major", fontName: "Arial", fontSize: 52.5, bold: true,
+		primaryColor: "&H0000BFFF", outlineColor: "&H00000000", outline: 9.375, shadow: 5.625,
+		boxColor: "&H80000000", alignment: 2, marginL: 37.5, marginR: 37.5, marginV: 75,
+	}
+	defaultHorizontalMinorStyle = assStyle{
+		name: "Minor", fontName: "Arial", fontSize: 37.5, bold: true,
+		primaryColor: "&H0000BFFF", outlineColor: "&H00000000", outline: 9.375, shadow: 5.625,
+		boxColor: "&H80000000", alignment: 2, marginL: 37.5, marginR: 37.5, marginV: 112.5,
+	}
+	defaultVerticalMajorStyle = assStyle{
+		name: "Major", fontName: "Arial", fontSize: 56.25, bold: true,
+		primaryColor: "&H0000BFFF", outlineColor: "&H00000000", outline: 9.375, shadow: 5.625, spacing: -37.5,
+		boxColor: "&H80000000", alignment: 2, marginL: 37.5, marginR: 37.5, marginV: 300,
+	}
+	defaultVerticalMinorStyle = assStyle{
+		name: "Minor", fontName: "Arial", fontSize: 30, bold: true,
+		primaryColor: "&H0000BFFF", outlineColor: "&H00000000", outline: 9.375, shadow: 5.625, spacing: -37.5,
+		boxColor: "&H80000000", alignment: 2, marginL: 37.5, marginR: 37.5, marginV: 375,
+	}
+)
+
+var assColorRegexp = regexp.MustCompile(`^&H[0-9A-F]{1,8}&?$`)
+
+// subtitleAssStyles 按视频方向得到主、副字幕的样式
+func subtitleAssStyles(style types.SubtitleStyle, isHorizontal bool) (assStyle, assStyle, error) {
+	majorDefault, minorDefault := defaultVerticalMajorStyle, defaultVerticalMinorStyle
+	if isHorizontal {
+		majorDefault, minorDefault = defaultHorizontalMajorStyle, defaultHorizontalMinorStyle
+	}
+	major, err := resolveAssStyle(majorDefault, style.Major)
+	if err != nil {
+		return assStyle{}, assStyle{}, fmt.Errorf("major style: %w", err)
+	}
+	minor, err := resolveAssStyle(minorDefault, style.Minor)
+	if err != nil {
+		return assStyle{}, assStyle{}, fmt.Errorf("minor style: %w", err)
+	}
+	return major, minor, nil
+}
+
+// validateSubtitleStyle 创建任务时检查样式参数
+func validateSubtitleStyle(style types.SubtitleStyle) error {
+	if _, _, err := subtitleAssStyles(style, true); err != nil {
+		return err
+	}
+	for _, line := range []types.SubtitleLineStyle{style.Major, style.Minor} {
+		if line.FontFile == "" {
+			continue
+		}
+		if line.FontName == "" {
+			return errors.New("指定字体文件时需要同时填写字体名称font_name")
+		}
+		if _, err := os.Stat(line.FontFile); err != nil {
+			return fmt.Errorf("字体文件不存在: %s", line.FontFile)
+		}
+	}
+	return nil
+}
+
+func resolveAssStyle(style assStyle, override types.SubtitleLineStyle) (assStyle, error) {
+	var err error
+	if override.FontName != "" {
+		style.fontName = override.FontName
+	}
+	style.fontFile = override.FontFile
+	if override.FontSize > 0 {
+		style.fontSize = override.FontSize
+	}
+	if override.Bold != nil {
+		style.bold = *override.Bold
+	}
+	if override.PrimaryColor != "" {
+		if style.primaryColor, err = parseAssColor(override.PrimaryColor); err != nil {
+			return style, err
+		}
+	}
+	if override.OutlineColor != "" {
+		if style.outlineColor, err = parseAssColor(override.OutlineColor); err != nil {
+			return style, err
+		}
+	}
+	if override.BoxColor != "" {
+		if style.boxColor, err = parseAssColor(override.BoxColor); err != nil {
+			return style, err
+		}
+	}
+	if override.Box != nil {
+		style.box = *override.Box
+	}
+	if override.Alignment != 0 {
+		if override.Alignment < 1 || override.Alignment > 9 {
+			return style, fmt.Errorf("alignment必须为1-9: %d", override.Alignment)
+		}
+		style.alignment = override.Alignment
+	}
+	for _, item := range []struct {
+		value *float64
+		field *float64
+	}{
+		{override.Outline, &style.outline},
+		{override.Shadow, &style.shadow},
+		{override.Spacing, &style.spacing},
+		{override.MarginL, &style.marginL},
+		{override.MarginR, &style.marginR},
+		{override.MarginV, &style.marginV},
+	} {
+		if item.value != nil {
+			*item.field = *item.value
+		}
+	}
+	if style.outline < 0 || style.shadow < 0 || style.marginL < 0 || style.marginR < 0 || style.marginV < 0 {
+		return style, errors.New("描边、阴影和边距不能为负数")
+	}
+	return style, nil
+}
+
+// parseAssColor 把#RRGGBB、#AARRGGBB或ASS格式的颜色转换为ASS的&HAABBGGRR
+func parseAssColor(color string) (string, error) {
+	color = strings.ToUpper(strings.TrimSpace(color))
+	if strings.HasPrefix(color, "&H") {
+		if !assColorRegexp.MatchString(color) {
+			return "", fmt.Errorf("颜色格式不正确: %s", color)
+		}
+		hex := strings.TrimSuffix(strings.TrimPrefix(color, "&H"), "&")
+		return "&H" + strings.Repeat("0", 8-len(hex)) + hex, nil
+	}
+	hex := strings.TrimPrefix(color, "#")
+	if _, err := strconv.ParseUint(hex, 16, 32); err != nil || (len(hex) != 6 && len(hex) != 8) {
+		return "", fmt.Errorf("颜色格式不正确，应为#RRGGBB或#AARRGGBB: %s", color)
+	}
+	alpha := "00"
+	if len(hex) == 8 {
+		alpha, hex = hex[:2], hex[2:]
+	}
+	return "&H" + alpha + hex[4:6] + hex[2:4] + hex[0:2], nil
+}
+
+// assCanvasScale 样式尺寸相对基准画面的缩放比例，画面比基准更窄时按宽度缩放，避免字幕超出画面
+func assCanvasScale(width, height int, isHorizontal bool) float64 {
+	referenceWidth := float64(assStyleReferenceVerticalWidth)
+	if isHorizontal {
+		referenceWidth = assStyleReferenceHorizontalWidth
+	}
+	return min(float64(height)/assStyleReferenceHeight, float64(width)/referenceWidth)
+}
+
+// assVerticalLineChars 竖屏布局下每行的中文字数，画面比9:16宽时相应增加
+func assVerticalLineChars(width int, scale float64) int {
+	return max(int(math.Round(assVerticalReferenceLineChars*float64(width)/scale/assStyleReferenceVerticalWidth)), 4)
+}
+
+// buildAssHeader 生成ASS文件头，坐标系与视频分辨率一致，尺寸按scale缩放
+func buildAssHeader(width, height int, scale float64, styles ...assStyle) string {
+	lines := make([]string, 0, len(styles))
+	for _, style := range styles {
+		lines = append(lines, style.assLine(scale))
+	}
+	return fmt.Sprintf(types.AssHeaderFormat, width, height, strings.Join(lines, "\n"))
+}
+
+func (s assStyle) assLine(scale float64) string {
+	bold := 0
+	if s.bold {
+		bold = -1
+	}
+	// BorderStyle 1为描边加阴影，3为背景框，背景框颜色取OutlineColour，阴影颜色取BackColour
+	borderStyle, outlineColor, backColor := 1, s.outlineColor, "&H64000000"
+	if s.box {
+		borderStyle, outlineColor, backColor = 3, s.boxColor, s.boxColor
+	}
+	return fmt.Sprintf("Style: %s,%s,%s,%s,&H000000FF,%s,%s,%d,0,0,0,100,100,%s,0,%d,%s,%s,%d,%d,%d,%d,1",
+		s.name, s.fontName, formatAssNumber(s.fontSize*scale), s.primaryColor, outlineColor, backColor, bold,
+		formatAssNumber(s.spacing*scale), borderStyle, formatAssNumber(s.outline*scale), formatAssNumber(s.shadow*scale),
+		s.alignment, int(math.Round(s.marginL*scale)), int(math.Round(s.marginR*scale)), int(math.Round(s.marginV*scale)))
+}
+
+func formatAssNumber(value float64) string {
+	return strconv.FormatFloat(math.Round(value*100)/100, 'f', -1, 64)
+}
+
+// prepareSubtitleFonts 把样式指定的字体文件复制到任务目录，返回供ass滤镜使用的字体目录，没有指定字体文件时返回空
+func prepareSubtitleFonts(stepParam *types.SubtitleTaskStepParam) (string, error) {
+	var fontFiles []string
+	for _, line := range []types.SubtitleLineStyle{stepParam.SubtitleStyle.Major, stepParam.SubtitleStyle.Minor} {
+		if line.FontFile != "" {
+			fontFiles = append(fontFiles, line.FontFile)
+		}
+	}
+	if len(fontFiles) == 0 {
+		return "", nil
+	}
+	fontsDir := filepath.Join(stepParam.TaskBasePath, types.SubtitleTaskFontsDirName)
+	if err := os.MkdirAll(fontsDir, os.ModePerm); err != nil {
+		return "", err
+	}
+	for _, fontFile := range fontFiles {
+		if err := util.CopyFile(fontFile, filepath.Join(fontsDir, filepath.Base(fontFile))); err != nil {
+			return "", fmt.Errorf("copy font file %s error: %w", fontFile, err)
+		}
+	}
+	return fontsDir, nil
+}
+
+// getFontPaths 返回竖屏标题使用的粗体和常规字体文件，已转义为ffmpeg滤镜参数中的写法。
+// 依次使用样式指定的字体文件、按字体名称用fc-match查找、系统默认字体。
+func getFontPaths(style types.SubtitleStyle) (string, string, error) {
+	bold, regular := style.Major.FontFile, style.Minor.FontFile
+	if bold == "" {
+		bold = matchFontFile(style.Major.FontName, true)
+	}
+	if regular == "" {
+		regular = matchFontFile(style.Minor.FontName, false)
+	}
+	if bold == "" || regular == "" {
+		defaultBold, defaultRegular, err := defaultFontPaths()
+		if err != nil {
+			return "", "", err
+		}
+		if bold == "" {
+			bold = defaultBold
+		}
+		if regular == "" {
+			regular = defaultRegular
+		}
+	}
+	return ffmpegFilterPath(bold), ffmpegFilterPath(regular), nil
+}
+
+// matchFontFile 用fontconfig按名称查找字体文件，没有fc-match或未找到时返回空
+func matchFontFile(fontName string, bold bool) string {
+	if fontName == "" {
+		return ""
+	}
+	fcMatch, err := exec.LookPath("fc-match")
+	if err != nil {
+		return ""
+	}
+	pattern := fontName
+	if bold {
+		pattern += ":bold"
+	}
+	output, err := exec.Command(fcMatch, "-f", "%{file}", pattern).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// defaultFontPaths 各平台的默认字体，按顺序使用第一个存在的，都不存在时返回列出这些字体的错误
+func defaultFontPaths() (string, string, error) {
+	var candidates [][2]string
+	switch runtime.GOOS {
+	case "windows":
+		candidates = [][2]string{
+			{"C:/Windows/Fonts/msyhbd.ttc", "C:/Windows/Fonts/msyh.ttc"},
+			{"C:/Windows/Fonts/arialbd.ttf", "C:/Windows/Fonts/arial.ttf"},
+		}
+	case "darwin":
+		candidates = [][2]string{
+			{"/System/Library/Fonts/Supplemental/Arial Bold.ttf", "/System/Library/Fonts/Supplemental/Arial.ttf"},
+			{"/System/Library/Fonts/PingFang.ttc", "/System/Library/Fonts/PingFang.ttc"},
+		}
+	case "linux":
+		candidates = [][2]string{
+			{"/usr/share/fonts/truetype/dejavu/DejaVuSans-Bold.ttf", "/usr/share/fonts/truetype/dejavu/DejaVuSans.ttf"},
+			{"/usr/share/fonts/opentype/noto/NotoSansCJK-Bold.ttc", "/usr/share/fonts/opentype/noto/NotoSansCJK-Regular.ttc"},
+			{"/usr/share/fonts/truetype/liberation/LiberationSans-Bold.ttf", "/usr/share/fonts/truetype/liberation/LiberationSans-Regular.ttf"},
+		}
+	default:
+		return "", "", fmt.Errorf("unsupported OS: %s", runtime.GOOS)
+	}
+	for _, candidate := range candidates {
+		if _, err := os.Stat(candidate[0]); err != nil {
+			continue
+		}
+		if _, err := os.Stat(candidate[1]); err != nil {
+			continue
+		}
+		return candidate[0], candidate[1], nil
+	}
+	var missing []string
+	for _, candidate := range candidates {
+		missing = append(missing, candidate[0], candidate[1])
+	}
+	return "", "", fmt.Errorf("未找到默认字体，请安装以下字体之一或在字幕样式中指定font_file: %s", strings.Join(missing, ", "))
+}
+
+// ffmpegFilterPath 滤镜参数中的路径使用/分隔，Windows盘符的冒号需要转义
+func ffmpegFilterPath(path string) string {
+	path = strings.ReplaceAll(path, "\\", "/")
+	if runtime.GOOS == "windows" {
+		path = strings.ReplaceAll(path, ":", "\\:")
+	}
+	return path
+}
@@ -0,0 +1,33 @@
+package service
+
+import "testing"
+
+func Test_parseAssColor(t *testing.T) {
+	tests := []struct {
+		color   string
+		want    string
+		wantErr bool
+	}{
+		{color: "#FFFFFF", want: "&H00FFFFFF"},
+		{color: "#ff8000", want: "&H000080FF"},
+		{color: " #112233 ", want: "&H00332211"},
+		{color: "#80FF0000", want: "&H800000FF"},
+		{color: "&H00FFFF", want: "&H0000FFFF"},
+		{color: "&H64000000&", want: "&H64000000"},
+		{color: "#FFF", wantErr: true},
+		{color: "#GGGGGG", wantErr: true},
+		{color: "red", wantErr: true},
+		{color: "&HXYZ", wantErr: true},
+		{color: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseAssColor(tt.color)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseAssColor(%q) error = %v, wantErr %v", tt.color, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseAssColor(%q) = %q, want %q", tt.color, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"krillin-ai/internal/dto"
+	"krillin-ai/internal/types"
+	"krillin-ai/pkg/util"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const taskPresetMaxNameLength = 64
+
+// 预设中不允许保存的字段
+var taskPresetExcludedFields = []string{"url", "preset"}
+
+var taskPresetLock sync.Mutex
+
+// ListTaskPresets 列出所有预设
+func (s Service) ListTaskPresets() ([]types.TaskPreset, error) {
+	taskPresetLock.Lock()
+	defer taskPresetLock.Unlock()
+	return loadTaskPresets()
+}
+
+// GetTaskPreset 获取指定名称的预设
+func (s Service) GetTaskPreset(name string) (*types.TaskPreset, error) {
+	taskPresetLock.Lock()
+	defer taskPresetLock.Unlock()
+	presets, err := loadTaskPresets()
+	if err != nil {
+		return nil, err
+	}
+	for _, preset := range presets {
+		if preset.Name == name {
+			return &preset, nil
+		}
+	}
+	return nil, fmt.Errorf("预设不存在: %s", name)
+}
+
+// SaveTaskPreset 创建或更新预设
+func (s Service) SaveTaskPreset(req dto.SaveTaskPresetReq) (*types.TaskPreset, error) {
+	if req.Name == "" {
+		return nil, errors.New("预设名称不能为空")
+	}
+	if len([]rune(req.Name)) > taskPresetMaxNameLength {
+		return nil, fmt.Errorf("预设名称过长，最多%d个字符", taskPresetMaxNameLength)
+	}
+	options, err := normalizeTaskPresetOptions(req.Options)
+	if err != nil {
+		return nil, err
+	}
+
+	taskPresetLock.Lock()
+	defer taskPresetLock.Unlock()
+	presets, err := loadTaskPresets()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().Unix()
+	saved := types.TaskPreset{Name: req.Name, Options: options, CreateTime: now, UpdateTime: now}
+	updated := false
+	for i, preset := range presets {
+		if preset.Name == req.Name {
+			saved.CreateTime = preset.CreateTime
+			presets[i] = saved
+			updated = true
+			break
+		}
+	}
+	if !updated {
+		presets = append(presets, saved)
+	}
+	if err = saveTaskPresets(presets); err != nil {
+		return nil, err
+	}
+	return &saved, nil
+}
+
+// DeleteTaskPreset 删除预设
+func (s Service) DeleteTaskPreset(name string) error {
+	taskPresetLock.Lock()
+	defer taskPresetLock.Unlock()
+	presets, err := loadTaskPresets()
+	if err != nil {
+		return err
+	}
+	for i, preset := range presets {
+		if preset.Name == name {
+			return saveTaskPresets(append(presets[:i], presets[i+1:]...))
+		}
+	}
+	return fmt.Errorf("预设不存在: %s", name)
+}
+
+// ApplyTaskPreset 解析创建任务的请求体到req，请求中指定了预设时先填入预设的字段，再用请求中出现的字段覆盖。
+// 嵌套的对象（如subtitle_style）逐个字段覆盖，数组和其他值整个替换
+func (s Service) ApplyTaskPreset(body []byte, req any) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return fmt.Errorf("参数错误: %w", err)
+	}
+	var name string
+	if raw, ok := fields["preset"]; ok {
+		if err := json.Unmarshal(raw, &name); err != nil {
+			return fmt.Errorf("参数错误: %w", err)
+		}
+	}
+	if name == "" {
+		if err := json.Unmarshal(body, req); err != nil {
+			return fmt.Errorf("参数错误: %w", err)
+		}
+		return nil
+	}
+
+	preset, err := s.GetTaskPreset(name)
+	if err != nil {
+		return err
+	}
+	merged := make(map[string]json.RawMessage)
+	if err = json.Unmarshal(preset.Options, &merged); err != nil {
+		return fmt.Errorf("预设内容错误: %w", err)
+	}
+	if err = mergeJsonFields(merged, fields); err != nil {
+		return fmt.Errorf("参数错误: %w", err)
+	}
+	data, err := json.Marshal(merged)
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(data, req); err != nil {
+		return fmt.Errorf("参数错误: %w", err)
+	}
+	return nil
+}
+
+// mergeJsonFields 把override中的字段合并到base，两边都是对象的字段递归合并，其他情况用override的值替换
+func mergeJsonFields(base, override map[string]json.RawMessage) error {
+	for key, value := range override {
+		baseValue, ok := base[key]
+		if !ok || !isJsonObject(baseValue) || !isJsonObject(value) {
+			base[key] = value
+			continue
+		}
+		var baseFields, overrideFields map[string]json.RawMessage
+		if err := json.Unmarshal(baseValue, &baseFields); err != nil {
+			return err
+		}
+		if err := json.Unmarshal(value, &overrideFields); err != nil {
+			return err
+		}
+		if err := mergeJsonFields(baseFields, overrideFields); err != nil {
+			return err
+		}
+		data, err := json.Marshal(baseFields)
+		if err != nil {
+			return err
+		}
+		base[key] = data
+	}
+	return nil
+}
+
+func isJsonObject(value json.RawMessage) bool {
+	trimmed := bytes.TrimSpace(value)
+	return len(trimmed) > 0 && trimmed[0] == '{'
+}
+
+// normalizeTaskPresetOptions 校验预设字段能被解析为任务请求，并去掉不允许保存的字段
+func normalizeTaskPresetOptions(options json.RawMessage) (json.RawMessage, error) {
+	if len(options) == 0 {
+		return nil, errors.New("预设内容不能为空")
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(options, &fields); err != nil {
+		return nil, fmt.Errorf("预设内容错误: %w", err)
+	}
+	for _, key := range taskPresetExcludedFields {
+		delete(fields, key)
+	}
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+	var req dto.StartVideoSubtitleTaskReq
+	if err = json.Unmarshal(data, &req); err != nil {
+		return nil, fmt.Errorf("预设内容错误: %w", err)
+	}
+	return data, nil
+}
+
+// 调用方需持有taskPresetLock
+func loadTaskPresets() ([]types.TaskPreset, error) {
+	presets := make([]types.TaskPreset, 0)
+	data, err := os.ReadFile(types.TaskPresetFilePath)
+	if os.IsNotExist(err) {
+		return presets, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(data, &presets); err != nil {
+		return nil, fmt.Errorf("parse task presets error: %w", err)
+	}
+	return presets, nil
+}
+
+// 调用方需持有taskPresetLock
+func saveTaskPresets(presets []types.TaskPreset) error {
+	if err := os.MkdirAll(filepath.Dir(types.TaskPresetFilePath), os.ModePerm); err != nil {
+		return err
+	}
+	return util.SaveToDisk(presets, types.TaskPresetFilePath)
+}
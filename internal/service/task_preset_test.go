@@ -0,0 +1,99 @@
+package service
+
+import (
+	"encoding/json"
+	"krillin-ai/internal/dto"
+	"os"
+	"testing"
+)
+
+func TestService_ApplyTaskPreset(t *testing.T) {
+	// 预设文件使用相对路径，在临时目录中运行
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	var s Service
+	_, err = s.SaveTaskPreset(dto.SaveTaskPresetReq{Name: "base", Options: json.RawMessage(`{
+		"url": "ignored",
+		"target_lang": "zh_cn",
+		"replace": ["a|b", "c|d"],
+		"tts_voice_code": "voice1",
+		"subtitle_style": {"major": {"font_name": "Arial", "font_size": 20, "primary_color": "#FFFFFF"}, "minor": {"font_size": 14}}
+	}`)})
+	if err != nil {
+		t.Fatalf("SaveTaskPreset() error = %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		body  string
+		check func(t *testing.T, req dto.StartVideoSubtitleTaskReq)
+	}{
+		{
+			name: "preset fields fill the request",
+			body: `{"url": "local:a.mp4", "preset": "base"}`,
+			check: func(t *testing.T, req dto.StartVideoSubtitleTaskReq) {
+				if req.Url != "local:a.mp4" || req.TargetLang != "zh_cn" || req.TtsVoiceCode != "voice1" || len(req.Replace) != 2 {
+					t.Errorf("req = %+v", req)
+				}
+			},
+		},
+		{
+			name: "request scalars and arrays replace preset values",
+			body: `{"url": "local:a.mp4", "preset": "base", "target_lang": "en", "replace": ["x|y"], "tts_voice_code": ""}`,
+			check: func(t *testing.T, req dto.StartVideoSubtitleTaskReq) {
+				if req.TargetLang != "en" || len(req.Replace) != 1 || req.Replace[0] != "x|y" || req.TtsVoiceCode != "" {
+					t.Errorf("req = %+v", req)
+				}
+			},
+		},
+		{
+			name: "nested objects merge field by field",
+			body: `{"url": "local:a.mp4", "preset": "base", "subtitle_style": {"major": {"font_size": 30}}}`,
+			check: func(t *testing.T, req dto.StartVideoSubtitleTaskReq) {
+				major, minor := req.SubtitleStyle.Major, req.SubtitleStyle.Minor
+				if major.FontName != "Arial" || major.FontSize != 30 || major.PrimaryColor != "#FFFFFF" || minor.FontSize != 14 {
+					t.Errorf("subtitle style = %+v", req.SubtitleStyle)
+				}
+			},
+		},
+		{
+			name: "null clears a preset object",
+			body: `{"url": "local:a.mp4", "preset": "base", "subtitle_style": null}`,
+			check: func(t *testing.T, req dto.StartVideoSubtitleTaskReq) {
+				if req.SubtitleStyle.Major.FontName != "" || req.SubtitleStyle.Major.FontSize != 0 {
+					t.Errorf("subtitle style = %+v", req.SubtitleStyle)
+				}
+			},
+		},
+		{
+			name: "no preset",
+			body: `{"url": "local:a.mp4", "target_lang": "ja"}`,
+			check: func(t *testing.T, req dto.StartVideoSubtitleTaskReq) {
+				if req.TargetLang != "ja" || req.TtsVoiceCode != "" {
+					t.Errorf("req = %+v", req)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req dto.StartVideoSubtitleTaskReq
+			if err := s.ApplyTaskPreset([]byte(tt.body), &req); err != nil {
+				t.Fatalf("ApplyTaskPreset() error = %v", err)
+			}
+			tt.check(t, req)
+		})
+	}
+
+	var req dto.StartVideoSubtitleTaskReq
+	if err = s.ApplyTaskPreset([]byte(`{"url": "local:a.mp4", "preset": "missing"}`), &req); err == nil {
+		t.Error("ApplyTaskPreset() with missing preset, want error")
+	}
+}
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"errors"
+	"krillin-ai/config"
+	"krillin-ai/internal/types"
+	"krillin-ai/log"
+	"testing"
+)
+
+type stubTranscriber struct {
+	err   error
+	calls int
+}
+
+func (t *stubTranscriber) Transcription(audioFile, language, wordDir string) (*types.TranscriptionData, error) {
+	t.calls++
+	if t.err != nil {
+		return nil, t.err
+	}
+	return &types.TranscriptionData{Text: "hello"}, nil
+}
+
+func Test_newTranscriber_unsupported(t *testing.T) {
+	if transcriber, err := newTranscriber("unknown"); err == nil || transcriber != nil {
+		t.Errorf("newTranscriber(unknown) = %v, %v, want unsupported provider error", transcriber, err)
+	}
+}
+
+func Test_transcribeWithFallback(t *testing.T) {
+	log.InitLogger()
+	maxAttempts := config.Conf.App.TranscribeMaxAttempts
+	config.Conf.App.TranscribeMaxAttempts = 2
+	defer func() { config.Conf.App.TranscribeMaxAttempts = maxAttempts }()
+
+	tests := []struct {
+		name         string
+		errs         []error // 各提供商返回的错误
+		wantProvider string  // 为空时期望全部失败
+		wantCalls    []int
+	}{
+		{name: "primary success", errs: []error{nil, nil}, wantProvider: "primary", wantCalls: []int{1, 0}},
+		{name: "fallback success", errs: []error{errors.New("primary down"), nil}, wantProvider: "fallback", wantCalls: []int{2, 1}},
+		{name: "all failed", errs: []error{errors.New("primary down"), errors.New("fallback down")}, wantCalls: []int{2, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubs := []*stubTranscriber{{err: tt.errs[0]}, {err: tt.errs[1]}}
+			s := Service{
+				Transcribers: []NamedTranscriber{
+					{Provider: "primary", Transcriber: stubs[0]},
+					{Provider: "fallback", Transcriber: stubs[1]},
+				},
+				usage: &types.TaskUsage{},
+			}
+			data, err := s.transcribeWithFallback(1, "missing.mp3", "en", t.TempDir())
+			for i, stub := range stubs {
+				if stub.calls != tt.wantCalls[i] {
+					t.Errorf("transcriber %d calls = %d, want %d", i, stub.calls, tt.wantCalls[i])
+				}
+			}
+			usages := s.usage.Snapshot()
+			if tt.wantProvider == "" {
+				if err == nil || data != nil {
+					t.Fatalf("transcribeWithFallback() = %v, %v, want error", data, err)
+				}
+				if len(usages) != 0 {
+					t.Errorf("usage = %v, want none", usages)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("transcribeWithFallback() error = %v", err)
+			}
+			if data.Provider != tt.wantProvider {
+				t.Errorf("transcription provider = %s, want %s", data.Provider, tt.wantProvider)
+			}
+			if len(usages) != 1 || usages[0].Kind != types.UsageKindTranscribe || usages[0].Provider != tt.wantProvider || usages[0].Calls != 1 {
+				t.Errorf("usage = %+v, want one transcribe call for %s", usages, tt.wantProvider)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package service
+
+import (
+	"krillin-ai/config"
+	"krillin-ai/internal/types"
+	"krillin-ai/log"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// ttsCache 语音合成缓存，相同提供商、模型、音色和文本的句子只合成一次
+var ttsCache = newFileCache("tts", ".wav", func() config.CacheConfig { return config.Conf.Tts.Cache })
+
+// ttsCacheKey 由提供商、模型、音色和规范化后的文本计算缓存键
+func ttsCacheKey(provider, model, voice, text string) string {
+	normalized := strings.Join(strings.Fields(text), " ")
+	return cacheKey(provider, model, strings.TrimSpace(voice), normalized)
+}
+
+// ttsProviderModel 当前提供商实际使用的模型，作为缓存键的一部分
+func ttsProviderModel(provider string) string {
+	if provider == "openai" {
+		return config.Conf.Tts.Openai.Model
+	}
+	return ""
+}
+
+// synthesize 合成语音到outputFile，命中缓存时直接复制缓存文件，返回是否命中
+func (s Service) synthesize(ttsClient types.Ttser, provider, text, voice, outputFile string) (bool, error) {
+	if !ttsCache.enabled() {
+		return false, s.text2Speech(ttsClient, provider, text, voice, outputFile)
+	}
+	key := ttsCacheKey(provider, ttsProviderModel(provider), voice, text)
+	if ttsCache.loadFile(key, outputFile) {
+		return true, nil
+	}
+	if err := s.text2Speech(ttsClient, provider, text, voice, outputFile); err != nil {
+		return false, err
+	}
+	if err := ttsCache.storeFile(key, outputFile); err != nil {
+		// 缓存失败不影响合成结果
+		log.GetLogger().Warn("synthesize store tts cache error", zap.String("key", key), zap.Error(err))
+	}
+	return false, nil
+}
+
+// text2Speech 实际调用合成并记录用量
+func (s Service) text2Speech(ttsClient types.Ttser, provider, text, voice, outputFile string) error {
+	if err := text2SpeechWithLimit(ttsClient, provider, text, voice, outputFile); err != nil {
+		return err
+	}
+	recordUsage(s.usage, types.ProviderUsage{Kind: types.UsageKindTts, Provider: provider, Calls: 1, TtsChars: len([]rune(text))})
+	return nil
+}
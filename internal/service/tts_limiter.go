@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"krillin-ai/config"
+	"krillin-ai/internal/types"
+	"krillin-ai/log"
+	"math/rand"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+)
+
+// ttsLimiter 单个提供商的并发和速率限制，所有任务共享，避免多个任务同时配音时触发429
+type ttsLimiter struct {
+	conf      config.TtsLimitConfig
+	semaphore chan struct{}
+	rate      *rate.Limiter // 为nil时不限速
+}
+
+var (
+	ttsLimitersLock sync.Mutex
+	ttsLimiters     = make(map[string]*ttsLimiter)
+)
+
+// getTtsLimiter 获取提供商的限流器，配置变化后重新创建，已在进行中的请求不受影响
+func getTtsLimiter(provider string) *ttsLimiter {
+	conf := config.Conf.Tts.LimitOf(provider)
+	ttsLimitersLock.Lock()
+	defer ttsLimitersLock.Unlock()
+	if limiter, ok := ttsLimiters[provider]; ok && limiter.conf == conf {
+		return limiter
+	}
+	limiter := &ttsLimiter{
+		conf:      conf,
+		semaphore: make(chan struct{}, conf.Concurrency),
+	}
+	if conf.RequestsPerMinute > 0 {
+		limiter.rate = rate.NewLimiter(rate.Limit(float64(conf.RequestsPerMinute)/60), 1)
+	}
+	ttsLimiters[provider] = limiter
+	return limiter
+}
+
+// text2SpeechWithLimit 按提供商的限流配置调用合成，限流、服务端错误和网络错误指数退避重试，其他错误直接返回
+func text2SpeechWithLimit(ttsClient types.Ttser, provider, text, voice, outputFile string) error {
+	limiter := getTtsLimiter(provider)
+	var err error
+	for attempt := 1; attempt <= limiter.conf.MaxAttempts; attempt++ {
+		err = limiter.do(func() error {
+			return ttsClient.Text2Speech(text, voice, outputFile)
+		})
+		if err == nil {
+			return nil
+		}
+		if !isRetryableTtsError(err) {
+			return err
+		}
+		if attempt < limiter.conf.MaxAttempts {
+			wait := retryBackoff(limiter.conf.RetryBackoffMs, attempt)
+			log.GetLogger().Warn("text2SpeechWithLimit 合成失败，等待重试",
+				zap.String("provider", provider),
+				zap.Int("attempt", attempt),
+				zap.Duration("wait", wait),
+				zap.Error(err))
+			time.Sleep(wait)
+		}
+	}
+	return fmt.Errorf("tts failed after %d attempts: %w", limiter.conf.MaxAttempts, err)
+}
+
+// isRetryableTtsError 失败是否值得重试：429、5xx、网络错误和客户端判断的暂时性错误
+func isRetryableTtsError(err error) bool {
+	var statusErr *types.TtsStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode >= http.StatusInternalServerError
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	return errors.Is(err, types.ErrTtsTemporary) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, context.DeadlineExceeded)
+}
+
+func (l *ttsLimiter) do(fn func() error) error {
+	l.semaphore <- struct{}{}
+	defer func() { <-l.semaphore }()
+	if l.rate != nil {
+		if err := l.rate.Wait(context.Background()); err != nil {
+			return err
+		}
+	}
+	return fn()
+}
+
+// retryBackoff 第n次失败后的等待时间：base*2^(n-1)，再加上最多一半的随机抖动
+func retryBackoff(baseMs int, attempt int) time.Duration {
+	wait := time.Duration(baseMs) * time.Millisecond << (attempt - 1)
+	return wait + time.Duration(rand.Int63n(int64(wait)/2+1))
+}
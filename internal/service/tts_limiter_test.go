@@ -0,0 +1,92 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"krillin-ai/config"
+	"krillin-ai/internal/types"
+	"krillin-ai/log"
+	"net"
+	"testing"
+	"time"
+)
+
+func Test_retryBackoff(t *testing.T) {
+	tests := []struct {
+		baseMs  int
+		attempt int
+		min     time.Duration
+	}{
+		{baseMs: 1000, attempt: 1, min: time.Second},
+		{baseMs: 1000, attempt: 2, min: 2 * time.Second},
+		{baseMs: 1000, attempt: 3, min: 4 * time.Second},
+		{baseMs: 0, attempt: 1, min: 0},
+	}
+	for _, tt := range tests {
+		for range 100 {
+			got := retryBackoff(tt.baseMs, tt.attempt)
+			// 抖动最多为等待时间的一半
+			if got < tt.min || got > tt.min+tt.min/2 {
+				t.Fatalf("retryBackoff(%d, %d) = %v, want in [%v, %v]", tt.baseMs, tt.attempt, got, tt.min, tt.min+tt.min/2)
+			}
+		}
+	}
+}
+
+func Test_isRetryableTtsError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "429", err: &types.TtsStatusError{Provider: "openai", StatusCode: 429}, want: true},
+		{name: "503", err: fmt.Errorf("wrap: %w", &types.TtsStatusError{Provider: "openai", StatusCode: 503}), want: true},
+		{name: "400", err: &types.TtsStatusError{Provider: "openai", StatusCode: 400}, want: false},
+		{name: "401", err: &types.TtsStatusError{Provider: "openai", StatusCode: 401}, want: false},
+		{name: "network", err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}, want: true},
+		{name: "temporary", err: fmt.Errorf("edge-tts 执行超时: %w", types.ErrTtsTemporary), want: true},
+		{name: "other", err: errors.New("invalid voice"), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRetryableTtsError(tt.err); got != tt.want {
+				t.Errorf("isRetryableTtsError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+type fakeTtser struct {
+	errs  []error
+	calls int
+}
+
+func (f *fakeTtser) Text2Speech(text, voice, outputFile string) error {
+	f.calls++
+	if f.calls <= len(f.errs) {
+		return f.errs[f.calls-1]
+	}
+	return nil
+}
+
+func Test_text2SpeechWithLimit(t *testing.T) {
+	log.InitLogger()
+	config.Conf.Tts.Limit = map[string]config.TtsLimitConfig{"fake": {MaxAttempts: 3, RetryBackoffMs: 1}}
+	defer func() { config.Conf.Tts.Limit = nil }()
+
+	// 限流后重试成功
+	client := &fakeTtser{errs: []error{&types.TtsStatusError{Provider: "fake", StatusCode: 429}}}
+	if err := text2SpeechWithLimit(client, "fake", "text", "voice", "out.wav"); err != nil || client.calls != 2 {
+		t.Errorf("retryable error: err = %v, calls = %d, want nil and 2", err, client.calls)
+	}
+	// 参数错误不重试
+	client = &fakeTtser{errs: []error{&types.TtsStatusError{Provider: "fake", StatusCode: 400}}}
+	if err := text2SpeechWithLimit(client, "fake", "text", "voice", "out.wav"); err == nil || client.calls != 1 {
+		t.Errorf("non-retryable error: err = %v, calls = %d, want error and 1", err, client.calls)
+	}
+	// 一直失败时尝试max_attempts次
+	client = &fakeTtser{errs: []error{types.ErrTtsTemporary, types.ErrTtsTemporary, types.ErrTtsTemporary}}
+	if err := text2SpeechWithLimit(client, "fake", "text", "voice", "out.wav"); !errors.Is(err, types.ErrTtsTemporary) || client.calls != 3 {
+		t.Errorf("exhausted: err = %v, calls = %d, want ErrTtsTemporary and 3", err, client.calls)
+	}
+}
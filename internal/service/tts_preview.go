@@ -0,0 +1,93 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"krillin-ai/config"
+	"krillin-ai/internal/dto"
+	"krillin-ai/internal/types"
+	"krillin-ai/log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+)
+
+// 相同的试听请求并发到达时只合成一次
+var ttsPreviewGroup singleflight.Group
+
+// ttsPreviewCache 试听音频，与语音合成缓存一样按最近使用淘汰，不受tts缓存开关影响
+var ttsPreviewCache = newFileCache("tts_preview", ".wav", func() config.CacheConfig {
+	return config.CacheConfig{Enable: true, Dir: types.TtsPreviewDir, MaxSizeMb: types.TtsPreviewMaxSizeMb}
+})
+
+// TtsPreview 合成单句试听音频，相同的文本、音色、提供商和模型直接复用之前的结果
+func (s Service) TtsPreview(req dto.TtsPreviewReq) (*dto.TtsPreviewResData, error) {
+	text := strings.TrimSpace(req.Text)
+	if text == "" {
+		return nil, errors.New("试听文本不能为空")
+	}
+	if len([]rune(text)) > types.TtsPreviewMaxTextLength {
+		return nil, fmt.Errorf("试听文本过长，最多%d个字符", types.TtsPreviewMaxTextLength)
+	}
+	provider := req.Provider
+	if provider == "" {
+		provider = config.Conf.Tts.Provider
+	}
+	if req.TtsVoiceCloneSrcFileUrl == "" && req.TtsVoiceCode == "" {
+		return nil, errors.New("音色不能为空")
+	}
+	if req.TtsVoiceCloneSrcFileUrl != "" && config.Conf.Tts.VoiceClone.Provider == "aliyun" && provider != "aliyun" {
+		return nil, errors.New("阿里云克隆的音色仅支持阿里云tts")
+	}
+
+	ttsClient := s.TtsClient
+	if provider != config.Conf.Tts.Provider || ttsClient == nil {
+		ttsClient = newTtsClient(provider)
+	}
+	if ttsClient == nil {
+		return nil, fmt.Errorf("不支持的tts提供商: %s", provider)
+	}
+
+	key := cacheKey(provider, ttsProviderModel(provider), req.TtsVoiceCode, req.TtsVoiceCloneSrcFileUrl, text)
+	outputFile := ttsPreviewCache.path(key)
+	res := &dto.TtsPreviewResData{AudioUrl: "/api/file/" + filepath.ToSlash(outputFile)}
+	if ttsPreviewCache.exists(key) {
+		res.Cached = true
+		return res, nil
+	}
+
+	_, err, _ := ttsPreviewGroup.Do(key, func() (any, error) {
+		if ttsPreviewCache.exists(key) {
+			return nil, nil
+		}
+		voiceCode := req.TtsVoiceCode
+		if req.TtsVoiceCloneSrcFileUrl != "" {
+			var err error
+			voiceCode, err = s.cloneVoice(strings.TrimPrefix(req.TtsVoiceCloneSrcFileUrl, "local:"))
+			if err != nil {
+				return nil, fmt.Errorf("TtsPreview cloneVoice error: %w", err)
+			}
+		}
+
+		// 先合成到缓存目录之外的临时文件，成功后再存入缓存，避免半成品被当作缓存或被淘汰。
+		// 试听只保存在试听缓存中，不经过语音合成缓存；试听不属于任何任务，不记录用量
+		tmpFile := filepath.Join(os.TempDir(), "tts_preview_"+key+".wav")
+		defer os.Remove(tmpFile)
+		if err := text2SpeechWithLimit(ttsClient, provider, text, voiceCode, tmpFile); err != nil {
+			return nil, fmt.Errorf("TtsPreview synthesize error: %w", err)
+		}
+		if err := ttsPreviewCache.storeFile(key, tmpFile); err != nil {
+			return nil, fmt.Errorf("TtsPreview store error: %w", err)
+		}
+		return nil, nil
+	})
+	if err != nil {
+		log.GetLogger().Error("TtsPreview error", zap.Any("req", req), zap.Error(err))
+		return nil, err
+	}
+	log.GetLogger().Info("TtsPreview success", zap.String("provider", provider), zap.String("output", outputFile))
+	return res, nil
+}
@@ -0,0 +1,161 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"krillin-ai/config"
+	"krillin-ai/internal/dto"
+	"krillin-ai/internal/storage"
+	"krillin-ai/internal/types"
+	"krillin-ai/log"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+var taskEditLocks sync.Map // task id -> *sync.Mutex，任务完成后的局部重新生成在锁内检查并修改任务状态，避免同时开始
+
+// lockTaskEdit 加任务的局部重新生成锁，返回解锁函数
+func lockTaskEdit(taskId string) func() {
+	mu, _ := taskEditLocks.LoadOrStore(taskId, &sync.Mutex{})
+	mu.(*sync.Mutex).Lock()
+	return mu.(*sync.Mutex).Unlock
+}
+
+// ResynthesizeTts 重新合成任务中指定的句子（默认是所有失败的句子），然后重新生成配音和视频
+func (s Service) ResynthesizeTts(req dto.TtsResynthesizeReq) (*dto.TtsResynthesizeResData, error) {
+	task, ok := storage.SubtitleTasks.Load(req.TaskId)
+	if !ok || task == nil {
+		return nil, errors.New("任务不存在")
+	}
+	taskPtr := task.(*types.SubtitleTask)
+	param, ok := storage.SubtitleTaskStepParams.Load(req.TaskId)
+	if !ok || param == nil {
+		return nil, errors.New("任务参数不存在，无法重新合成")
+	}
+	stepParam := param.(*types.SubtitleTaskStepParam)
+	if !stepParam.EnableTts {
+		return nil, errors.New("任务未开启配音")
+	}
+	unlock := lockTaskEdit(req.TaskId)
+	defer unlock()
+	if taskPtr.Status == types.SubtitleTaskStatusProcessing {
+		return nil, errors.New("任务正在处理中，请稍后再试")
+	}
+	if stepParam.TtsSourceFilePath == "" {
+		return nil, errors.New("任务还没有生成配音字幕")
+	}
+	if s.TtsClient == nil {
+		return nil, errors.New("未配置tts")
+	}
+
+	subtitles, err := parseSRT(stepParam.TtsSourceFilePath)
+	if err != nil {
+		log.GetLogger().Error("ResynthesizeTts parseSRT error", zap.Any("req", req), zap.Error(err))
+		return nil, fmt.Errorf("解析配音字幕失败: %w", err)
+	}
+
+	items := req.Items
+	if len(items) == 0 {
+		for _, failed := range taskPtr.TtsFailedSentences {
+			items = append(items, dto.TtsResynthesizeItem{Index: failed.Index})
+		}
+	}
+	if len(items) == 0 {
+		return nil, errors.New("没有需要重新合成的句子")
+	}
+	for _, item := range items {
+		if item.Index < 1 || item.Index > len(subtitles) {
+			return nil, fmt.Errorf("字幕序号超出范围: %d", item.Index)
+		}
+	}
+	voiceCode := req.TtsVoiceCode
+	if voiceCode == "" {
+		voiceCode = stepParam.TtsResolvedVoiceCode
+	}
+
+	taskPtr.Status = types.SubtitleTaskStatusProcessing
+	taskPtr.FailReason = ""
+	taskPtr.ProcessPct = 90
+
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				const size = 64 << 10
+				buf := make([]byte, size)
+				buf = buf[:runtime.Stack(buf, false)]
+				log.GetLogger().Error("ResynthesizeTts panic", zap.Any("panic:", r), zap.Any("stack:", buf))
+				taskPtr.Status = types.SubtitleTaskStatusFailed
+				taskPtr.FailReason = fmt.Sprintf("tts resynthesize panic: %v", r)
+			}
+		}()
+		if err := s.resynthesizeTts(subtitles, items, voiceCode, stepParam); err != nil {
+			log.GetLogger().Error("ResynthesizeTts error", zap.Any("req", req), zap.Error(err))
+			taskPtr.Status = types.SubtitleTaskStatusFailed
+			taskPtr.FailReason = err.Error()
+		}
+	}()
+
+	return &dto.TtsResynthesizeResData{TaskId: req.TaskId}, nil
+}
+
+func (s Service) resynthesizeTts(subtitles []types.SrtSentenceWithStrTime, items []dto.TtsResynthesizeItem, voiceCode string, stepParam *types.SubtitleTaskStepParam) error {
+	s.usage = stepParam.TaskPtr.Usage
+	defer saveTaskUsage(stepParam)
+	if stepParam.TtsTextOverrides == nil {
+		stepParam.TtsTextOverrides = make(map[int]string)
+	}
+	failedMap := make(map[int]types.TtsFailedSentence)
+	for _, failed := range stepParam.TaskPtr.TtsFailedSentences {
+		failedMap[failed.Index] = failed
+	}
+
+	for _, item := range items {
+		if text := strings.TrimSpace(item.Text); text != "" {
+			stepParam.TtsTextOverrides[item.Index] = text
+		}
+		text := subtitles[item.Index-1].Text
+		if override, ok := stepParam.TtsTextOverrides[item.Index]; ok {
+			text = override
+		}
+
+		outputFile := filepath.Join(stepParam.TaskBasePath, fmt.Sprintf("subtitle_%d.wav", item.Index))
+		_, err := s.synthesize(s.TtsClient, config.Conf.Tts.Provider, text, voiceCode, outputFile)
+		if err != nil {
+			log.GetLogger().Warn("resynthesizeTts 重新合成失败，以静音代替", zap.Int("index", item.Index), zap.String("text", text), zap.Error(err))
+			failedMap[item.Index] = types.TtsFailedSentence{Index: item.Index, Text: text, Reason: err.Error()}
+			if err = newGenerateSilence(outputFile, 0.5); err != nil {
+				return fmt.Errorf("resynthesizeTts failed to generate silence for subtitle %d: %w", item.Index, err)
+			}
+			continue
+		}
+		delete(failedMap, item.Index)
+	}
+
+	failedSentences := make([]types.TtsFailedSentence, 0, len(failedMap))
+	for _, failed := range failedMap {
+		failedSentences = append(failedSentences, failed)
+	}
+	sort.Slice(failedSentences, func(i, j int) bool { return failedSentences[i].Index < failedSentences[j].Index })
+	stepParam.TaskPtr.TtsFailedSentences = failedSentences
+	stepParam.TaskPtr.ProcessPct = 95
+
+	if err := buildTtsAudio(subtitles, stepParam); err != nil {
+		return fmt.Errorf("resynthesizeTts %w", err)
+	}
+	stepParam.TaskPtr.ProcessPct = 98
+	ctx := context.Background()
+	if err := s.embedSubtitles(ctx, stepParam); err != nil {
+		return fmt.Errorf("resynthesizeTts %w", err)
+	}
+	if err := s.uploadSubtitles(ctx, stepParam); err != nil {
+		return fmt.Errorf("resynthesizeTts %w", err)
+	}
+	log.GetLogger().Info("resynthesizeTts success", zap.String("task id", stepParam.TaskId), zap.Int("items", len(items)), zap.Int("still failed", len(failedSentences)))
+	return nil
+}
@@ -0,0 +1,90 @@
+package service
+
+import (
+	"errors"
+	"krillin-ai/config"
+	"krillin-ai/internal/dto"
+	"krillin-ai/internal/storage"
+	"krillin-ai/internal/types"
+	"krillin-ai/log"
+	"krillin-ai/pkg/util"
+	"path/filepath"
+	"sort"
+
+	"go.uber.org/zap"
+)
+
+// recordUsage 按配置的单价计算费用后记入任务用量
+func recordUsage(taskUsage *types.TaskUsage, usage types.ProviderUsage) {
+	if taskUsage == nil {
+		return
+	}
+	price := config.Conf.Usage.PriceOf(usage.Kind, usage.Provider)
+	usage.Cost = float64(usage.PromptTokens)/1000*price.PromptPer1kTokens +
+		float64(usage.CompletionTokens)/1000*price.CompletionPer1kTokens +
+		usage.AudioSeconds/60*price.PerAudioMinute +
+		float64(usage.TtsChars)/1000*price.Per1kChars
+	taskUsage.Record(usage)
+}
+
+// saveTaskUsage 把任务用量写到任务目录，便于事后核对
+func saveTaskUsage(stepParam *types.SubtitleTaskStepParam) {
+	if stepParam.TaskPtr.Usage == nil || stepParam.TaskBasePath == "" {
+		return
+	}
+	if err := util.SaveToDisk(newTaskUsage(stepParam.TaskPtr), filepath.Join(stepParam.TaskBasePath, types.SubtitleTaskUsageFileName)); err != nil {
+		log.GetLogger().Warn("saveTaskUsage error", zap.String("task id", stepParam.TaskId), zap.Error(err))
+	}
+}
+
+// GetUsage 查询单个任务的用量，不指定任务时汇总所有任务
+func (s Service) GetUsage(req dto.GetUsageReq) (*dto.GetUsageResData, error) {
+	res := &dto.GetUsageResData{Currency: config.Conf.Usage.Currency}
+	if req.TaskId != "" {
+		task, ok := storage.SubtitleTasks.Load(req.TaskId)
+		if !ok || task == nil {
+			return nil, errors.New("任务不存在")
+		}
+		res.Tasks = append(res.Tasks, newTaskUsage(task.(*types.SubtitleTask)))
+	} else {
+		storage.SubtitleTasks.Range(func(_, task any) bool {
+			if taskPtr, ok := task.(*types.SubtitleTask); ok && taskPtr.Usage != nil {
+				res.Tasks = append(res.Tasks, newTaskUsage(taskPtr))
+			}
+			return true
+		})
+		sort.Slice(res.Tasks, func(i, j int) bool { return res.Tasks[i].TaskId < res.Tasks[j].TaskId })
+	}
+
+	total := &types.TaskUsage{}
+	for _, task := range res.Tasks {
+		res.TotalCost += task.TotalCost
+		for _, usage := range task.Providers {
+			total.Record(types.ProviderUsage(*usage))
+		}
+	}
+	res.Providers = toDtoProviderUsages(total.Snapshot())
+	return res, nil
+}
+
+func newTaskUsage(taskPtr *types.SubtitleTask) *dto.TaskUsage {
+	usages := taskPtr.Usage.Snapshot()
+	res := &dto.TaskUsage{
+		TaskId:    taskPtr.TaskId,
+		Currency:  config.Conf.Usage.Currency,
+		Providers: toDtoProviderUsages(usages),
+	}
+	for _, usage := range usages {
+		res.TotalCost += usage.Cost
+	}
+	return res
+}
+
+func toDtoProviderUsages(usages []types.ProviderUsage) []*dto.ProviderUsage {
+	res := make([]*dto.ProviderUsage, 0, len(usages))
+	for _, usage := range usages {
+		item := dto.ProviderUsage(usage)
+		res = append(res, &item)
+	}
+	return res
+}
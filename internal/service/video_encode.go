@@ -0,0 +1,279 @@
+package service
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"krillin-ai/config"
+	"krillin-ai/internal/storage"
+	"krillin-ai/internal/types"
+	"krillin-ai/log"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// 各编码方式对应的ffmpeg编码器，按codec区分
+var videoEncoders = map[string]map[string]string{
+	"h264": {"none": "libx264", "nvenc": "h264_nvenc", "qsv": "h264_qsv", "vaapi": "h264_vaapi"},
+	"hevc": {"none": "libx265", "nvenc": "hevc_nvenc", "qsv": "hevc_qsv", "vaapi": "hevc_vaapi"},
+}
+
+// auto时按顺序尝试的硬件编码方式
+var hwAccelPriority = []string{"nvenc", "qsv", "vaapi"}
+
+var (
+	ffmpegEncodersOnce  sync.Once
+	ffmpegEncoders      string
+	ffmpegEncoderUsable sync.Map // 编码器+设备 -> 试编码是否成功
+)
+
+// ffmpegHasEncoder 检查ffmpeg编译时是否带有该编码器，结果只查询一次
+func ffmpegHasEncoder(encoder string) bool {
+	ffmpegEncodersOnce.Do(func() {
+		output, err := exec.Command(storage.FfmpegPath, "-hide_banner", "-encoders").Output()
+		if err != nil {
+			log.GetLogger().Warn("ffmpegHasEncoder 查询ffmpeg编码器失败", zap.Error(err))
+			return
+		}
+		ffmpegEncoders = string(output)
+	})
+	for _, line := range strings.Split(ffmpegEncoders, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[1] == encoder {
+			return true
+		}
+	}
+	return false
+}
+
+// ffmpegCanEncode 编译时带有编码器不代表有可用的显卡和驱动，用编码器试编码一帧确认，结果缓存
+func ffmpegCanEncode(encoder, hwAccel, vaapiDevice string) bool {
+	if !ffmpegHasEncoder(encoder) {
+		return false
+	}
+	key := encoder + "|" + vaapiDevice
+	if usable, ok := ffmpegEncoderUsable.Load(key); ok {
+		return usable.(bool)
+	}
+	args := []string{"-hide_banner", "-loglevel", "error"}
+	if hwAccel == "vaapi" {
+		args = append(args, "-vaapi_device", vaapiDevice)
+	}
+	args = append(args, "-f", "lavfi", "-i", "nullsrc=s=256x256", "-frames:v", "1")
+	if hwAccel == "vaapi" {
+		args = append(args, "-vf", "format=nv12,hwupload")
+	}
+	args = append(args, "-c:v", encoder, "-f", "null", "-")
+	output, err := exec.Command(storage.FfmpegPath, args...).CombinedOutput()
+	usable := err == nil
+	if !usable {
+		log.GetLogger().Info("ffmpegCanEncode 编码器试编码失败", zap.String("encoder", encoder), zap.String("output", string(output)), zap.Error(err))
+	}
+	ffmpegEncoderUsable.Store(key, usable)
+	return usable
+}
+
+// resolveHwAccel 得到实际使用的编码方式，ffmpeg不支持或试编码失败时返回none
+func resolveHwAccel(profile config.EncodingProfile) string {
+	candidates := []string{profile.HwAccel}
+	if profile.HwAccel == "auto" {
+		candidates = hwAccelPriority
+	}
+	for _, hwAccel := range candidates {
+		if hwAccel == "none" {
+			return "none"
+		}
+		if encoder, ok := videoEncoders[profile.VideoCodec][hwAccel]; ok && ffmpegCanEncode(encoder, hwAccel, profile.VaapiDevice) {
+			return hwAccel
+		}
+	}
+	if profile.HwAccel != "none" {
+		log.GetLogger().Info("ffmpeg不支持配置的硬件编码，使用软件编码", zap.String("hw accel", profile.HwAccel), zap.String("codec", profile.VideoCodec))
+	}
+	return "none"
+}
+
+// videoSourceInfo 源视频的码率、帧率和时长，获取不到的为0
+type videoSourceInfo struct {
+	bitrate  int64
+	fps      float64
+	duration float64
+}
+
+func probeVideoSource(inputVideo string) videoSourceInfo {
+	output, err := exec.Command(storage.FfprobePath, "-v", "error", "-select_streams", "v:0",
+		"-show_entries", "stream=bit_rate,avg_frame_rate:format=bit_rate,duration", "-of", "json", inputVideo).Output()
+	if err != nil {
+		log.GetLogger().Warn("probeVideoSource ffprobe error", zap.String("input", inputVideo), zap.Error(err))
+		return videoSourceInfo{}
+	}
+	var probe struct {
+		Streams []struct {
+			BitRate      string `json:"bit_rate"`
+			AvgFrameRate string `json:"avg_frame_rate"`
+		} `json:"streams"`
+		Format struct {
+			BitRate  string `json:"bit_rate"`
+			Duration string `json:"duration"`
+		} `json:"format"`
+	}
+	if err = json.Unmarshal(output, &probe); err != nil {
+		log.GetLogger().Warn("probeVideoSource parse error", zap.String("input", inputVideo), zap.Error(err))
+		return videoSourceInfo{}
+	}
+	var info videoSourceInfo
+	info.duration, _ = strconv.ParseFloat(probe.Format.Duration, 64)
+	info.bitrate, _ = strconv.ParseInt(probe.Format.BitRate, 10, 64)
+	if len(probe.Streams) > 0 {
+		// 视频流码率更准确，部分容器里没有
+		if bitrate, _ := strconv.ParseInt(probe.Streams[0].BitRate, 10, 64); bitrate > 0 {
+			info.bitrate = bitrate
+		}
+		if num, den, ok := strings.Cut(probe.Streams[0].AvgFrameRate, "/"); ok {
+			n, _ := strconv.ParseFloat(num, 64)
+			d, _ := strconv.ParseFloat(den, 64)
+			if d > 0 {
+				info.fps = n / d
+			}
+		}
+	}
+	return info
+}
+
+// videoEncodeJob 一次重新编码视频的ffmpeg调用
+type videoEncodeJob struct {
+	input       string
+	output      string
+	videoFilter string
+	profile     config.EncodingProfile
+	progress    *encodeProgress
+}
+
+// encodeArgs 生成使用hwAccel编码方式的完整ffmpeg参数
+func (j videoEncodeJob) encodeArgs(hwAccel string, source videoSourceInfo) []string {
+	profile := j.profile
+	var args []string
+	videoFilter := j.videoFilter
+	if hwAccel == "vaapi" {
+		args = append(args, "-vaapi_device", profile.VaapiDevice)
+		videoFilter = strings.TrimPrefix(videoFilter+",format=nv12,hwupload", ",")
+	}
+	args = append(args, "-y", "-i", j.input)
+	if videoFilter != "" {
+		args = append(args, "-vf", videoFilter)
+	}
+
+	args = append(args, "-c:v", videoEncoders[profile.VideoCodec][hwAccel])
+	switch {
+	case profile.VideoBitrate != "":
+		args = append(args, "-b:v", profile.VideoBitrate)
+	case profile.Crf > 0:
+		crf := strconv.Itoa(profile.Crf)
+		switch hwAccel {
+		case "nvenc":
+			args = append(args, "-rc", "vbr", "-cq", crf, "-b:v", "0")
+		case "qsv":
+			args = append(args, "-global_quality", crf)
+		case "vaapi":
+			args = append(args, "-qp", crf)
+		default:
+			args = append(args, "-crf", crf)
+		}
+	case source.bitrate > 0:
+		// 未指定画质时按源视频码率编码，避免体积明显变大或画质明显下降
+		args = append(args, "-b:v", strconv.FormatInt(source.bitrate, 10))
+	}
+	if hwAccel == "none" {
+		args = append(args, "-preset", profile.Preset)
+	}
+	if profile.Fps > 0 {
+		args = append(args, "-r", strconv.Itoa(profile.Fps))
+	}
+	args = append(args, "-c:a", profile.AudioCodec, "-b:a", profile.AudioBitrate)
+	args = append(args, "-progress", "pipe:1", "-nostats", j.output)
+	return args
+}
+
+// runVideoEncode 执行编码，硬件编码失败时用软件编码重试
+func runVideoEncode(job videoEncodeJob) error {
+	source := probeVideoSource(job.input)
+	hwAccel := resolveHwAccel(job.profile)
+	err := runFfmpegWithProgress(job.encodeArgs(hwAccel, source), source.duration, job.progress)
+	if err != nil && hwAccel != "none" {
+		log.GetLogger().Warn("runVideoEncode 硬件编码失败，使用软件编码重试", zap.String("hw accel", hwAccel), zap.Error(err))
+		err = runFfmpegWithProgress(job.encodeArgs("none", source), source.duration, job.progress)
+	}
+	if err != nil {
+		return err
+	}
+	job.progress.finish()
+	return nil
+}
+
+// runFfmpegWithProgress 执行ffmpeg并解析-progress输出更新进度
+func runFfmpegWithProgress(args []string, duration float64, progress *encodeProgress) error {
+	cmd := exec.Command(storage.FfmpegPath, args...)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err = cmd.Start(); err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if !ok || key != "out_time_us" || duration <= 0 {
+			continue
+		}
+		outTimeUs, _ := strconv.ParseFloat(value, 64)
+		progress.update(outTimeUs / 1e6 / duration)
+	}
+	_, _ = io.Copy(io.Discard, stdout)
+	if err = cmd.Wait(); err != nil {
+		log.GetLogger().Error("runFfmpegWithProgress ffmpeg error", zap.Strings("args", args), zap.String("output", stderr.String()), zap.Error(err))
+		return fmt.Errorf("ffmpeg error: %w", err)
+	}
+	return nil
+}
+
+// encodeProgress 把合成视频阶段的多次编码折算到任务进度里，从开始时的进度推进到99
+type encodeProgress struct {
+	taskPtr  *types.SubtitleTask
+	startPct float64
+	total    int // 计划进行的编码次数
+	done     int
+}
+
+func newEncodeProgress(taskPtr *types.SubtitleTask, total int) *encodeProgress {
+	return &encodeProgress{taskPtr: taskPtr, startPct: float64(taskPtr.ProcessPct), total: max(total, 1)}
+}
+
+// update 更新当前这次编码的完成比例
+func (p *encodeProgress) update(fraction float64) {
+	if p == nil {
+		return
+	}
+	fraction = min(max(fraction, 0), 1)
+	overall := (float64(p.done) + fraction) / float64(p.total)
+	pct := uint8(p.startPct + (99-p.startPct)*overall)
+	if pct > p.taskPtr.ProcessPct {
+		p.taskPtr.ProcessPct = pct
+	}
+}
+
+// finish 标记当前这次编码完成
+func (p *encodeProgress) finish() {
+	if p == nil {
+		return
+	}
+	p.done = min(p.done+1, p.total)
+	p.update(0)
+}
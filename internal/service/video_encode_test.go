@@ -0,0 +1,118 @@
+package service
+
+import (
+	"krillin-ai/config"
+	"krillin-ai/log"
+	"slices"
+	"sync"
+	"testing"
+)
+
+func Test_encodeArgs(t *testing.T) {
+	profile := func(codec string, crf int, bitrate string) config.EncodingProfile {
+		return config.EncodingProfile{
+			VideoCodec:   codec,
+			Crf:          crf,
+			VideoBitrate: bitrate,
+			Preset:       "medium",
+			AudioCodec:   "aac",
+			AudioBitrate: "192k",
+			VaapiDevice:  "/dev/dri/renderD128",
+		}
+	}
+	tail := []string{"-c:a", "aac", "-b:a", "192k", "-progress", "pipe:1", "-nostats", "out.mp4"}
+	tests := []struct {
+		name    string
+		profile config.EncodingProfile
+		filter  string
+		hwAccel string
+		source  videoSourceInfo
+		want    []string
+	}{
+		{
+			name: "h264 software crf", profile: profile("h264", 23, ""), filter: "ass=a.ass", hwAccel: "none",
+			want: []string{"-y", "-i", "in.mp4", "-vf", "ass=a.ass", "-c:v", "libx264", "-crf", "23", "-preset", "medium"},
+		},
+		{
+			name: "h264 nvenc crf", profile: profile("h264", 23, ""), filter: "ass=a.ass", hwAccel: "nvenc",
+			want: []string{"-y", "-i", "in.mp4", "-vf", "ass=a.ass", "-c:v", "h264_nvenc", "-rc", "vbr", "-cq", "23", "-b:v", "0"},
+		},
+		{
+			name: "h264 qsv crf", profile: profile("h264", 23, ""), filter: "ass=a.ass", hwAccel: "qsv",
+			want: []string{"-y", "-i", "in.mp4", "-vf", "ass=a.ass", "-c:v", "h264_qsv", "-global_quality", "23"},
+		},
+		{
+			name: "h264 vaapi crf", profile: profile("h264", 23, ""), filter: "ass=a.ass", hwAccel: "vaapi",
+			want: []string{"-vaapi_device", "/dev/dri/renderD128", "-y", "-i", "in.mp4", "-vf", "ass=a.ass,format=nv12,hwupload", "-c:v", "h264_vaapi", "-qp", "23"},
+		},
+		{
+			name: "vaapi without filter", profile: profile("hevc", 0, "6M"), hwAccel: "vaapi",
+			want: []string{"-vaapi_device", "/dev/dri/renderD128", "-y", "-i", "in.mp4", "-vf", "format=nv12,hwupload", "-c:v", "hevc_vaapi", "-b:v", "6M"},
+		},
+		{
+			name: "bitrate before crf", profile: profile("hevc", 23, "6M"), filter: "ass=a.ass", hwAccel: "nvenc",
+			want: []string{"-y", "-i", "in.mp4", "-vf", "ass=a.ass", "-c:v", "hevc_nvenc", "-b:v", "6M"},
+		},
+		{
+			name: "source bitrate", profile: profile("hevc", 0, ""), filter: "ass=a.ass", hwAccel: "none", source: videoSourceInfo{bitrate: 3000000},
+			want: []string{"-y", "-i", "in.mp4", "-vf", "ass=a.ass", "-c:v", "libx265", "-b:v", "3000000", "-preset", "medium"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := videoEncodeJob{input: "in.mp4", output: "out.mp4", videoFilter: tt.filter, profile: tt.profile}
+			want := append(slices.Clone(tt.want), tail...)
+			if got := job.encodeArgs(tt.hwAccel, tt.source); !slices.Equal(got, want) {
+				t.Errorf("encodeArgs() =\n%q\nwant\n%q", got, want)
+			}
+		})
+	}
+
+	job := videoEncodeJob{input: "in.mp4", output: "out.mp4", profile: profile("h264", 23, "")}
+	job.profile.Fps = 30
+	got := job.encodeArgs("none", videoSourceInfo{})
+	if i := slices.Index(got, "-r"); i < 0 || got[i+1] != "30" {
+		t.Errorf("encodeArgs() = %q, want -r 30", got)
+	}
+}
+
+func Test_resolveHwAccel(t *testing.T) {
+	log.InitLogger()
+	// 模拟ffmpeg带有的编码器和试编码结果，不实际执行ffmpeg
+	ffmpegEncodersOnce = sync.Once{}
+	ffmpegEncodersOnce.Do(func() {
+		ffmpegEncoders = " V....D libx264              H.264\n V....D libx265              H.265\n" +
+			" V....D h264_nvenc           NVIDIA NVENC H.264\n V....D h264_vaapi           H.264 VAAPI\n V....D hevc_nvenc           NVIDIA NVENC hevc\n"
+	})
+	ffmpegEncoderUsable = sync.Map{}
+	ffmpegEncoderUsable.Store("h264_nvenc|/dev/dri/renderD128", false)
+	ffmpegEncoderUsable.Store("h264_vaapi|/dev/dri/renderD128", true)
+	ffmpegEncoderUsable.Store("hevc_nvenc|/dev/dri/renderD128", true)
+	defer func() {
+		ffmpegEncodersOnce = sync.Once{}
+		ffmpegEncoders = ""
+		ffmpegEncoderUsable = sync.Map{}
+	}()
+
+	tests := []struct {
+		codec   string
+		hwAccel string
+		want    string
+	}{
+		{codec: "h264", hwAccel: "none", want: "none"},
+		// 编译时带有nvenc但试编码失败，回退到软件编码
+		{codec: "h264", hwAccel: "nvenc", want: "none"},
+		// ffmpeg没有编译qsv
+		{codec: "h264", hwAccel: "qsv", want: "none"},
+		{codec: "h264", hwAccel: "vaapi", want: "vaapi"},
+		{codec: "h264", hwAccel: "auto", want: "vaapi"},
+		{codec: "hevc", hwAccel: "auto", want: "nvenc"},
+		{codec: "hevc", hwAccel: "vaapi", want: "none"},
+	}
+	for _, tt := range tests {
+		profile := config.EncodingProfile{VideoCodec: tt.codec, HwAccel: tt.hwAccel, VaapiDevice: "/dev/dri/renderD128"}
+		if got := resolveHwAccel(profile); got != tt.want {
+			t.Errorf("resolveHwAccel(%s, %s) = %s, want %s", tt.codec, tt.hwAccel, got, tt.want)
+		}
+	}
+}
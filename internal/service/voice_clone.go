@@ -0,0 +1,215 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"krillin-ai/config"
+	"krillin-ai/internal/storage"
+	"krillin-ai/internal/types"
+	"krillin-ai/log"
+	"krillin-ai/pkg/util"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	voiceCloneSampleMinDuration = 5.0  // 自动截取的克隆片段最短时长，秒
+	voiceCloneSampleMaxDuration = 15.0 // 自动截取的克隆片段最长时长，秒
+)
+
+var (
+	voiceCloneRegistryLock sync.Mutex
+	voiceCloneGroup        singleflight.Group
+)
+
+// cloneVoice 克隆音色，同一提供商和账号下相同内容的源音频直接复用已记录的音色
+func (s Service) cloneVoice(audioFile string) (string, error) {
+	if s.VoiceCloner == nil {
+		return "", errors.New("未配置声音克隆")
+	}
+	provider := config.Conf.Tts.VoiceClone.Provider
+	account := voiceCloneAccount(provider)
+	srcHash, err := fileSha256(audioFile)
+	if err != nil {
+		return "", fmt.Errorf("cloneVoice hash source file error: %w", err)
+	}
+
+	if record, ok := findVoiceCloneRecord(provider, account, srcHash); ok {
+		log.GetLogger().Info("cloneVoice 复用已克隆的音色", zap.String("provider", provider), zap.String("voice code", record.VoiceCode))
+		return record.VoiceCode, nil
+	}
+
+	voiceCode, err, _ := voiceCloneGroup.Do(provider+":"+account+":"+srcHash, func() (any, error) {
+		if record, ok := findVoiceCloneRecord(provider, account, srcHash); ok {
+			return record.VoiceCode, nil
+		}
+		code, err := s.VoiceCloner.CloneVoice(audioFile, "krillinai")
+		if err != nil {
+			return "", err
+		}
+		err = addVoiceCloneRecord(types.VoiceCloneRecord{
+			Provider:   provider,
+			Account:    account,
+			SrcHash:    srcHash,
+			SrcFile:    audioFile,
+			VoiceCode:  code,
+			CreateTime: time.Now().Unix(),
+		})
+		if err != nil {
+			// 记录失败不影响本次使用
+			log.GetLogger().Error("cloneVoice save registry error", zap.Error(err))
+		}
+		return code, nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("cloneVoice CloneVoice error: %w", err)
+	}
+	return voiceCode.(string), nil
+}
+
+// ListClonedVoices 列出本地记录的已克隆音色
+func (s Service) ListClonedVoices() ([]types.VoiceCloneRecord, error) {
+	voiceCloneRegistryLock.Lock()
+	defer voiceCloneRegistryLock.Unlock()
+	return loadVoiceCloneRegistry()
+}
+
+// voiceCloneAccount 克隆所用账号的标识，只保存哈希，不把密钥写到记录里
+func voiceCloneAccount(provider string) string {
+	var account string
+	switch provider {
+	case "local":
+		account = config.Conf.Tts.VoiceClone.Command
+	case "aliyun", "":
+		account = config.Conf.Tts.Aliyun.Speech.AccessKeyId + ":" + config.Conf.Tts.Aliyun.Speech.AppKey
+	}
+	return cacheKey(provider, account)[:16]
+}
+
+func findVoiceCloneRecord(provider, account, srcHash string) (types.VoiceCloneRecord, bool) {
+	voiceCloneRegistryLock.Lock()
+	defer voiceCloneRegistryLock.Unlock()
+	records, err := loadVoiceCloneRegistry()
+	if err != nil {
+		log.GetLogger().Error("findVoiceCloneRecord load registry error", zap.Error(err))
+		return types.VoiceCloneRecord{}, false
+	}
+	for _, record := range records {
+		if record.Provider == provider && record.Account == account && record.SrcHash == srcHash {
+			return record, true
+		}
+	}
+	return types.VoiceCloneRecord{}, false
+}
+
+func addVoiceCloneRecord(record types.VoiceCloneRecord) error {
+	voiceCloneRegistryLock.Lock()
+	defer voiceCloneRegistryLock.Unlock()
+	records, err := loadVoiceCloneRegistry()
+	if err != nil {
+		return err
+	}
+	records = append(records, record)
+	if err = os.MkdirAll(filepath.Dir(types.VoiceCloneRegistryFilePath), os.ModePerm); err != nil {
+		return err
+	}
+	return util.SaveToDisk(records, types.VoiceCloneRegistryFilePath)
+}
+
+// 调用方需持有voiceCloneRegistryLock
+func loadVoiceCloneRegistry() ([]types.VoiceCloneRecord, error) {
+	records := make([]types.VoiceCloneRecord, 0)
+	data, err := os.ReadFile(types.VoiceCloneRegistryFilePath)
+	if os.IsNotExist(err) {
+		return records, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("parse voice clone registry error: %w", err)
+	}
+	return records, nil
+}
+
+func fileSha256(filePath string) (string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// extractVoiceCloneSample 从音频中找出最长的连续说话片段，截取作为克隆源
+func extractVoiceCloneSample(audioFile, outputFile string) error {
+	duration, err := util.GetAudioDuration(audioFile)
+	if err != nil {
+		return fmt.Errorf("extractVoiceCloneSample GetAudioDuration error: %w", err)
+	}
+	cmd := exec.Command(storage.FfmpegPath, "-i", audioFile, "-af", "silencedetect=noise=-35dB:d=0.4", "-f", "null", "-")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		log.GetLogger().Error("extractVoiceCloneSample silencedetect error", zap.String("output", string(output)), zap.Error(err))
+		return fmt.Errorf("extractVoiceCloneSample silencedetect error: %w", err)
+	}
+
+	var bestStart, bestEnd float64
+	for _, interval := range parseSpeechIntervals(string(output), duration) {
+		if interval[1]-interval[0] > bestEnd-bestStart {
+			bestStart, bestEnd = interval[0], interval[1]
+		}
+	}
+	if bestEnd-bestStart < voiceCloneSampleMinDuration {
+		return fmt.Errorf("extractVoiceCloneSample no speech segment longer than %.0fs", voiceCloneSampleMinDuration)
+	}
+	if bestEnd-bestStart > voiceCloneSampleMaxDuration {
+		bestEnd = bestStart + voiceCloneSampleMaxDuration
+	}
+	log.GetLogger().Info("extractVoiceCloneSample 截取克隆片段", zap.Float64("start", bestStart), zap.Float64("end", bestEnd))
+	return ClipAudio(audioFile, outputFile, bestStart, bestEnd)
+}
+
+// parseSpeechIntervals 根据ffmpeg silencedetect的输出，得到非静音区间
+func parseSpeechIntervals(ffmpegOutput string, duration float64) [][2]float64 {
+	re := regexp.MustCompile(`silence_(start|end): (-?[\d.]+)`)
+	var intervals [][2]float64
+	speechStart := 0.0
+	for _, match := range re.FindAllStringSubmatch(ffmpegOutput, -1) {
+		ts, err := strconv.ParseFloat(match[2], 64)
+		if err != nil {
+			continue
+		}
+		if ts < 0 {
+			ts = 0
+		}
+		if match[1] == "start" {
+			if speechStart >= 0 && ts > speechStart {
+				intervals = append(intervals, [2]float64{speechStart, ts})
+			}
+			speechStart = -1
+		} else {
+			speechStart = ts
+		}
+	}
+	if speechStart >= 0 && duration > speechStart {
+		intervals = append(intervals, [2]float64{speechStart, duration})
+	}
+	return intervals
+}
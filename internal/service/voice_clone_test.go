@@ -0,0 +1,57 @@
+package service
+
+import "testing"
+
+func Test_parseSpeechIntervals(t *testing.T) {
+	tests := []struct {
+		name     string
+		output   string
+		duration float64
+		want     [][2]float64
+	}{
+		{
+			name: "leading and trailing silence",
+			output: `Input #0, wav, from 'voice.wav':
+  Duration: 00:00:10.00, bitrate: 705 kb/s
+  Stream #0:0: Audio: pcm_s16le ([1][0][0][0] / 0x0001), 44100 Hz, 1 channels, s16, 705 kb/s
+[silencedetect @ 0x7f8b5c004a80] silence_start: 0
+[silencedetect @ 0x7f8b5c004a80] silence_end: 1.23456 | silence_duration: 1.23456
+size=N/A time=00:00:05.00 bitrate=N/A speed= 250x
+[silencedetect @ 0x7f8b5c004a80] silence_start: 4.5
+[silencedetect @ 0x7f8b5c004a80] silence_end: 6.02 | silence_duration: 1.52
+[silencedetect @ 0x7f8b5c004a80] silence_start: 9.8
+size=N/A time=00:00:10.00 bitrate=N/A speed= 300x
+video:0kB audio:0kB subtitle:0kB other streams:0kB global headers:0kB muxing overhead: unknown`,
+			duration: 10,
+			want:     [][2]float64{{1.23456, 4.5}, {6.02, 9.8}},
+		},
+		{
+			name: "speech until the end with negative start",
+			output: `[silencedetect @ 0x55d1c8a3f2c0] silence_start: -0.0213
+[silencedetect @ 0x55d1c8a3f2c0] silence_end: 0.8 | silence_duration: 0.8213
+[silencedetect @ 0x55d1c8a3f2c0] silence_start: 3
+[silencedetect @ 0x55d1c8a3f2c0] silence_end: 3.6 | silence_duration: 0.6`,
+			duration: 8,
+			want:     [][2]float64{{0.8, 3}, {3.6, 8}},
+		},
+		{
+			name:     "no silence",
+			output:   `size=N/A time=00:00:06.00 bitrate=N/A speed= 400x`,
+			duration: 6,
+			want:     [][2]float64{{0, 6}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseSpeechIntervals(tt.output, tt.duration)
+			if len(got) != len(tt.want) {
+				t.Fatalf("parseSpeechIntervals() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("parseSpeechIntervals() = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,325 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"krillin-ai/config"
+	"krillin-ai/internal/dto"
+	"krillin-ai/internal/types"
+	"krillin-ai/log"
+	"krillin-ai/pkg/source"
+	"krillin-ai/pkg/util"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type watchFileState struct {
+	size        int64
+	modTime     time.Time
+	stableSince time.Time
+}
+
+type watchJob struct {
+	folder  config.WatchFolderConfig
+	path    string
+	size    int64
+	modTime int64
+}
+
+var (
+	watchRecordLock sync.Mutex
+	watchRecords    map[string]types.WatchFolderRecord // 路径、大小、修改时间 -> 记录，首次使用时从磁盘加载
+)
+
+// WatchFolders 轮询监控配置的文件夹，新文件大小稳定后依次创建字幕任务，直到ctx结束。
+// 每次扫描都读取最新配置，修改配置后不需要重启。
+func (s Service) WatchFolders(ctx context.Context) {
+	jobs := make(chan watchJob, 64)
+	// 已加入队列还没处理完的文件，处理完后删除
+	queued := &sync.Map{}
+	go s.runWatchJobs(ctx, jobs, queued)
+
+	states := make(map[string]*watchFileState)
+	for {
+		if config.Conf.Watch.Enable {
+			s.scanWatchFolders(states, queued, jobs)
+		}
+		interval := time.Duration(config.Conf.Watch.PollIntervalSec) * time.Second
+		if interval <= 0 {
+			interval = 10 * time.Second
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+func (s Service) scanWatchFolders(states map[string]*watchFileState, queued *sync.Map, jobs chan<- watchJob) {
+	now := time.Now()
+	stableDuration := time.Duration(config.Conf.Watch.StableSeconds) * time.Second
+	seen := make(map[string]bool)
+	for _, folder := range config.Conf.Watch.Folders {
+		if folder.Dir == "" {
+			continue
+		}
+		for _, file := range listWatchFolderFiles(folder) {
+			info, err := os.Stat(file)
+			if err != nil {
+				continue
+			}
+			seen[file] = true
+			key := watchRecordKey(file, info.Size(), info.ModTime().Unix())
+			if _, ok := queued.Load(key); ok || hasWatchRecord(key, now) {
+				continue
+			}
+
+			state, ok := states[file]
+			if !ok || state.size != info.Size() || !state.modTime.Equal(info.ModTime()) {
+				// 新文件或仍在写入
+				states[file] = &watchFileState{size: info.Size(), modTime: info.ModTime(), stableSince: now}
+				continue
+			}
+			if now.Sub(state.stableSince) < stableDuration {
+				continue
+			}
+			select {
+			case jobs <- watchJob{folder: folder, path: file, size: info.Size(), modTime: info.ModTime().Unix()}:
+				queued.Store(key, true)
+				log.GetLogger().Info("WatchFolders 发现新文件", zap.String("file", file))
+			default:
+				// 队列已满，下次扫描再加入
+			}
+		}
+	}
+	for file := range states {
+		if !seen[file] {
+			delete(states, file)
+		}
+	}
+}
+
+// listWatchFolderFiles 列出目录中的音视频文件
+func listWatchFolderFiles(folder config.WatchFolderConfig) []string {
+	var files []string
+	if !folder.Recursive {
+		entries, err := os.ReadDir(folder.Dir)
+		if err != nil {
+			log.GetLogger().Warn("listWatchFolderFiles read dir error", zap.String("dir", folder.Dir), zap.Error(err))
+			return nil
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() && source.IsMediaFile(entry.Name()) {
+				files = append(files, filepath.Join(folder.Dir, entry.Name()))
+			}
+		}
+		return files
+	}
+	_ = filepath.WalkDir(folder.Dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if !d.IsDir() && source.IsMediaFile(path) {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files
+}
+
+// runWatchJobs 依次处理监控到的文件
+func (s Service) runWatchJobs(ctx context.Context, jobs <-chan watchJob, queued *sync.Map) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case job := <-jobs:
+			// 每个任务重新创建服务，使用最新的配置
+			var record types.WatchFolderRecord
+			if svc := NewService(); svc != nil {
+				record = svc.processWatchJob(job)
+			} else {
+				log.GetLogger().Error("runWatchJobs 创建服务失败", zap.String("file", job.path))
+				record = newWatchRecord(job)
+				record.FailReason = "create service failed, check transcribe config"
+			}
+			if err := addWatchRecord(record); err != nil {
+				log.GetLogger().Error("runWatchJobs save record error", zap.String("file", job.path), zap.Error(err))
+			}
+			queued.Delete(watchRecordKey(job.path, job.size, job.modTime))
+		}
+	}
+}
+
+// newWatchRecord 创建文件的处理记录，默认为失败状态
+func newWatchRecord(job watchJob) types.WatchFolderRecord {
+	return types.WatchFolderRecord{
+		Path:        job.path,
+		Size:        job.size,
+		ModTime:     job.modTime,
+		Status:      types.WatchFolderRecordStatusFailed,
+		ProcessTime: time.Now().Unix(),
+	}
+}
+
+func (s Service) processWatchJob(job watchJob) types.WatchFolderRecord {
+	record := newWatchRecord(job)
+
+	absPath, err := filepath.Abs(job.path)
+	if err != nil {
+		record.FailReason = err.Error()
+		return record
+	}
+	body, _ := json.Marshal(map[string]string{"url": "local:" + absPath, "preset": job.folder.Preset})
+	var req dto.StartVideoSubtitleTaskReq
+	if err = s.ApplyTaskPreset(body, &req); err != nil {
+		log.GetLogger().Error("processWatchJob ApplyTaskPreset error", zap.String("file", job.path), zap.Error(err))
+		record.FailReason = err.Error()
+		return record
+	}
+	stepParam, err := s.newSubtitleTask(req)
+	if err != nil {
+		log.GetLogger().Error("processWatchJob newSubtitleTask error", zap.String("file", job.path), zap.Error(err))
+		record.FailReason = err.Error()
+		return record
+	}
+	record.TaskId = stepParam.TaskId
+	log.GetLogger().Info("processWatchJob 开始处理", zap.String("file", job.path), zap.String("task id", stepParam.TaskId))
+	s.runSubtitleTask(req, stepParam)
+	if stepParam.TaskPtr.Status != types.SubtitleTaskStatusSuccess {
+		record.FailReason = stepParam.TaskPtr.FailReason
+		return record
+	}
+
+	outputs, err := exportWatchJobResults(job, stepParam)
+	record.Outputs = outputs
+	if err != nil {
+		log.GetLogger().Error("processWatchJob exportWatchJobResults error", zap.String("file", job.path), zap.Error(err))
+		record.FailReason = err.Error()
+		return record
+	}
+	record.Status = types.WatchFolderRecordStatusSuccess
+	log.GetLogger().Info("processWatchJob 处理完成", zap.String("file", job.path), zap.Strings("outputs", outputs))
+	return record
+}
+
+// exportWatchJobResults 把字幕、配音和嵌入字幕的视频复制到输出目录，文件名以源文件名为前缀
+func exportWatchJobResults(job watchJob, stepParam *types.SubtitleTaskStepParam) ([]string, error) {
+	outputDir := filepath.Dir(job.path)
+	if job.folder.OutputDir != "" {
+		rel, err := filepath.Rel(job.folder.Dir, filepath.Dir(job.path))
+		if err != nil {
+			return nil, err
+		}
+		outputDir = filepath.Join(job.folder.OutputDir, rel)
+	}
+	if err := os.MkdirAll(outputDir, os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	var results []string
+	for _, info := range stepParam.TaskPtr.SubtitleInfos {
+		results = append(results, strings.TrimPrefix(info.DownloadUrl, "/api/file/"))
+	}
+	if stepParam.TtsResultFilePath != "" {
+		results = append(results, stepParam.TtsResultFilePath)
+	}
+	videos, _ := filepath.Glob(filepath.Join(stepParam.TaskBasePath, "output", "*"))
+	results = append(results, videos...)
+
+	stem := strings.TrimSuffix(filepath.Base(job.path), filepath.Ext(job.path))
+	var outputs []string
+	for _, result := range results {
+		if _, err := os.Stat(result); err != nil {
+			continue
+		}
+		output := filepath.Join(outputDir, fmt.Sprintf("%s_%s", stem, filepath.Base(result)))
+		if err := util.CopyFile(result, output); err != nil {
+			return outputs, fmt.Errorf("copy %s error: %w", result, err)
+		}
+		outputs = append(outputs, output)
+		// 输出文件可能也在监控目录中，记录下来避免被当作新文件
+		if info, err := os.Stat(output); err == nil {
+			_ = addWatchRecord(types.WatchFolderRecord{
+				Path:        output,
+				Size:        info.Size(),
+				ModTime:     info.ModTime().Unix(),
+				Status:      types.WatchFolderRecordStatusOutput,
+				TaskId:      stepParam.TaskId,
+				ProcessTime: time.Now().Unix(),
+			})
+		}
+	}
+	return outputs, nil
+}
+
+func watchRecordKey(path string, size, modTime int64) string {
+	return fmt.Sprintf("%s|%d|%d", path, size, modTime)
+}
+
+// hasWatchRecord 文件是否已处理过，处理失败的文件超过retry_failed_sec后视为未处理，重新处理
+func hasWatchRecord(key string, now time.Time) bool {
+	watchRecordLock.Lock()
+	defer watchRecordLock.Unlock()
+	if err := loadWatchRecords(); err != nil {
+		log.GetLogger().Error("hasWatchRecord load records error", zap.Error(err))
+		return false
+	}
+	record, ok := watchRecords[key]
+	if !ok {
+		return false
+	}
+	retryAfter := config.Conf.Watch.RetryFailedSec
+	if record.Status == types.WatchFolderRecordStatusFailed && retryAfter > 0 &&
+		now.Sub(time.Unix(record.ProcessTime, 0)) >= time.Duration(retryAfter)*time.Second {
+		return false
+	}
+	return true
+}
+
+func addWatchRecord(record types.WatchFolderRecord) error {
+	watchRecordLock.Lock()
+	defer watchRecordLock.Unlock()
+	if err := loadWatchRecords(); err != nil {
+		return err
+	}
+	watchRecords[watchRecordKey(record.Path, record.Size, record.ModTime)] = record
+
+	records := make([]types.WatchFolderRecord, 0, len(watchRecords))
+	for _, r := range watchRecords {
+		records = append(records, r)
+	}
+	if err := os.MkdirAll(filepath.Dir(types.WatchFolderRecordFilePath), os.ModePerm); err != nil {
+		return err
+	}
+	return util.SaveToDisk(records, types.WatchFolderRecordFilePath)
+}
+
+// 调用方需持有watchRecordLock
+func loadWatchRecords() error {
+	if watchRecords != nil {
+		return nil
+	}
+	records := make([]types.WatchFolderRecord, 0)
+	data, err := os.ReadFile(types.WatchFolderRecordFilePath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		if err = json.Unmarshal(data, &records); err != nil {
+			return fmt.Errorf("parse watch folder records error: %w", err)
+		}
+	}
+	watchRecords = make(map[string]types.WatchFolderRecord, len(records))
+	for _, record := range records {
+		watchRecords[watchRecordKey(record.Path, record.Size, record.ModTime)] = record
+	}
+	return nil
+}
@@ -5,3 +5,7 @@ import (
 )
 
 var SubtitleTasks = sync.Map{} // task id -> SubtitleTask，用于接口查询数据
+
+var SubtitleTaskStepParams = sync.Map{} // task id -> SubtitleTaskStepParam，用于任务完成后局部重新生成
+
+var BatchTasks = sync.Map{} // batch id -> BatchTask
@@ -0,0 +1,45 @@
+package types
+
+import "sync"
+
+const BatchTaskArchiveFileName = "batch_result.zip"
+
+// BatchTaskStatusPartialSuccess 批量任务结束，但部分子任务失败，与SubtitleTaskStatus共用取值
+const BatchTaskStatusPartialSuccess uint8 = 5
+
+// BatchTask 批量任务，由播放列表、合集或频道展开为多个共享参数的字幕任务。
+// 执行任务的协程和查询并发访问，字段通过Update修改、通过Snapshot读取
+type BatchTask struct {
+	lock               sync.Mutex
+	BatchId            string   `json:"batch_id"`
+	Link               string   `json:"link"`
+	Title              string   `json:"title"`
+	Status             uint8    `json:"status"` // 1-处理中,2-成功,3-失败,5-部分成功
+	FailReason         string   `json:"fail_reason"`
+	TaskIds            []string `json:"task_ids"` // 子任务id，按播放列表顺序
+	ArchiveDownloadUrl string   `json:"archive_download_url"`
+	CreateTime         int64    `json:"create_time"`
+}
+
+// Update 加锁修改批量任务
+func (b *BatchTask) Update(fn func(b *BatchTask)) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	fn(b)
+}
+
+// Snapshot 加锁复制当前的批量任务
+func (b *BatchTask) Snapshot() *BatchTask {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return &BatchTask{
+		BatchId:            b.BatchId,
+		Link:               b.Link,
+		Title:              b.Title,
+		Status:             b.Status,
+		FailReason:         b.FailReason,
+		TaskIds:            append([]string(nil), b.TaskIds...),
+		ArchiveDownloadUrl: b.ArchiveDownloadUrl,
+		CreateTime:         b.CreateTime,
+	}
+}
@@ -1,32 +1,45 @@
 package types
 
-const AssHeaderHorizontal = `[Script Info]
-Title: Example
-Original Script: 
-ScriptType: v4.00+
-PlayDepth: 0
-
-[V4+ Styles]
-Format: Name, Fontname, Fontsize, PrimaryColour, SecondaryColour, OutlineColour, BackColour, Bold, Italic, Underline, StrikeOut, ScaleX, ScaleY, Spacing, Angle, BorderStyle, Outline, Shadow, Alignment, MarginL, MarginR, MarginV, Encoding
-Style: Major,Arial,14,&H00BFFF,&H000000FF,&H00000000,&H64000000,-1,0,0,0,100,100,0,0,1,2.5,1.5,2,10,10,20,1
-Style: Minor,Arial,10,&H00BFFF,&H000000FF,&H00000000,&H64000000,-1,0,0,0,100,100,0,0,1,2.5,1.5,2,10,10,30,1
+// SubtitleLineStyle 嵌入视频的一行字幕的样式，为空的字段使用默认值。
+// 字号、描边、阴影、间距和边距以视频高度1080为基准，按实际分辨率缩放。
+type SubtitleLineStyle struct {
+	FontName     string   `json:"font_name"`     // 字体名称
+	FontFile     string   `json:"font_file"`     // 字体文件路径，需同时填写该文件内的字体名称font_name
+	FontSize     float64  `json:"font_size"`     // 字号
+	Bold         *bool    `json:"bold"`          // 是否加粗
+	PrimaryColor string   `json:"primary_color"` // 文字颜色，#RRGGBB或#AARRGGBB，AA为透明度，00不透明
+	OutlineColor string   `json:"outline_color"` // 描边颜色
+	Outline      *float64 `json:"outline"`       // 描边宽度
+	Shadow       *float64 `json:"shadow"`        // 阴影距离
+	Spacing      *float64 `json:"spacing"`       // 字间距
+	Box          *bool    `json:"box"`           // 是否用背景框代替描边
+	BoxColor     string   `json:"box_color"`     // 背景框颜色
+	Alignment    int      `json:"alignment"`     // 位置，按小键盘1-9，2为底部居中
+	MarginL      *float64 `json:"margin_l"`      // 左边距
+	MarginR      *float64 `json:"margin_r"`      // 右边距
+	MarginV      *float64 `json:"margin_v"`      // 垂直边距
+}
 
+// SubtitleStyle 嵌入视频的字幕样式，主字幕为双语字幕的上一行或竖屏的中文行，副字幕为另一行
+type SubtitleStyle struct {
+	Major SubtitleLineStyle `json:"major"`
+	Minor SubtitleLineStyle `json:"minor"`
+}
 
-[Events]
-Format: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text
-`
-const AssHeaderVertical = `[Script Info]
-Title: Example
-Original Script: 
+const AssHeaderFormat = `[Script Info]
+Title: KrillinAI
 ScriptType: v4.00+
+PlayResX: %d
+PlayResY: %d
+ScaledBorderAndShadow: yes
 PlayDepth: 0
 
 [V4+ Styles]
 Format: Name, Fontname, Fontsize, PrimaryColour, SecondaryColour, OutlineColour, BackColour, Bold, Italic, Underline, StrikeOut, ScaleX, ScaleY, Spacing, Angle, BorderStyle, Outline, Shadow, Alignment, MarginL, MarginR, MarginV, Encoding
-Style: Major,Arial,15,&H00BFFF,&H000000FF,&H00000000,&H64000000,-1,0,0,0,100,100,-10,0,1,2.5,1.5,2,10,10,80,1
-Style: Minor,Arial,8,&H00BFFF,&H000000FF,&H00000000,&H64000000,-1,0,0,0,100,100,-10,0,1,2.5,1.5,2,10,10,100,1
-
+%s
 
 [Events]
 Format: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text
 `
+
+const SubtitleTaskFontsDirName = "fonts" // 任务使用的字体文件复制到任务目录下的这个目录
@@ -1,9 +1,20 @@
 package types
 
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
 type ChatCompleter interface {
 	ChatCompletion(query string) (string, error)
 }
 
+// OptionChatCompleter 支持按次指定生成参数的大模型客户端
+type OptionChatCompleter interface {
+	ChatCompletionWithOptions(query string, options ChatOptions) (string, ChatUsage, error)
+}
+
 type Transcriber interface {
 	Transcription(audioFile, language, wordDir string) (*TranscriptionData, error)
 }
@@ -11,3 +22,35 @@ type Transcriber interface {
 type Ttser interface {
 	Text2Speech(text string, voice string, outputFile string) error
 }
+
+// ErrTtsTemporary 合成客户端判断为暂时性的失败，如超时、连接中断，可以重试
+var ErrTtsTemporary = errors.New("tts temporary error")
+
+// TtsStatusError 合成接口返回了非200状态码
+type TtsStatusError struct {
+	Provider   string
+	StatusCode int
+}
+
+func (e *TtsStatusError) Error() string {
+	return fmt.Sprintf("%s tts none-200 status code: %d", e.Provider, e.StatusCode)
+}
+
+type VoiceCloner interface {
+	// CloneVoice 用本地音频文件克隆音色，返回可供Ttser使用的音色编码
+	CloneVoice(audioFile, voiceName string) (string, error)
+}
+
+type ForcedAligner interface {
+	// Align 把音频与按顺序给出的句子强制对齐，返回与句子一一对应的时间，时间相对音频开头
+	Align(ctx context.Context, audioFile string, sentences []string, language string) ([]AlignedSentence, error)
+}
+
+type SourceResolver interface {
+	// Name 解析器名称，用于日志
+	Name() string
+	// Match 判断是否能处理该链接
+	Match(link string) bool
+	// Resolve 把链接对应的媒体下载或提取到本地
+	Resolve(ctx context.Context, link string, option SourceResolveOption) (*SourceMedia, error)
+}
@@ -1,5 +1,7 @@
 package types
 
+import "unicode"
+
 type StandardLanguageCode string
 
 const (
@@ -221,3 +223,153 @@ func GetStandardLanguageName(code StandardLanguageCode) string {
 	}
 	return "未知"
 }
+
+// standardLanguageCode2Iso6392 封装视频时字幕轨道的语言标签，使用ISO 639-2/B三字母代码
+var standardLanguageCode2Iso6392 = map[StandardLanguageCode]string{
+	LanguageNameSimplifiedChinese:  "chi",
+	LanguageNameTraditionalChinese: "chi",
+	LanguageNameEnglish:            "eng",
+	LanguageNameJapanese:           "jpn",
+	LanguageNameIndonesian:         "ind",
+	LanguageNameMalaysian:          "may",
+	LanguageNameThai:               "tha",
+	LanguageNameVietnamese:         "vie",
+	LanguageNameFilipino:           "fil",
+	LanguageNameKorean:             "kor",
+	LanguageNameArabic:             "ara",
+	LanguageNameFrench:             "fre",
+	LanguageNameGerman:             "ger",
+	LanguageNameItalian:            "ita",
+	LanguageNameRussian:            "rus",
+	LanguageNamePortuguese:         "por",
+	LanguageNameSpanish:            "spa",
+	LanguageNameHindi:              "hin",
+	LanguageNameBengali:            "ben",
+	LanguageNameHebrew:             "heb",
+	LanguageNamePersian:            "per",
+	LanguageNameAfrikaans:          "afr",
+	LanguageNameSwedish:            "swe",
+	LanguageNameFinnish:            "fin",
+	LanguageNameDanish:             "dan",
+	LanguageNameNorwegian:          "nor",
+	LanguageNameDutch:              "dut",
+	LanguageNameGreek:              "gre",
+	LanguageNameUkrainian:          "ukr",
+	LanguageNameHungarian:          "hun",
+	LanguageNamePolish:             "pol",
+	LanguageNameTurkish:            "tur",
+	LanguageNameSerbian:            "srp",
+	LanguageNameCroatian:           "hrv",
+	LanguageNameCzech:              "cze",
+	LanguageNamePinyin:             "chi",
+	LanguageNameSwahili:            "swa",
+	LanguageNameYoruba:             "yor",
+	LanguageNameHausa:              "hau",
+	LanguageNameAmharic:            "amh",
+	LanguageNameOromo:              "orm",
+	LanguageNameIcelandic:          "ice",
+	LanguageNameLuxembourgish:      "ltz",
+	LanguageNameCatalan:            "cat",
+	LanguageNameRomanian:           "rum",
+	LanguageNameSlovak:             "slo",
+	LanguageNameBosnian:            "bos",
+	LanguageNameMacedonian:         "mac",
+	LanguageNameSlovenian:          "slv",
+	LanguageNameBulgarian:          "bul",
+	LanguageNameLatvian:            "lav",
+	LanguageNameLithuanian:         "lit",
+	LanguageNameEstonian:           "est",
+	LanguageNameMaltese:            "mlt",
+	LanguageNameAlbanian:           "alb",
+	LanguageNamePunjabi:            "pan",
+	LanguageNameJavanese:           "jav",
+	LanguageNameTamil:              "tam",
+	LanguageNameUrdu:               "urd",
+	LanguageNameMarathi:            "mar",
+	LanguageNameTelugu:             "tel",
+	LanguageNamePashto:             "pus",
+	LanguageNameLingala:            "lin",
+	LanguageNameMalayalam:          "mal",
+	LanguageNameHakkaChin:          "cnh",
+	LanguageNameUzbek:              "uzb",
+	LanguageNameKannada:            "kan",
+	LanguageNameOdia:               "ori",
+	LanguageNameIgbo:               "ibo",
+	LanguageNameZulu:               "zul",
+	LanguageNameXhosa:              "xho",
+	LanguageNameKhmer:              "khm",
+	LanguageNameLao:                "lao",
+	LanguageNameGeorgian:           "geo",
+	LanguageNameArmenian:           "arm",
+	LanguageNameTajik:              "tgk",
+	LanguageNameTurkmen:            "tuk",
+	LanguageNameKazakh:             "kaz",
+	LanguageNameKyrgyz:             "kir",
+	LanguageNameMongolian:          "mon",
+	LanguageNameScottishGaelic:     "gla",
+	LanguageNameIrish:              "gle",
+	LanguageNameWelsh:              "wel",
+	LanguageNameBashkir:            "bak",
+	LanguageNameCebuano:            "ceb",
+	LanguageNameIlocano:            "ilo",
+	LanguageNameTatar:              "tat",
+	LanguageNamePali:               "pli",
+	LanguageNameKinyarwanda:        "kin",
+	LanguageNameBelarusian:         "bel",
+	LanguageNameMalagasy:           "mlg",
+	LanguageNameTuvaluan:           "tvl",
+	LanguageNameMarshallese:        "mah",
+	LanguageNameChamorro:           "cha",
+	LanguageNameSamoan:             "smo",
+	LanguageNameTongan:             "ton",
+	LanguageNameMaori:              "mao",
+	LanguageNameTokPisin:           "tpi",
+	LanguageNameChuvash:            "chv",
+	LanguageNameKomi:               "kom",
+	LanguageNameManx:               "glv",
+}
+
+// GetIso6392Code 返回语言的ISO 639-2代码，未知语言返回und
+func GetIso6392Code(code StandardLanguageCode) string {
+	if iso, ok := standardLanguageCode2Iso6392[code]; ok {
+		return iso
+	}
+	return "und"
+}
+
+// GetIso6391Code 返回语言的ISO 639-1代码，中文的各种写法都为zh，没有两字母代码的语言沿用三字母代码
+func GetIso6391Code(code StandardLanguageCode) string {
+	switch code {
+	case LanguageNameSimplifiedChinese, LanguageNameTraditionalChinese, LanguageNamePinyin:
+		return "zh"
+	}
+	return string(code)
+}
+
+// LanguageScript 语言的书写特征，用于把字幕句子和转录的词对齐
+type LanguageScript struct {
+	SpaceDelimited bool                  // 词之间是否用空格分隔
+	CharScripts    []*unicode.RangeTable // 这些文字逐字对齐，其余文字的字母数字按词对齐
+}
+
+// unspacedScripts 不用空格分词的文字，在任何语言中出现都逐字对齐
+var unspacedScripts = []*unicode.RangeTable{unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Thai, unicode.Lao, unicode.Khmer, unicode.Myanmar, unicode.Tibetan}
+
+var languageScripts = map[StandardLanguageCode]LanguageScript{
+	LanguageNameSimplifiedChinese:  {SpaceDelimited: false, CharScripts: unspacedScripts},
+	LanguageNameTraditionalChinese: {SpaceDelimited: false, CharScripts: unspacedScripts},
+	LanguageNameJapanese:           {SpaceDelimited: false, CharScripts: unspacedScripts},
+	LanguageNameThai:               {SpaceDelimited: false, CharScripts: unspacedScripts},
+	LanguageNameLao:                {SpaceDelimited: false, CharScripts: unspacedScripts},
+	LanguageNameKhmer:              {SpaceDelimited: false, CharScripts: unspacedScripts},
+	// 韩文虽然用空格分词，但转录和大模型的分词习惯常不一致，按音节对齐更稳定
+	LanguageNameKorean: {SpaceDelimited: true, CharScripts: append([]*unicode.RangeTable{unicode.Hangul}, unspacedScripts...)},
+}
+
+// GetLanguageScript 语言的书写特征，未单独配置的语言按空格分词
+func GetLanguageScript(code StandardLanguageCode) LanguageScript {
+	if script, ok := languageScripts[code]; ok {
+		return script
+	}
+	return LanguageScript{SpaceDelimited: true, CharScripts: unspacedScripts}
+}
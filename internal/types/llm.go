@@ -0,0 +1,29 @@
+package types
+
+import "encoding/json"
+
+// 大模型承担的任务类型，用于在多个大模型接口间分配请求
+const (
+	LlmRoleTranslate = "translate" // 字幕翻译
+	LlmRoleSplit     = "split"     // 长句拆分
+	LlmRoleTitle     = "title"     // 视频标题和简介翻译
+	LlmRoleQa        = "qa"        // 字幕质量检查
+)
+
+// LlmPromptVersion 提示词或结果处理方式变化后递增，使之前的大模型缓存失效
+const LlmPromptVersion = "1"
+
+// ChatOptions 单次调用大模型的生成参数
+type ChatOptions struct {
+	Temperature float32
+	MaxTokens   int
+	NumCtx      int             // 上下文窗口大小，0表示使用模型默认值
+	Json        bool            // 要求返回json
+	Schema      json.RawMessage // 返回json需要符合的结构，不支持的接口只要求返回json
+}
+
+// SplitLongSentenceSchema SplitLongSentencePrompt要求的返回结构
+var SplitLongSentenceSchema = json.RawMessage(`{"type":"object","properties":{"align":{"type":"array","items":{"type":"object","properties":{"origin_part":{"type":"string"},"translated_part":{"type":"string"}},"required":["origin_part","translated_part"]}}},"required":["align"]}`)
+
+// SplitOriginLongSentenceSchema SplitOriginLongSentencePrompt要求的返回结构
+var SplitOriginLongSentenceSchema = json.RawMessage(`{"type":"object","properties":{"short_sentences":{"type":"array","items":{"type":"object","properties":{"text":{"type":"string"}},"required":["text"]}}},"required":["short_sentences"]}`)
@@ -0,0 +1,30 @@
+package types
+
+// SourceResolveOption 解析任务链接时的输出位置
+type SourceResolveOption struct {
+	TaskBasePath string // 任务目录，下载的中间文件放在这里
+	AudioPath    string // 提取出的音频保存路径，mp3格式
+	VideoPath    string // 下载的视频保存路径，本地文件时不使用
+	NeedVideo    bool   // 是否需要视频，不嵌入字幕时只需要音频
+}
+
+// SourceMedia 解析后的本地媒体文件和元信息
+type SourceMedia struct {
+	Link        string  // 规范化后的链接
+	AudioPath   string  // 本地音频路径
+	VideoPath   string  // 本地视频路径，没有视频时为空
+	Title       string  // 标题，来源不提供时为空
+	Description string  // 描述
+	Duration    float64 // 时长，秒，未知时为0
+}
+
+// SourcePlaylist 播放列表、合集或频道展开后的视频列表
+type SourcePlaylist struct {
+	Title   string
+	Entries []SourcePlaylistEntry
+}
+
+type SourcePlaylistEntry struct {
+	Link  string
+	Title string
+}
@@ -0,0 +1,39 @@
+package types
+
+// 字幕质量检查发现的问题类型
+const (
+	SubtitleQaIssueMissingTimestamp = "missing_timestamp" // 没有时间戳
+	SubtitleQaIssueEmptyText        = "empty_text"        // 没有文字
+	SubtitleQaIssueZeroDuration     = "zero_duration"     // 结束时间不晚于开始时间
+	SubtitleQaIssueOverlap          = "overlap"           // 与下一条字幕重叠
+	SubtitleQaIssueGap              = "gap"               // 与下一条字幕的间隔过短，会造成闪烁
+	SubtitleQaIssueTooShort         = "too_short"         // 显示时间过短
+	SubtitleQaIssueTooLong          = "too_long"          // 显示时间过长
+	SubtitleQaIssueReadingSpeed     = "reading_speed"     // 阅读速度过快
+	SubtitleQaIssueUntranslated     = "untranslated"      // 缺少译文
+	SubtitleQaIssueIdentical        = "identical"         // 译文与原文相同
+)
+
+// 自动修复的方式
+const (
+	SubtitleQaActionAdjusted     = "adjusted"     // 调整了时间
+	SubtitleQaActionRemoved      = "removed"      // 删除了该条字幕
+	SubtitleQaActionRetranslated = "retranslated" // 重新翻译了译文
+)
+
+// SubtitleQaIssue 一条字幕的一个问题
+type SubtitleQaIssue struct {
+	Index  int    `json:"index"` // 检查前双语字幕中的序号
+	Type   string `json:"type"`
+	Detail string `json:"detail"`
+	Text   string `json:"text"`
+	Action string `json:"action"` // 自动修复的方式，为空表示未修复
+}
+
+// SubtitleQaReport 字幕质量检查报告
+type SubtitleQaReport struct {
+	CueNum   int               `json:"cue_num"`   // 检查的字幕条数
+	IssueNum int               `json:"issue_num"` // 发现的问题数
+	FixedNum int               `json:"fixed_num"` // 自动修复的问题数
+	Issues   []SubtitleQaIssue `json:"issues"`
+}
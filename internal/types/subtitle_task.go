@@ -118,6 +118,10 @@ var TranslateVideoTitleAndDescriptionPrompt = `你是一个专业的翻译专家
 %s
 `
 
+// QaRetranslatePrompt 质量检查时补译缺少译文或译文与原文相同的字幕
+var QaRetranslatePrompt = `请把下面这条字幕翻译成%s，只输出译文，不要输出原文和解释：
+%s`
+
 var SplitLongSentencePrompt = `请将以下原文和译文分割成多个部分，确保每个部分都尽可能短：
 原文：%s
 译文：%s
@@ -237,6 +241,37 @@ const (
 	SubtitleTaskTtsNo
 )
 
+const (
+	SubtitleTaskTtsVoiceCloneFromSourceYes uint8 = iota + 1
+	SubtitleTaskTtsVoiceCloneFromSourceNo
+)
+
+const (
+	SubtitleTaskLlmCacheBypassYes uint8 = iota + 1
+	SubtitleTaskLlmCacheBypassNo
+)
+
+// 转换视频画面比例的方式
+const (
+	ReframeModeLetterbox = "letterbox" // 缩小后加黑边
+	ReframeModeBlur      = "blur"      // 缩小后用模糊的画面填充空白
+	ReframeModeCrop      = "crop"      // 居中裁剪
+	ReframeModeSmart     = "smart"     // 按镜头分析画面，裁剪内容最集中的部分
+)
+
+// Deprecated: 旧的横屏转竖屏方式常量，保留兼容，使用ReframeMode开头的常量
+const (
+	VerticalReframeModeLetterbox = ReframeModeLetterbox
+	VerticalReframeModeBlur      = ReframeModeBlur
+	VerticalReframeModeCrop      = ReframeModeCrop
+	VerticalReframeModeSmart     = ReframeModeSmart
+)
+
+const (
+	DefaultVerticalVideoWidth  = 720
+	DefaultVerticalVideoHeight = 1280
+)
+
 const (
 	SubtitleTaskTtsVoiceCodeLongyu uint8 = iota + 1
 	SubtitleTaskTtsVoiceCodeLongchen
@@ -246,6 +281,7 @@ const (
 	SubtitleTaskStatusProcessing uint8 = iota + 1
 	SubtitleTaskStatusSuccess
 	SubtitleTaskStatusFailed
+	SubtitleTaskStatusPending // 排队中，批量任务中尚未开始的子任务
 )
 
 const (
@@ -271,15 +307,22 @@ const (
 	SubtitleTaskAudioTranscriptionDataPersistenceFileNamePattern = "audio_transcription_data_%d.json"
 	SubtitleTaskTranslationRawDataPersistenceFileNamePattern     = "audio_translation_raw_data_%d.json"
 	SubtitleTaskTranslationDataPersistenceFileNamePattern        = "translation_data_%d.json"
-	SubtitleTaskTransferredVerticalVideoFileName                 = "transferred_vertical_video.mp4"
 	SubtitleTaskHorizontalEmbedVideoFileName                     = "horizontal_embed.mp4"
 	SubtitleTaskVerticalEmbedVideoFileName                       = "vertical_embed.mp4"
+	SubtitleTaskSoftSubtitleMp4FileName                          = "soft_subtitle.mp4"
+	SubtitleTaskSoftSubtitleMkvFileName                          = "soft_subtitle.mkv"
 	SubtitleTaskVideoWithTtsFileName                             = "video_with_tts.mp4"
+	SubtitleTaskVoiceCloneSampleFileName                         = "voice_clone_sample.wav"
+	SubtitleTaskUsageFileName                                    = "usage.json"
+	SubtitleTaskQaReportFileName                                 = "qa_report.json"
 )
 
 const (
 	TtsAudioDurationDetailsFileName = "audio_duration_details.txt"
 	TtsResultAudioFileName          = "tts_final_audio.wav"
+	TtsPreviewDir                   = "./tasks/tts_preview"
+	TtsPreviewMaxTextLength         = 500 // 试听文本的最大字符数
+	TtsPreviewMaxSizeMb             = 100 // 试听音频占用的磁盘上限，超出后淘汰最久未使用的
 )
 
 const (
@@ -302,7 +345,8 @@ type SubtitleTaskStepParam struct {
 	EnableModalFilter           bool
 	EnableTts                   bool
 	TtsVoiceCode                string // 人声语音编码
-	VoiceCloneAudioUrl          string // 音色克隆的源音频oss地址
+	VoiceCloneSrcFilePath       string // 音色克隆的源音频本地路径
+	VoiceCloneFromSource        bool   // 没有指定克隆源时，从视频自身音频中截取干净片段克隆
 	ReplaceWordsMap             map[string]string
 	OriginLanguage              StandardLanguageCode // 视频源语言
 	TargetLanguage              StandardLanguageCode // 用户希望的目标翻译语言
@@ -313,11 +357,20 @@ type SubtitleTaskStepParam struct {
 	TtsSourceFilePath           string
 	TtsResultFilePath           string
 	InputVideoPath              string // 源视频路径
-	EmbedSubtitleVideoType      string // 合成字幕嵌入的视频类型 none不嵌入 horizontal横屏 vertical竖屏
+	EmbedSubtitleVideoType      string // 合成字幕嵌入的视频类型 none不嵌入 horizontal横屏 vertical竖屏 soft_mp4/soft_mkv封装为可选字幕轨道
 	VerticalVideoMajorTitle     string // 合成竖屏视频的主标题
 	VerticalVideoMinorTitle     string
-	MaxWordOneLine              int    // 字幕一行最多显示多少个字
-	VideoWithTtsFilePath        string // 替换源视频的音频为tts结果后的视频路径
+	EmbedAspectRatios           []string // 合成视频的画面比例，如16:9
+	ReframeMode                 string   // 转换画面比例的方式，见ReframeMode开头的常量
+	VerticalVideoWidth          int      // 9:16竖屏视频的分辨率
+	VerticalVideoHeight         int
+	MaxWordOneLine              int            // 字幕一行最多显示多少个字
+	VideoWithTtsFilePath        string         // 替换源视频的音频为tts结果后的视频路径
+	TtsResolvedVoiceCode        string         // 配音实际使用的音色编码，克隆时为克隆结果
+	TtsTextOverrides            map[int]string // 重新合成时修改过的配音文本，字幕序号 -> 文本
+	LlmCacheBypass              bool           // 不使用大模型缓存，重新请求
+	SubtitleStyle               SubtitleStyle  // 嵌入视频的字幕样式
+	EncodingProfile             string         // 合成视频使用的编码配置名称，为空使用默认配置
 }
 
 type SrtSentence struct {
@@ -342,26 +395,38 @@ type SubtitleInfo struct {
 }
 
 type SubtitleTask struct {
-	Id                    uint64         `json:"id" gorm:"column:id"`                                         // 自增id
-	TaskId                string         `json:"task_id" gorm:"column:task_id"`                               // 任务id
-	Title                 string         `json:"title" gorm:"column:title"`                                   // 标题
-	Description           string         `json:"description" gorm:"column:description"`                       // 描述
-	TranslatedTitle       string         `json:"translated_title" gorm:"column:translated_title"`             // 翻译后的标题
-	TranslatedDescription string         `json:"translated_description" gorm:"column:translated_description"` // 翻译后的描述
-	OriginLanguage        string         `json:"origin_language" gorm:"column:origin_language"`               // 视频原语言
-	TargetLanguage        string         `json:"target_language" gorm:"column:target_language"`               // 翻译任务的目标语言
-	VideoSrc              string         `json:"video_src" gorm:"column:video_src"`                           // 视频地址
-	Status                uint8          `json:"status" gorm:"column:status"`                                 // 1-处理中,2-成功,3-失败
-	LastSuccessStepNum    uint8          `json:"last_success_step_num" gorm:"column:last_success_step_num"`   // 最后成功的子任务序号，用于任务恢复
-	FailReason            string         `json:"fail_reason" gorm:"column:fail_reason"`                       // 失败原因
-	ProcessPct            uint8          `json:"process_percent" gorm:"column:process_percent"`               // 处理进度
-	Duration              uint32         `json:"duration" gorm:"column:duration"`                             // 视频时长
-	SrtNum                int            `json:"srt_num" gorm:"column:srt_num"`                               // 字幕数量
-	SubtitleInfos         []SubtitleInfo `gorm:"foreignKey:TaskId;references:TaskId"`
-	Cover                 string         `json:"cover" gorm:"column:cover"`                             // 封面
-	SpeechDownloadUrl     string         `json:"speech_download_url" gorm:"column:speech_download_url"` // 语音文件下载地址
-	CreateTime            int64          `json:"create_time" gorm:"column:create_time;autoCreateTime"`  // 创建时间
-	UpdateTime            int64          `json:"update_time" gorm:"column:update_time;autoUpdateTime"`  // 更新时间
+	Id                    uint64              `json:"id" gorm:"column:id"`                                         // 自增id
+	TaskId                string              `json:"task_id" gorm:"column:task_id"`                               // 任务id
+	Title                 string              `json:"title" gorm:"column:title"`                                   // 标题
+	Description           string              `json:"description" gorm:"column:description"`                       // 描述
+	TranslatedTitle       string              `json:"translated_title" gorm:"column:translated_title"`             // 翻译后的标题
+	TranslatedDescription string              `json:"translated_description" gorm:"column:translated_description"` // 翻译后的描述
+	OriginLanguage        string              `json:"origin_language" gorm:"column:origin_language"`               // 视频原语言
+	TargetLanguage        string              `json:"target_language" gorm:"column:target_language"`               // 翻译任务的目标语言
+	VideoSrc              string              `json:"video_src" gorm:"column:video_src"`                           // 视频地址
+	Status                uint8               `json:"status" gorm:"column:status"`                                 // 1-处理中,2-成功,3-失败
+	LastSuccessStepNum    uint8               `json:"last_success_step_num" gorm:"column:last_success_step_num"`   // 最后成功的子任务序号，用于任务恢复
+	FailReason            string              `json:"fail_reason" gorm:"column:fail_reason"`                       // 失败原因
+	ProcessPct            uint8               `json:"process_percent" gorm:"column:process_percent"`               // 处理进度
+	Duration              uint32              `json:"duration" gorm:"column:duration"`                             // 视频时长
+	SrtNum                int                 `json:"srt_num" gorm:"column:srt_num"`                               // 字幕数量
+	SubtitleInfos         []SubtitleInfo      `gorm:"foreignKey:TaskId;references:TaskId"`
+	Cover                 string              `json:"cover" gorm:"column:cover"`                             // 封面
+	SpeechDownloadUrl     string              `json:"speech_download_url" gorm:"column:speech_download_url"` // 语音文件下载地址
+	TtsCacheHitNum        int                 `json:"tts_cache_hit" gorm:"column:tts_cache_hit"`             // 配音命中缓存的句数
+	TtsCacheMissNum       int                 `json:"tts_cache_miss" gorm:"column:tts_cache_miss"`           // 配音实际合成的句数
+	TtsFailedSentences    []TtsFailedSentence `json:"tts_failed_sentences" gorm:"-"`                         // 配音失败、以静音代替的句子
+	QaReport              *SubtitleQaReport   `json:"qa_report" gorm:"-"`                                    // 字幕质量检查结果
+	Usage                 *TaskUsage          `json:"-" gorm:"-"`                                            // 各提供商的用量和费用
+	CreateTime            int64               `json:"create_time" gorm:"column:create_time;autoCreateTime"`  // 创建时间
+	UpdateTime            int64               `json:"update_time" gorm:"column:update_time;autoUpdateTime"`  // 更新时间
+}
+
+// TtsFailedSentence 配音失败的句子，最终音频中以静音代替
+type TtsFailedSentence struct {
+	Index  int    `json:"index"` // 字幕序号，从1开始
+	Text   string `json:"text"`
+	Reason string `json:"reason"`
 }
 
 type Word struct {
@@ -371,8 +436,16 @@ type Word struct {
 	End   float64
 }
 
+// AlignedSentence 强制对齐得到的一句话的时间，Words可以为空
+type AlignedSentence struct {
+	Start float64
+	End   float64
+	Words []Word
+}
+
 type TranscriptionData struct {
 	Language string
 	Text     string
 	Words    []Word
+	Provider string // 实际完成转录的提供商
 }
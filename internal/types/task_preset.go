@@ -0,0 +1,13 @@
+package types
+
+import "encoding/json"
+
+const TaskPresetFilePath = "./presets/presets.json"
+
+// TaskPreset 命名的任务参数预设，Options是StartVideoSubtitleTaskReq的部分字段
+type TaskPreset struct {
+	Name       string          `json:"name"`
+	Options    json.RawMessage `json:"options"`
+	CreateTime int64           `json:"create_time"`
+	UpdateTime int64           `json:"update_time"`
+}
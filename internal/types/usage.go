@@ -0,0 +1,84 @@
+package types
+
+import (
+	"sort"
+	"sync"
+)
+
+// 用量的类别
+const (
+	UsageKindLlm        = "llm"
+	UsageKindTranscribe = "transcribe"
+	UsageKindTts        = "tts"
+)
+
+// ProviderUsage 一个提供商的累计用量和费用
+type ProviderUsage struct {
+	Kind             string  `json:"kind"`     // llm, transcribe, tts
+	Provider         string  `json:"provider"` // 大模型为接口名，其余为提供商
+	Calls            int     `json:"calls"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	AudioSeconds     float64 `json:"audio_seconds"` // 转录的音频时长
+	TtsChars         int     `json:"tts_chars"`     // 合成语音的字数，命中缓存的不计
+	Cost             float64 `json:"cost"`          // 按配置的单价计算
+}
+
+func (u *ProviderUsage) Add(other ProviderUsage) {
+	u.Calls += other.Calls
+	u.PromptTokens += other.PromptTokens
+	u.CompletionTokens += other.CompletionTokens
+	u.AudioSeconds += other.AudioSeconds
+	u.TtsChars += other.TtsChars
+	u.Cost += other.Cost
+}
+
+// TaskUsage 一个任务中各提供商的用量，可并发记录
+type TaskUsage struct {
+	lock      sync.Mutex
+	providers map[string]*ProviderUsage // kind/provider -> 用量
+}
+
+// Record 累加一次调用的用量，接收者为nil时忽略
+func (t *TaskUsage) Record(usage ProviderUsage) {
+	if t == nil {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.providers == nil {
+		t.providers = make(map[string]*ProviderUsage)
+	}
+	key := usage.Kind + "/" + usage.Provider
+	if existing, ok := t.providers[key]; ok {
+		existing.Add(usage)
+		return
+	}
+	t.providers[key] = &usage
+}
+
+// Snapshot 按类别和提供商排序返回当前用量
+func (t *TaskUsage) Snapshot() []ProviderUsage {
+	if t == nil {
+		return nil
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	usages := make([]ProviderUsage, 0, len(t.providers))
+	for _, usage := range t.providers {
+		usages = append(usages, *usage)
+	}
+	sort.Slice(usages, func(i, j int) bool {
+		if usages[i].Kind != usages[j].Kind {
+			return usages[i].Kind < usages[j].Kind
+		}
+		return usages[i].Provider < usages[j].Provider
+	})
+	return usages
+}
+
+// ChatUsage 一次大模型调用消耗的token
+type ChatUsage struct {
+	PromptTokens     int
+	CompletionTokens int
+}
@@ -0,0 +1,13 @@
+package types
+
+const VoiceCloneRegistryFilePath = "./voices/registry.json"
+
+// VoiceCloneRecord 已克隆音色的记录，同一提供商和账号下相同内容的源音频只克隆一次
+type VoiceCloneRecord struct {
+	Provider   string `json:"provider"`
+	Account    string `json:"account"`  // 克隆所用账号的哈希，音色只能在克隆它的账号下使用
+	SrcHash    string `json:"src_hash"` // 源音频内容的sha256
+	SrcFile    string `json:"src_file"`
+	VoiceCode  string `json:"voice_code"`
+	CreateTime int64  `json:"create_time"`
+}
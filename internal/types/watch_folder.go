@@ -0,0 +1,21 @@
+package types
+
+const WatchFolderRecordFilePath = "./watch/records.json"
+
+const (
+	WatchFolderRecordStatusSuccess = "success"
+	WatchFolderRecordStatusFailed  = "failed"
+	WatchFolderRecordStatusOutput  = "output" // 处理结果写出的文件，不作为新文件处理
+)
+
+// WatchFolderRecord 监控文件夹中已处理过的文件，按路径、大小和修改时间识别，重启后不会重复处理
+type WatchFolderRecord struct {
+	Path        string   `json:"path"`
+	Size        int64    `json:"size"`
+	ModTime     int64    `json:"mod_time"`
+	Status      string   `json:"status"`
+	TaskId      string   `json:"task_id"`
+	FailReason  string   `json:"fail_reason"`
+	Outputs     []string `json:"outputs"`
+	ProcessTime int64    `json:"process_time"`
+}
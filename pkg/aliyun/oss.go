@@ -8,21 +8,33 @@ import (
 	"os"
 )
 
+const defaultOssRegion = "cn-shanghai"
+
 type OssClient struct {
 	*oss.Client
 	Bucket string
+	Region string
 }
 
-func NewOssClient(accessKeyID, accessKeySecret, bucket string) *OssClient {
+// NewOssClient region为空时使用cn-shanghai
+func NewOssClient(accessKeyID, accessKeySecret, bucket, region string) *OssClient {
+	if region == "" {
+		region = defaultOssRegion
+	}
 	credProvider := credentials.NewStaticCredentialsProvider(accessKeyID, accessKeySecret)
 
 	cfg := oss.LoadDefaultConfig().
 		WithCredentialsProvider(credProvider).
-		WithRegion("cn-shanghai")
+		WithRegion(region)
 
 	client := oss.NewClient(cfg)
 
-	return &OssClient{client, bucket}
+	return &OssClient{client, bucket, region}
+}
+
+// ObjectUrl 返回bucket中对象的公网访问地址
+func (o *OssClient) ObjectUrl(objectKey string) string {
+	return fmt.Sprintf("https://%s.oss-%s.aliyuncs.com/%s", o.Bucket, o.Region, objectKey)
 }
 
 func (o *OssClient) UploadFile(ctx context.Context, objectKey, filePath, bucket string) error {
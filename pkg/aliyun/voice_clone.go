@@ -1,13 +1,16 @@
 package aliyun
 
 import (
+	"context"
 	"crypto/hmac"
 	"crypto/sha1"
 	"encoding/base64"
 	"fmt"
 	"go.uber.org/zap"
 	"krillin-ai/log"
+	"krillin-ai/pkg/util"
 	"net/url"
+	"path/filepath"
 	"sort"
 	"strings"
 	"time"
@@ -145,3 +148,24 @@ func (c *VoiceCloneClient) CosyCloneList(voicePrefix string, pageIndex, pageSize
 	}
 	log.GetLogger().Info("CosyCloneList请求成功", zap.String("Response", resp.String()))
 }
+
+// CosyVoiceCloner 先把源音频上传到oss，再调用CosyVoice克隆
+type CosyVoiceCloner struct {
+	ossClient   *OssClient
+	cloneClient *VoiceCloneClient
+}
+
+func NewCosyVoiceCloner(ossClient *OssClient, cloneClient *VoiceCloneClient) *CosyVoiceCloner {
+	return &CosyVoiceCloner{
+		ossClient:   ossClient,
+		cloneClient: cloneClient,
+	}
+}
+
+func (c *CosyVoiceCloner) CloneVoice(audioFile, voiceName string) (string, error) {
+	fileKey := util.GenerateRandStringWithUpperLowerNum(5) + filepath.Ext(audioFile) // 防止url encode的问题，这里统一处理
+	if err := c.ossClient.UploadFile(context.Background(), fileKey, audioFile, c.ossClient.Bucket); err != nil {
+		return "", fmt.Errorf("CosyVoiceCloner upload file error: %w", err)
+	}
+	return c.cloneClient.CosyVoiceClone(voiceName, c.ossClient.ObjectUrl(fileKey))
+}
@@ -0,0 +1,103 @@
+package localalign
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"krillin-ai/internal/types"
+	"krillin-ai/log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// CommandAligner 调用本地强制对齐程序，程序把结果以json写入{output}
+type CommandAligner struct {
+	Command string
+	Args    []string
+}
+
+type alignedWord struct {
+	Text  string  `json:"text"`
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+}
+
+type alignedSentence struct {
+	Start float64       `json:"start"`
+	End   float64       `json:"end"`
+	Words []alignedWord `json:"words"`
+}
+
+func NewCommandAligner(command string, args []string) *CommandAligner {
+	return &CommandAligner{
+		Command: command,
+		Args:    args,
+	}
+}
+
+func (c *CommandAligner) Align(ctx context.Context, audioFile string, sentences []string, language string) ([]types.AlignedSentence, error) {
+	if c.Command == "" {
+		return nil, errors.New("本地强制对齐程序未配置")
+	}
+	absAudioFile, err := filepath.Abs(audioFile)
+	if err != nil {
+		return nil, fmt.Errorf("获取音频绝对路径失败: %w", err)
+	}
+	// 输入输出文件放在音频旁边，以音频文件名区分各个片段
+	base := strings.TrimSuffix(absAudioFile, filepath.Ext(absAudioFile))
+	textFile := base + "_align.txt"
+	outputFile := base + "_align.json"
+	lines := make([]string, len(sentences))
+	for i, sentence := range sentences {
+		lines[i] = strings.Join(strings.Fields(sentence), " ")
+	}
+	if err = os.WriteFile(textFile, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		return nil, fmt.Errorf("写入对齐文本失败: %w", err)
+	}
+	_ = os.Remove(outputFile)
+
+	replacer := strings.NewReplacer("{audio}", absAudioFile, "{text}", textFile, "{language}", language, "{output}", outputFile)
+	cmdArgs := make([]string, 0, len(c.Args))
+	for _, arg := range c.Args {
+		cmdArgs = append(cmdArgs, replacer.Replace(arg))
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Minute)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, c.Command, cmdArgs...)
+	log.GetLogger().Info("本地强制对齐开始", zap.String("cmd", cmd.String()))
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		log.GetLogger().Error("本地强制对齐执行失败", zap.String("output", string(output)), zap.Error(err))
+		return nil, fmt.Errorf("本地强制对齐执行失败: %w", err)
+	}
+
+	data, err := os.ReadFile(outputFile)
+	if err != nil {
+		return nil, fmt.Errorf("读取对齐结果失败: %w", err)
+	}
+	var result []alignedSentence
+	if err = json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("解析对齐结果失败: %w", err)
+	}
+	if len(result) != len(sentences) {
+		return nil, fmt.Errorf("对齐结果数量%d与句子数量%d不一致", len(result), len(sentences))
+	}
+
+	aligned := make([]types.AlignedSentence, len(result))
+	for i, sentence := range result {
+		aligned[i] = types.AlignedSentence{Start: sentence.Start, End: sentence.End}
+		for j, word := range sentence.Words {
+			aligned[i].Words = append(aligned[i].Words, types.Word{Num: j, Text: word.Text, Start: word.Start, End: word.End})
+		}
+	}
+	log.GetLogger().Info("本地强制对齐完成", zap.String("audio", absAudioFile), zap.Int("sentences", len(aligned)))
+	return aligned, nil
+}
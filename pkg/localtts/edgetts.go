@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"krillin-ai/internal/storage"
+	"krillin-ai/internal/types"
 	"krillin-ai/log"
 	"os"
 	"os/exec"
@@ -64,41 +65,19 @@ func (c *EdgeTtsClient) Text2Speech(text, voice, outputFile string) error {
 	}
 	tempFile.Close() // 确保文件被写入
 
-	// 重试机制
-	maxRetries := 3
-	for attempt := 1; attempt <= maxRetries; attempt++ {
-		log.GetLogger().Info("edge-tts转录尝试",
-			zap.Int("attempt", attempt),
-			zap.Int("maxRetries", maxRetries),
-			zap.String("text_length", fmt.Sprintf("%d", len(text))))
-
-		err := c.attemptTTS(tempFileName, voice, absOutputFile, attempt)
-		if err == nil {
-			// 成功生成
-			log.GetLogger().Info("edge-tts转录完成", zap.String("output file", absOutputFile))
-			if _, err := os.Stat(absOutputFile); os.IsNotExist(err) {
-				log.GetLogger().Error("edge-tts 输出文件不存在", zap.String("output file", absOutputFile))
-				return fmt.Errorf("edge-tts 输出文件不存在: %s", absOutputFile)
-			}
-			return nil
-		}
-
-		log.GetLogger().Warn("edge-tts转录失败，准备重试",
-			zap.Int("attempt", attempt),
-			zap.Error(err))
-
-		// 如果不是最后一次尝试，等待一段时间再重试
-		if attempt < maxRetries {
-			waitTime := time.Duration(attempt) * 2 * time.Second
-			log.GetLogger().Info("等待重试", zap.Duration("waitTime", waitTime))
-			time.Sleep(waitTime)
-		}
+	// 重试由调用方按提供商配置统一处理
+	if err = c.attemptTTS(tempFileName, voice, absOutputFile); err != nil {
+		return fmt.Errorf("edge-tts转录失败: %w", err)
 	}
-
-	return fmt.Errorf("edge-tts转录失败，已重试%d次", maxRetries)
+	if _, err = os.Stat(absOutputFile); os.IsNotExist(err) {
+		log.GetLogger().Error("edge-tts 输出文件不存在", zap.String("output file", absOutputFile))
+		return fmt.Errorf("edge-tts 输出文件不存在: %s", absOutputFile)
+	}
+	log.GetLogger().Info("edge-tts转录完成", zap.String("output file", absOutputFile))
+	return nil
 }
 
-func (c *EdgeTtsClient) attemptTTS(tempFileName, voice, absOutputFile string, attempt int) error {
+func (c *EdgeTtsClient) attemptTTS(tempFileName, voice, absOutputFile string) error {
 	// 使用新的edge-tts命令参数（文件输入方式）
 	cmdArgs := []string{
 		"--text-file", tempFileName,
@@ -116,18 +95,30 @@ func (c *EdgeTtsClient) attemptTTS(tempFileName, voice, absOutputFile string, at
 	log.GetLogger().Info("edge-tts转录开始",
 		zap.String("cmd", cmd.String()),
 		zap.String("temp_file", tempFileName),
-		zap.String("output_file", absOutputFile),
-		zap.Int("attempt", attempt))
+		zap.String("output_file", absOutputFile))
 
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		if ctx.Err() == context.DeadlineExceeded {
 			log.GetLogger().Error("edge-tts cmd 超时", zap.String("output", string(output)), zap.Error(err))
-			return fmt.Errorf("edge-tts 执行超时")
+			return fmt.Errorf("edge-tts 执行超时: %w", types.ErrTtsTemporary)
 		}
 		log.GetLogger().Error("edge-tts cmd 执行失败", zap.String("output", string(output)), zap.Error(err))
+		if isEdgeTtsNetworkError(string(output)) {
+			return fmt.Errorf("%w: %w", types.ErrTtsTemporary, err)
+		}
 		return err
 	}
 
 	return nil
 }
+
+// isEdgeTtsNetworkError edge-tts的输出是否是连接失败、限流或服务端错误
+func isEdgeTtsNetworkError(output string) bool {
+	for _, marker := range []string{"ClientConnectorError", "ServerDisconnectedError", "WSServerHandshakeError", "TimeoutError", "Connection reset", "429", "503"} {
+		if strings.Contains(output, marker) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+package localtts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"krillin-ai/log"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// CommandVoiceCloner 调用本地克隆程序，程序标准输出的最后一个非空行作为音色编码
+type CommandVoiceCloner struct {
+	Command string
+	Args    []string
+}
+
+func NewCommandVoiceCloner(command string, args []string) *CommandVoiceCloner {
+	return &CommandVoiceCloner{
+		Command: command,
+		Args:    args,
+	}
+}
+
+func (c *CommandVoiceCloner) CloneVoice(audioFile, voiceName string) (string, error) {
+	if c.Command == "" {
+		return "", errors.New("本地声音克隆程序未配置")
+	}
+	absAudioFile, err := filepath.Abs(audioFile)
+	if err != nil {
+		return "", fmt.Errorf("获取源音频绝对路径失败: %w", err)
+	}
+
+	replacer := strings.NewReplacer("{audio}", absAudioFile, "{name}", voiceName)
+	cmdArgs := make([]string, 0, len(c.Args))
+	for _, arg := range c.Args {
+		cmdArgs = append(cmdArgs, replacer.Replace(arg))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, c.Command, cmdArgs...)
+	log.GetLogger().Info("本地声音克隆开始", zap.String("cmd", cmd.String()))
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		log.GetLogger().Error("本地声音克隆执行失败", zap.String("stderr", stderr.String()), zap.Error(err))
+		return "", fmt.Errorf("本地声音克隆执行失败: %w", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	voiceCode := strings.TrimSpace(lines[len(lines)-1])
+	if voiceCode == "" {
+		return "", errors.New("本地声音克隆程序没有输出音色编码")
+	}
+	log.GetLogger().Info("本地声音克隆完成", zap.String("voice code", voiceCode))
+	return voiceCode, nil
+}
@@ -0,0 +1,110 @@
+package ollama
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"krillin-ai/internal/types"
+	"krillin-ai/log"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const defaultBaseUrl = "http://127.0.0.1:11434"
+
+// Client 使用ollama原生接口对话，支持按json schema约束输出
+type Client struct {
+	baseUrl    string
+	model      string
+	httpClient *http.Client
+}
+
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type chatRequest struct {
+	Model    string         `json:"model"`
+	Messages []chatMessage  `json:"messages"`
+	Stream   bool           `json:"stream"`
+	Format   any            `json:"format,omitempty"` // "json"或json schema
+	Options  map[string]any `json:"options,omitempty"`
+}
+
+type chatResponse struct {
+	Message         chatMessage `json:"message"`
+	PromptEvalCount int         `json:"prompt_eval_count"`
+	EvalCount       int         `json:"eval_count"`
+	Error           string      `json:"error"`
+}
+
+func NewClient(baseUrl, model string) *Client {
+	if baseUrl == "" {
+		baseUrl = defaultBaseUrl
+	}
+	// 兼容填写了openai兼容接口地址的情况
+	baseUrl = strings.TrimSuffix(strings.TrimSuffix(baseUrl, "/"), "/v1")
+	return &Client{
+		baseUrl: baseUrl,
+		model:   model,
+		// 本地模型生成较慢，超时时间放宽
+		httpClient: &http.Client{Timeout: 10 * time.Minute},
+	}
+}
+
+func (c *Client) ChatCompletion(query string) (string, error) {
+	content, _, err := c.ChatCompletionWithOptions(query, types.ChatOptions{Temperature: 0.9, MaxTokens: 8192})
+	return content, err
+}
+
+func (c *Client) ChatCompletionWithOptions(query string, options types.ChatOptions) (string, types.ChatUsage, error) {
+	req := chatRequest{
+		Model: c.model,
+		Messages: []chatMessage{
+			{Role: "system", Content: "You are an assistant that helps with subtitle translation."},
+			{Role: "user", Content: query},
+		},
+		Options: map[string]any{
+			"temperature": options.Temperature,
+			"num_predict": options.MaxTokens,
+		},
+	}
+	if options.NumCtx > 0 {
+		req.Options["num_ctx"] = options.NumCtx
+	}
+	if len(options.Schema) > 0 {
+		req.Format = options.Schema
+	} else if options.Json {
+		req.Format = "json"
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return "", types.ChatUsage{}, err
+	}
+	resp, err := c.httpClient.Post(c.baseUrl+"/api/chat", "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.GetLogger().Error("ollama chat request failed", zap.Error(err))
+		return "", types.ChatUsage{}, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", types.ChatUsage{}, err
+	}
+	var result chatResponse
+	if err = json.Unmarshal(data, &result); err != nil {
+		return "", types.ChatUsage{}, fmt.Errorf("ollama chat parse response error: %w, status: %d", err, resp.StatusCode)
+	}
+	if resp.StatusCode != http.StatusOK || result.Error != "" {
+		log.GetLogger().Error("ollama chat failed", zap.Int("status", resp.StatusCode), zap.String("error", result.Error))
+		return "", types.ChatUsage{}, fmt.Errorf("ollama chat failed, status: %d, error: %s", resp.StatusCode, result.Error)
+	}
+	return result.Message.Content, types.ChatUsage{PromptTokens: result.PromptEvalCount, CompletionTokens: result.EvalCount}, nil
+}
@@ -4,10 +4,16 @@ import (
 	"github.com/sashabaranov/go-openai"
 	"krillin-ai/config"
 	"net/http"
+	"strings"
+	"sync/atomic"
 )
 
 type Client struct {
 	client *openai.Client
+	model  string // 对话使用的模型，为空时使用[llm]中配置的模型
+	json   bool   // 接口是否支持json格式输出
+	// 流式请求是否携带stream_options获取用量，接口拒绝该参数后关闭
+	streamUsage atomic.Bool
 }
 
 func NewClient(baseUrl, apiKey, proxyAddr string) *Client {
@@ -26,5 +32,16 @@ func NewClient(baseUrl, apiKey, proxyAddr string) *Client {
 	}
 
 	client := openai.NewClientWithConfig(cfg)
-	return &Client{client: client}
+	c := &Client{client: client}
+	c.streamUsage.Store(baseUrl == "" || strings.Contains(baseUrl, "api.openai.com"))
+	return c
+}
+
+// NewChatClient 创建使用指定模型对话的客户端
+func NewChatClient(baseUrl, apiKey, model string, json, streamUsage bool, proxyAddr string) *Client {
+	c := NewClient(baseUrl, apiKey, proxyAddr)
+	c.model = model
+	c.json = json
+	c.streamUsage.Store(streamUsage)
+	return c
 }
@@ -3,11 +3,13 @@ package openai
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	openai "github.com/sashabaranov/go-openai"
 	"go.uber.org/zap"
 	"io"
 	"krillin-ai/config"
+	"krillin-ai/internal/types"
 	"krillin-ai/log"
 	"net/http"
 	"os"
@@ -15,10 +17,23 @@ import (
 )
 
 func (c *Client) ChatCompletion(query string) (string, error) {
+	content, _, err := c.ChatCompletionWithOptions(query, types.ChatOptions{Temperature: 0.9, MaxTokens: 8192})
+	return content, err
+}
+
+// ChatCompletionWithOptions 按指定参数对话，接口支持json格式时按要求返回json，同时返回token用量
+func (c *Client) ChatCompletionWithOptions(query string, options types.ChatOptions) (string, types.ChatUsage, error) {
 	var responseFormat *openai.ChatCompletionResponseFormat
+	if options.Json && c.json {
+		responseFormat = &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject}
+	}
+	model := c.model
+	if model == "" {
+		model = config.Conf.Llm.Model
+	}
 
 	req := openai.ChatCompletionRequest{
-		Model: config.Conf.Llm.Model,
+		Model: model,
 		Messages: []openai.ChatCompletionMessage{
 			{
 				Role:    openai.ChatMessageRoleSystem,
@@ -29,20 +44,33 @@ func (c *Client) ChatCompletion(query string) (string, error) {
 				Content: query,
 			},
 		},
-		Temperature:    0.9,
+		Temperature:    options.Temperature,
 		Stream:         true,
-		MaxTokens:      8192,
+		MaxTokens:      options.MaxTokens,
 		ResponseFormat: responseFormat,
 	}
+	if c.streamUsage.Load() {
+		req.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
+	}
 
 	stream, err := c.client.CreateChatCompletionStream(context.Background(), req)
+	if err != nil && req.StreamOptions != nil && isBadRequest(err) {
+		// 部分兼容openai格式的接口不认识stream_options，去掉后重试，之后的请求也不再携带
+		log.GetLogger().Warn("openai create chat completion stream rejected, retry without stream_options", zap.Error(err))
+		c.streamUsage.Store(false)
+		req.StreamOptions = nil
+		stream, err = c.client.CreateChatCompletionStream(context.Background(), req)
+	}
 	if err != nil {
 		log.GetLogger().Error("openai create chat completion stream failed", zap.Error(err))
-		return "", err
+		return "", types.ChatUsage{}, err
 	}
 	defer stream.Close()
 
-	var resContent string
+	var (
+		resContent string
+		usage      types.ChatUsage
+	)
 	for {
 		response, err := stream.Recv()
 		if err == io.EOF {
@@ -50,7 +78,12 @@ func (c *Client) ChatCompletion(query string) (string, error) {
 		}
 		if err != nil {
 			log.GetLogger().Error("openai stream receive failed", zap.Error(err))
-			return "", err
+			return "", types.ChatUsage{}, err
+		}
+		// 用量在最后一个不含choices的数据块中返回
+		if response.Usage != nil {
+			usage.PromptTokens = response.Usage.PromptTokens
+			usage.CompletionTokens = response.Usage.CompletionTokens
 		}
 		if len(response.Choices) == 0 {
 			log.GetLogger().Info("openai stream receive no choices", zap.Any("response", response))
@@ -60,7 +93,20 @@ func (c *Client) ChatCompletion(query string) (string, error) {
 		resContent += response.Choices[0].Delta.Content
 	}
 
-	return resContent, nil
+	return resContent, usage, nil
+}
+
+// isBadRequest 接口是否以400拒绝了请求
+func isBadRequest(err error) bool {
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.HTTPStatusCode == http.StatusBadRequest
+	}
+	var reqErr *openai.RequestError
+	if errors.As(err, &reqErr) {
+		return reqErr.HTTPStatusCode == http.StatusBadRequest
+	}
+	return false
 }
 
 func (c *Client) Text2Speech(text, voice string, outputFile string) error {
@@ -96,7 +142,7 @@ func (c *Client) Text2Speech(text, voice string, outputFile string) error {
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
 		log.GetLogger().Error("openai tts failed", zap.Int("status_code", resp.StatusCode), zap.String("body", string(body)))
-		return fmt.Errorf("openai tts none-200 status code: %d", resp.StatusCode)
+		return &types.TtsStatusError{Provider: "openai", StatusCode: resp.StatusCode}
 	}
 
 	file, err := os.Create(outputFile)
@@ -0,0 +1,22 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"krillin-ai/internal/storage"
+	"krillin-ai/log"
+	"os/exec"
+
+	"go.uber.org/zap"
+)
+
+// extractAudio 从音视频文件中提取mp3音频
+func extractAudio(ctx context.Context, inputFile, outputFile string) error {
+	cmd := exec.CommandContext(ctx, storage.FfmpegPath, "-y", "-i", inputFile, "-vn", "-ar", "44100", "-ac", "2", "-ab", "192k", "-f", "mp3", outputFile)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		log.GetLogger().Error("extractAudio ffmpeg error", zap.String("input", inputFile), zap.String("output", string(output)), zap.Error(err))
+		return fmt.Errorf("extract audio ffmpeg error: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"krillin-ai/config"
+	"krillin-ai/internal/types"
+	"krillin-ai/pkg/util"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	videoExts = []string{".mp4", ".mkv", ".mov", ".webm", ".avi", ".flv", ".m4v", ".ts"}
+	audioExts = []string{".mp3", ".m4a", ".wav", ".flac", ".aac", ".ogg", ".opus"}
+)
+
+// HttpResolver 直接下载链接指向的音视频文件
+type HttpResolver struct{}
+
+func NewHttpResolver() *HttpResolver {
+	return &HttpResolver{}
+}
+
+func (r *HttpResolver) Name() string {
+	return "http"
+}
+
+func (r *HttpResolver) Match(link string) bool {
+	ext, ok := httpMediaExt(link)
+	return ok && (isVideoExt(ext) || isAudioExt(ext))
+}
+
+func (r *HttpResolver) Resolve(ctx context.Context, link string, option types.SourceResolveOption) (*types.SourceMedia, error) {
+	ext, _ := httpMediaExt(link)
+	downloadPath := filepath.Join(option.TaskBasePath, "origin_download"+ext)
+	if err := util.DownloadFile(link, downloadPath, config.Conf.App.Proxy); err != nil {
+		return nil, fmt.Errorf("download file error: %w", err)
+	}
+	if err := extractAudio(ctx, downloadPath, option.AudioPath); err != nil {
+		return nil, err
+	}
+	media := &types.SourceMedia{
+		Link:      link,
+		AudioPath: option.AudioPath,
+	}
+	if isVideoExt(ext) {
+		media.VideoPath = downloadPath
+	}
+	u, _ := url.Parse(link)
+	media.Title = strings.TrimSuffix(path.Base(u.Path), ext)
+	if duration, err := util.GetAudioDuration(option.AudioPath); err == nil {
+		media.Duration = duration
+	}
+	return media, nil
+}
+
+// httpMediaExt 取http(s)链接路径的扩展名
+func httpMediaExt(link string) (string, bool) {
+	u, err := url.Parse(link)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", false
+	}
+	return strings.ToLower(path.Ext(u.Path)), true
+}
+
+func isVideoExt(ext string) bool {
+	for _, e := range videoExts {
+		if e == ext {
+			return true
+		}
+	}
+	return false
+}
+
+func isAudioExt(ext string) bool {
+	for _, e := range audioExts {
+		if e == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// IsMediaFile 根据扩展名判断是否是音视频文件
+func IsMediaFile(filePath string) bool {
+	ext := strings.ToLower(filepath.Ext(filePath))
+	return isVideoExt(ext) || isAudioExt(ext)
+}
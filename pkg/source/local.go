@@ -0,0 +1,46 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"krillin-ai/internal/types"
+	"krillin-ai/pkg/util"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LocalResolver 处理local:开头的本地文件
+type LocalResolver struct{}
+
+func NewLocalResolver() *LocalResolver {
+	return &LocalResolver{}
+}
+
+func (r *LocalResolver) Name() string {
+	return "local"
+}
+
+func (r *LocalResolver) Match(link string) bool {
+	return strings.HasPrefix(link, "local:")
+}
+
+func (r *LocalResolver) Resolve(ctx context.Context, link string, option types.SourceResolveOption) (*types.SourceMedia, error) {
+	filePath := strings.TrimPrefix(link, "local:")
+	if _, err := os.Stat(filePath); err != nil {
+		return nil, fmt.Errorf("local file not found: %w", err)
+	}
+	if err := extractAudio(ctx, filePath, option.AudioPath); err != nil {
+		return nil, err
+	}
+	media := &types.SourceMedia{
+		Link:      link,
+		AudioPath: option.AudioPath,
+		VideoPath: filePath,
+		Title:     strings.TrimSuffix(filepath.Base(filePath), filepath.Ext(filePath)),
+	}
+	if duration, err := util.GetAudioDuration(option.AudioPath); err == nil {
+		media.Duration = duration
+	}
+	return media, nil
+}
@@ -0,0 +1,102 @@
+package source
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"krillin-ai/internal/types"
+	"krillin-ai/log"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// maxPlaylistDepth 展开嵌套播放列表的最大层数，频道链接展开后是/videos、/shorts等标签页，标签页再展开才是视频
+const maxPlaylistDepth = 3
+
+type playlistEntry struct {
+	Type       string `json:"_type"`
+	IeKey      string `json:"ie_key"`
+	Url        string `json:"url"`
+	WebpageUrl string `json:"webpage_url"`
+	Title      string `json:"title"`
+}
+
+// isNestedPlaylist 条目是否是嵌套的播放列表或频道标签页，而不是单个视频
+func (e playlistEntry) isNestedPlaylist() bool {
+	if e.Type == "playlist" {
+		return true
+	}
+	return e.Type == "url" && (strings.HasSuffix(e.IeKey, "Tab") || strings.Contains(e.IeKey, "Playlist"))
+}
+
+// ExpandPlaylist 用yt-dlp把播放列表、合集或频道链接展开为视频链接列表，单个视频返回只有一项的列表
+func ExpandPlaylist(ctx context.Context, link string, maxItems int) (*types.SourcePlaylist, error) {
+	playlist := &types.SourcePlaylist{}
+	if err := expandPlaylist(ctx, link, maxItems, 1, playlist); err != nil {
+		return nil, err
+	}
+	if len(playlist.Entries) == 0 {
+		return nil, fmt.Errorf("expand playlist no video found: %s", link)
+	}
+	return playlist, nil
+}
+
+// expandPlaylist 展开一层链接，把视频追加到playlist中，遇到嵌套的播放列表时继续展开
+func expandPlaylist(ctx context.Context, link string, maxItems, depth int, playlist *types.SourcePlaylist) error {
+	resolver := NewYtdlpResolver()
+	if hostMatch(link, youtubeHosts...) {
+		// 复用youtube的cookies等参数
+		resolver.extraArgs = NewYoutubeResolver().extraArgs
+	}
+	args := []string{"--flat-playlist", "--dump-single-json"}
+	if maxItems > 0 {
+		args = append(args, "--playlist-end", strconv.Itoa(maxItems-len(playlist.Entries)))
+	}
+	output, err := resolver.run(ctx, append(args, link))
+	if err != nil {
+		return fmt.Errorf("expand playlist yt-dlp error: %w", err)
+	}
+
+	var info struct {
+		Type    string          `json:"_type"`
+		Title   string          `json:"title"`
+		Entries []playlistEntry `json:"entries"`
+	}
+	if err = json.Unmarshal(lastJsonLine(output), &info); err != nil {
+		return fmt.Errorf("expand playlist parse yt-dlp output error: %w", err)
+	}
+
+	if playlist.Title == "" {
+		playlist.Title = info.Title
+	}
+	if info.Type != "playlist" {
+		playlist.Entries = append(playlist.Entries, types.SourcePlaylistEntry{Link: link, Title: info.Title})
+		return nil
+	}
+	for _, entry := range info.Entries {
+		if maxItems > 0 && len(playlist.Entries) >= maxItems {
+			break
+		}
+		entryLink := entry.WebpageUrl
+		if entryLink == "" {
+			entryLink = entry.Url
+		}
+		if entryLink == "" {
+			continue
+		}
+		if entry.isNestedPlaylist() {
+			if depth >= maxPlaylistDepth {
+				log.GetLogger().Warn("expand playlist skip nested playlist, too deep", zap.String("link", entryLink), zap.Int("depth", depth))
+				continue
+			}
+			if err = expandPlaylist(ctx, entryLink, maxItems, depth+1, playlist); err != nil {
+				log.GetLogger().Warn("expand playlist skip nested playlist", zap.String("link", entryLink), zap.Error(err))
+			}
+			continue
+		}
+		playlist.Entries = append(playlist.Entries, types.SourcePlaylistEntry{Link: entryLink, Title: entry.Title})
+	}
+	return nil
+}
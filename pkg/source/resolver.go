@@ -0,0 +1,59 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"krillin-ai/internal/types"
+	"krillin-ai/log"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+var (
+	resolversLock sync.RWMutex
+	// 自定义解析器优先于内置解析器，通用的yt-dlp解析器放在最后兜底
+	customResolvers  []types.SourceResolver
+	builtinResolvers = []types.SourceResolver{
+		NewLocalResolver(),
+		NewYoutubeResolver(),
+		NewBilibiliResolver(),
+		NewHttpResolver(),
+		NewYtdlpResolver(),
+	}
+)
+
+// Register 注册自定义解析器，后注册的优先匹配
+func Register(resolver types.SourceResolver) {
+	resolversLock.Lock()
+	defer resolversLock.Unlock()
+	customResolvers = append([]types.SourceResolver{resolver}, customResolvers...)
+}
+
+// Find 找到第一个能处理该链接的解析器
+func Find(link string) (types.SourceResolver, bool) {
+	resolversLock.RLock()
+	defer resolversLock.RUnlock()
+	for _, resolvers := range [][]types.SourceResolver{customResolvers, builtinResolvers} {
+		for _, resolver := range resolvers {
+			if resolver.Match(link) {
+				return resolver, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// Resolve 用匹配的解析器把链接下载或提取到本地
+func Resolve(ctx context.Context, link string, option types.SourceResolveOption) (*types.SourceMedia, error) {
+	resolver, ok := Find(link)
+	if !ok {
+		return nil, fmt.Errorf("unsupported link: %s", link)
+	}
+	log.GetLogger().Info("source resolve start", zap.String("resolver", resolver.Name()), zap.String("link", link))
+	media, err := resolver.Resolve(ctx, link, option)
+	if err != nil {
+		return nil, fmt.Errorf("%s resolver error: %w", resolver.Name(), err)
+	}
+	return media, nil
+}
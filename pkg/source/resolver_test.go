@@ -0,0 +1,34 @@
+package source
+
+import "testing"
+
+func TestFind(t *testing.T) {
+	cases := []struct {
+		link     string
+		resolver string
+	}{
+		{"local:./tasks/demo.mp4", "local"},
+		{"https://www.youtube.com/watch?v=dQw4w9WgXcQ", "youtube"},
+		{"https://youtu.be/dQw4w9WgXcQ", "youtube"},
+		{"https://www.bilibili.com/video/BV1xx411c7mD", "bilibili"},
+		{"https://example.com/media/talk.MP4?token=1", "http"},
+		{"https://example.com/podcast/episode.mp3", "http"},
+		{"https://vimeo.com/76979871", "yt-dlp"},
+		// 专门解析器的域名下格式不对的链接不交给通用解析器
+		{"https://www.bilibili.com/read/cv123", ""},
+		{"https://www.youtube.com/watch?x=1", ""},
+		{"https://youtu.be/", ""},
+		{"ftp://example.com/a.mp4", ""},
+		{"not a link", ""},
+	}
+	for _, c := range cases {
+		resolver, ok := Find(c.link)
+		name := ""
+		if ok {
+			name = resolver.Name()
+		}
+		if name != c.resolver {
+			t.Errorf("Find(%q) = %q, want %q", c.link, name, c.resolver)
+		}
+	}
+}
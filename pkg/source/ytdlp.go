@@ -0,0 +1,190 @@
+package source
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"krillin-ai/config"
+	"krillin-ai/internal/storage"
+	"krillin-ai/internal/types"
+	"krillin-ai/log"
+	"krillin-ai/pkg/util"
+	"net/url"
+	"os/exec"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// YtdlpResolver 通过yt-dlp下载，支持yt-dlp能处理的所有网站
+type YtdlpResolver struct {
+	name        string
+	match       func(link string) bool
+	normalize   func(link string) (string, error) // 规范化链接，为nil时原样使用
+	audioFormat string
+	videoFormat string
+	extraArgs   []string
+}
+
+// 由专门的解析器处理的域名，这些网站的链接格式不对时不交给通用解析器，以便创建任务时就报错
+var (
+	youtubeHosts  = []string{"youtube.com", "youtu.be"}
+	bilibiliHosts = []string{"bilibili.com"}
+)
+
+// NewYtdlpResolver 通用解析器，匹配专门解析器的域名之外的所有http(s)链接
+func NewYtdlpResolver() *YtdlpResolver {
+	return &YtdlpResolver{
+		name: "yt-dlp",
+		match: func(link string) bool {
+			u, err := url.Parse(link)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return false
+			}
+			return !hostMatch(link, youtubeHosts...) && !hostMatch(link, bilibiliHosts...)
+		},
+		audioFormat: "bestaudio/best",
+		videoFormat: "bestvideo[height<=1080]+bestaudio/best[height<=1080]/best",
+	}
+}
+
+func NewYoutubeResolver() *YtdlpResolver {
+	return &YtdlpResolver{
+		name: "youtube",
+		match: func(link string) bool {
+			return hostMatch(link, youtubeHosts...)
+		},
+		normalize: func(link string) (string, error) {
+			videoId, err := util.GetYouTubeID(link)
+			if err != nil {
+				return "", err
+			}
+			if videoId == "" {
+				return "", errors.New("invalid youtube link")
+			}
+			return "https://www.youtube.com/watch?v=" + videoId, nil
+		},
+		audioFormat: "bestaudio",
+		videoFormat: "bestvideo[height<=1080][ext=mp4]+bestaudio[ext=m4a]/bestvideo[height<=720][ext=mp4]+bestaudio[ext=m4a]/bestvideo[height<=480][ext=mp4]+bestaudio[ext=m4a]",
+		extraArgs:   []string{"--cookies", "./cookies.txt"},
+	}
+}
+
+func NewBilibiliResolver() *YtdlpResolver {
+	return &YtdlpResolver{
+		name: "bilibili",
+		match: func(link string) bool {
+			return hostMatch(link, bilibiliHosts...)
+		},
+		normalize: func(link string) (string, error) {
+			videoId := util.GetBilibiliVideoId(link)
+			if videoId == "" {
+				return "", errors.New("invalid bilibili link")
+			}
+			return "https://www.bilibili.com/video/" + videoId, nil
+		},
+		audioFormat: "bestaudio[ext=m4a]",
+		videoFormat: "bestvideo[height<=1080][ext=mp4]+bestaudio[ext=m4a]/bestvideo[height<=720][ext=mp4]+bestaudio[ext=m4a]/bestvideo[height<=480][ext=mp4]+bestaudio[ext=m4a]",
+	}
+}
+
+func (r *YtdlpResolver) Name() string {
+	return r.name
+}
+
+func (r *YtdlpResolver) Match(link string) bool {
+	if !r.match(link) {
+		return false
+	}
+	if r.normalize != nil {
+		_, err := r.normalize(link)
+		return err == nil
+	}
+	return true
+}
+
+func (r *YtdlpResolver) Resolve(ctx context.Context, link string, option types.SourceResolveOption) (*types.SourceMedia, error) {
+	if r.normalize != nil {
+		normalized, err := r.normalize(link)
+		if err != nil {
+			return nil, err
+		}
+		link = normalized
+	}
+
+	// 下载音频的同时输出视频信息
+	args := []string{"-f", r.audioFormat, "--extract-audio", "--audio-format", "mp3", "--audio-quality", "192K", "--no-playlist", "--dump-json", "--no-simulate", "-o", option.AudioPath}
+	output, err := r.run(ctx, append(args, link))
+	if err != nil {
+		return nil, fmt.Errorf("download audio error: %w", err)
+	}
+	media := &types.SourceMedia{
+		Link:      link,
+		AudioPath: option.AudioPath,
+	}
+	var info struct {
+		Title       string  `json:"title"`
+		Description string  `json:"description"`
+		Duration    float64 `json:"duration"`
+	}
+	if err = json.Unmarshal(lastJsonLine(output), &info); err != nil {
+		log.GetLogger().Warn("yt-dlp parse video info error", zap.String("link", link), zap.Error(err))
+	} else {
+		media.Title, media.Description, media.Duration = info.Title, info.Description, info.Duration
+	}
+
+	if option.NeedVideo {
+		args = []string{"-f", r.videoFormat, "--merge-output-format", "mp4", "--no-playlist", "-o", option.VideoPath}
+		if _, err = r.run(ctx, append(args, link)); err != nil {
+			return nil, fmt.Errorf("download video error: %w", err)
+		}
+		media.VideoPath = option.VideoPath
+	}
+	return media, nil
+}
+
+func (r *YtdlpResolver) run(ctx context.Context, args []string) ([]byte, error) {
+	link := args[len(args)-1]
+	cmdArgs := append([]string{}, args[:len(args)-1]...)
+	if config.Conf.App.Proxy != "" {
+		cmdArgs = append(cmdArgs, "--proxy", config.Conf.App.Proxy)
+	}
+	cmdArgs = append(cmdArgs, r.extraArgs...)
+	if storage.FfmpegPath != "ffmpeg" {
+		cmdArgs = append(cmdArgs, "--ffmpeg-location", storage.FfmpegPath)
+	}
+	cmdArgs = append(cmdArgs, link)
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, storage.YtdlpPath, cmdArgs...)
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		log.GetLogger().Error("yt-dlp error", zap.String("cmd", cmd.String()), zap.String("stderr", stderr.String()), zap.Error(err))
+		return nil, err
+	}
+	return output, nil
+}
+
+// hostMatch 判断链接的域名是否是domains之一或其子域名
+func hostMatch(link string, domains ...string) bool {
+	u, err := url.Parse(link)
+	if err != nil {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, domain := range domains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// lastJsonLine yt-dlp的--dump-json每个视频输出一行json，取最后一行
+func lastJsonLine(output []byte) []byte {
+	lines := bytes.Split(bytes.TrimSpace(output), []byte("\n"))
+	return lines[len(lines)-1]
+}
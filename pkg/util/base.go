@@ -15,6 +15,7 @@ import (
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"unicode"
@@ -120,6 +121,49 @@ func Unzip(zipFile, destDir string) error {
 	return nil
 }
 
+// Zip 把文件打包为zip，files为 包内路径 -> 本地文件路径
+func Zip(zipFile string, files map[string]string) error {
+	out, err := os.Create(zipFile)
+	if err != nil {
+		return fmt.Errorf("创建zip文件失败: %v", err)
+	}
+	defer out.Close()
+
+	zipWriter := zip.NewWriter(out)
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err = addFileToZip(zipWriter, name, files[name]); err != nil {
+			zipWriter.Close()
+			return err
+		}
+	}
+	if err = zipWriter.Close(); err != nil {
+		return fmt.Errorf("写入zip文件失败: %v", err)
+	}
+	return nil
+}
+
+func addFileToZip(zipWriter *zip.Writer, name, srcFile string) error {
+	src, err := os.Open(srcFile)
+	if err != nil {
+		return fmt.Errorf("打开文件失败: %v", err)
+	}
+	defer src.Close()
+
+	dst, err := zipWriter.Create(filepath.ToSlash(name))
+	if err != nil {
+		return fmt.Errorf("创建zip文件内容失败: %v", err)
+	}
+	if _, err = io.Copy(dst, src); err != nil {
+		return fmt.Errorf("复制文件内容失败: %v", err)
+	}
+	return nil
+}
+
 func GenerateID() string {
 	return strings.ReplaceAll(uuid.New().String(), "-", "")
 }
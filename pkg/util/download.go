@@ -55,6 +55,9 @@ func DownloadFile(urlStr, filepath, proxyAddr string) error {
 		return err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("下载文件失败，状态码: %d", resp.StatusCode)
+	}
 
 	size := resp.ContentLength
 	fmt.Printf("文件大小: %.2f MB\n", float64(size)/1024/1024)